@@ -0,0 +1,125 @@
+package audit
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"strconv"
+	"time"
+
+	"github.com/google/uuid"
+	"goPass/models"
+	"gorm.io/gorm"
+)
+
+// Events recorded in the audit log.
+const (
+	EventRegister        = "account.register"
+	EventLogin           = "login"
+	EventTokenRefresh    = "token.refresh"
+	EventAccountLock     = "account.lock"
+	EventAccountUnlock   = "account.unlock"
+	EventDeviceRegister  = "device.register"
+	EventDeviceRevoke    = "device.revoke"
+	EventVaultRegister   = "vault.register" // master and recovery keys set up
+	EventKeyPairRegister = "keypair.register"
+	EventEntryCreate     = "entry.create"
+	EventEntryUpdate     = "entry.update"
+	EventEntryDelete     = "entry.delete"
+	EventVaultImport     = "vault.import"
+)
+
+const (
+	OutcomeSuccess = "success"
+	OutcomeFailure = "failure"
+)
+
+const (
+	maxUserAgent = 512
+	hashVersion  = "v1"
+	// AnonymousChain holds the events that belong to no user, such as
+	// logins to unknown emails.
+	AnonymousChain = "anonymous"
+)
+
+// Record appends an event to the end of its user's chain. An empty outcome
+// counts as a success. Appends to one chain are serialized with an advisory
+// lock, so two requests can't both claim the same position.
+func Record(db *gorm.DB, event models.AuditEvent) error {
+	event.ID = uuid.New()
+	if event.Outcome == "" {
+		event.Outcome = OutcomeSuccess
+	}
+	if len(event.UserAgent) > maxUserAgent {
+		event.UserAgent = event.UserAgent[:maxUserAgent]
+	}
+	if event.CreatedAt.IsZero() {
+		event.CreatedAt = time.Now()
+	}
+	// Postgres keeps microseconds, the hash must survive the round trip
+	event.CreatedAt = event.CreatedAt.UTC().Truncate(time.Microsecond)
+
+	return db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Exec("SELECT pg_advisory_xact_lock(hashtext(?))", "audit:"+ChainID(event.UserID)).Error; err != nil {
+			return err
+		}
+		last := models.AuditEvent{}
+		if err := chain(tx, event.UserID).Select("seq", "hash").Order("seq DESC").Limit(1).Find(&last).Error; err != nil {
+			return err
+		}
+		event.Seq = last.Seq + 1
+		event.PrevHash = last.Hash
+		event.Hash = Hash(event)
+		return tx.Create(&event).Error
+	})
+}
+
+// ChainID names the chain of a user, as used in checkpoints and reports.
+func ChainID(userId *uuid.UUID) string {
+	if userId == nil {
+		return AnonymousChain
+	}
+	return userId.String()
+}
+
+func chain(db *gorm.DB, userId *uuid.UUID) *gorm.DB {
+	if userId == nil {
+		return db.Model(&models.AuditEvent{}).Where("user_id IS NULL")
+	}
+	return db.Model(&models.AuditEvent{}).Where("user_id=?", *userId)
+}
+
+// Hash is the SHA-256 of every field of the event but Hash itself, each
+// prefixed with its length so no two events encode the same. Including
+// PrevHash links the event to everything before it in the chain.
+func Hash(event models.AuditEvent) string {
+	h := sha256.New()
+	for _, field := range []string{
+		hashVersion,
+		event.ID.String(),
+		optionalID(event.UserID),
+		strconv.FormatInt(event.Seq, 10),
+		event.Event,
+		event.Outcome,
+		optionalID(event.TargetID),
+		optionalID(event.DeviceID),
+		event.IP,
+		event.UserAgent,
+		event.Detail,
+		event.CreatedAt.UTC().Format(time.RFC3339Nano),
+		event.PrevHash,
+	} {
+		var size [4]byte
+		binary.BigEndian.PutUint32(size[:], uint32(len(field)))
+		h.Write(size[:])
+		h.Write([]byte(field))
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+func optionalID(id *uuid.UUID) string {
+	if id == nil {
+		return ""
+	}
+	return id.String()
+}
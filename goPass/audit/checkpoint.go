@@ -0,0 +1,197 @@
+package audit
+
+import (
+	"bytes"
+	"context"
+	"crypto/ed25519"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"reflect"
+	"time"
+
+	"github.com/google/uuid"
+	"goPass/models"
+	"goPass/storage"
+	"gorm.io/datatypes"
+	"gorm.io/gorm"
+)
+
+const CheckpointFormat = "gopass-audit-checkpoint"
+
+var ErrBadSignature = errors.New("checkpoint signature is not valid")
+
+// Checkpoint is a signed statement of the head of every chain at one point
+// in time. Kept somewhere the database's users can't write to, it proves
+// that nothing up to those heads was changed or cut off since, which the
+// chain alone can't show for the newest events.
+type Checkpoint struct {
+	Format    string          `json:"format"`
+	CreatedAt time.Time       `json:"createdAt"`
+	Heads     map[string]Head `json:"heads"`
+	Signature []byte          `json:"signature,omitempty"`
+}
+
+// signedBytes is what the signature covers: the checkpoint without it. The
+// keys of Heads are sorted by encoding/json, so the bytes are stable.
+func (c Checkpoint) signedBytes() ([]byte, error) {
+	c.Signature = nil
+	return json.Marshal(c)
+}
+
+func (c *Checkpoint) Sign(key ed25519.PrivateKey) error {
+	data, err := c.signedBytes()
+	if err != nil {
+		return err
+	}
+	c.Signature = ed25519.Sign(key, data)
+	return nil
+}
+
+func (c Checkpoint) VerifySignature(key ed25519.PublicKey) error {
+	data, err := c.signedBytes()
+	if err != nil {
+		return err
+	}
+	if c.Format != CheckpointFormat || !ed25519.Verify(key, data, c.Signature) {
+		return ErrBadSignature
+	}
+	return nil
+}
+
+// CheckpointName is the name a checkpoint is exported under.
+func CheckpointName(t time.Time) string {
+	return "checkpoint-" + t.UTC().Format("20060102T150405Z") + ".json"
+}
+
+// CurrentHeads returns the last event of every chain.
+func CurrentHeads(db *gorm.DB) (map[string]Head, error) {
+	rows := []struct {
+		UserID *uuid.UUID
+		Seq    int64
+		Hash   string
+	}{}
+	err := db.Raw("SELECT DISTINCT ON (user_id) user_id, seq, hash FROM audit_events ORDER BY user_id, seq DESC").
+		Scan(&rows).Error
+	if err != nil {
+		return nil, err
+	}
+	heads := map[string]Head{}
+	for _, row := range rows {
+		heads[ChainID(row.UserID)] = Head{Seq: row.Seq, Hash: row.Hash}
+	}
+	return heads, nil
+}
+
+// CreateCheckpoint signs the current heads and stores the checkpoint in the
+// database and, when store is set, exports it there. Nothing is written when
+// no event was recorded since the last checkpoint.
+func CreateCheckpoint(ctx context.Context, db *gorm.DB, store storage.BlobStore, key ed25519.PrivateKey) (*Checkpoint, error) {
+	heads, err := CurrentHeads(db)
+	if err != nil {
+		return nil, err
+	}
+	last := models.AuditCheckpoint{}
+	if err := db.Order("created_at DESC").Limit(1).Find(&last).Error; err != nil {
+		return nil, err
+	}
+	if len(last.Document) > 0 {
+		previous := Checkpoint{}
+		if err := json.Unmarshal(last.Document, &previous); err == nil && reflect.DeepEqual(previous.Heads, heads) {
+			return nil, nil
+		}
+	}
+
+	checkpoint := Checkpoint{Format: CheckpointFormat, CreatedAt: time.Now().UTC().Truncate(time.Second), Heads: heads}
+	if err := checkpoint.Sign(key); err != nil {
+		return nil, err
+	}
+	document, err := json.MarshalIndent(checkpoint, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+
+	if store != nil {
+		if err := store.Put(ctx, CheckpointName(checkpoint.CreatedAt), bytes.NewReader(document)); err != nil {
+			return nil, err
+		}
+	}
+	row := models.AuditCheckpoint{ID: uuid.New(), CreatedAt: checkpoint.CreatedAt, Document: datatypes.JSON(document)}
+	if err := db.Create(&row).Error; err != nil {
+		return nil, err
+	}
+	return &checkpoint, nil
+}
+
+// LoadCheckpoint reads an exported checkpoint back from store.
+func LoadCheckpoint(ctx context.Context, store storage.BlobStore, name string) (Checkpoint, error) {
+	checkpoint := Checkpoint{}
+	r, err := store.Get(ctx, name)
+	if err != nil {
+		return checkpoint, err
+	}
+	defer r.Close()
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return checkpoint, err
+	}
+	if err := json.Unmarshal(data, &checkpoint); err != nil {
+		return checkpoint, fmt.Errorf("%s is not a checkpoint: %w", name, err)
+	}
+	return checkpoint, nil
+}
+
+// VerifyCheckpoint checks the signature of a checkpoint and that the event
+// at each of its heads is still in the log unchanged. Together with Verify
+// this shows every event up to the checkpoint is as it was.
+func VerifyCheckpoint(db *gorm.DB, checkpoint Checkpoint, key ed25519.PublicKey) ([]Break, error) {
+	if err := checkpoint.VerifySignature(key); err != nil {
+		return nil, err
+	}
+
+	breaks := []Break{}
+	for chainId, head := range checkpoint.Heads {
+		var userId *uuid.UUID
+		if chainId != AnonymousChain {
+			id, err := uuid.Parse(chainId)
+			if err != nil {
+				return nil, fmt.Errorf("invalid chain %q in checkpoint", chainId)
+			}
+			userId = &id
+		}
+
+		event := models.AuditEvent{}
+		err := chain(db, userId).Where("seq=?", head.Seq).Limit(1).Find(&event).Error
+		if err != nil {
+			return nil, err
+		}
+		problem := ""
+		switch {
+		case event.ID == uuid.Nil:
+			problem = "event from the checkpoint of " + checkpoint.CreatedAt.Format(time.RFC3339) + " is gone"
+		case event.Hash != head.Hash:
+			problem = "event differs from the checkpoint of " + checkpoint.CreatedAt.Format(time.RFC3339)
+		default:
+			continue
+		}
+		breaks = append(breaks, Break{Chain: chainId, Seq: head.Seq, Problem: problem})
+	}
+	return breaks, nil
+}
+
+// CheckpointJob returns the function the scheduler runs to take
+// checkpoints.
+func CheckpointJob(db *gorm.DB, store storage.BlobStore, key ed25519.PrivateKey) func() {
+	return func() {
+		checkpoint, err := CreateCheckpoint(context.Background(), db, store, key)
+		if err != nil {
+			log.Println("audit checkpoint failed:", err)
+			return
+		}
+		if checkpoint != nil {
+			log.Println("audit checkpoint taken for", len(checkpoint.Heads), "chains")
+		}
+	}
+}
@@ -0,0 +1,74 @@
+package audit
+
+import (
+	"fmt"
+
+	"github.com/google/uuid"
+	"goPass/models"
+	"gorm.io/gorm"
+)
+
+// Break is one place where the log doesn't add up.
+type Break struct {
+	Chain   string     `json:"chain"`
+	Seq     int64      `json:"seq"`
+	EventID *uuid.UUID `json:"eventId,omitempty"`
+	Problem string     `json:"problem"`
+}
+
+func (b Break) String() string {
+	if b.Chain == "" {
+		return b.Problem
+	}
+	return fmt.Sprintf("chain %s at %d: %s", b.Chain, b.Seq, b.Problem)
+}
+
+// Head is the last event of a chain.
+type Head struct {
+	Seq  int64  `json:"seq"`
+	Hash string `json:"hash"`
+}
+
+// Verify walks every chain from the start and recomputes each hash. An
+// edited event no longer matches its hash, a removed or inserted one breaks
+// the sequence or the link to its predecessor. Removing events from the end
+// of a chain leaves no trace in the chain itself, checkpoints cover that.
+func Verify(db *gorm.DB) (map[string]Head, []Break, error) {
+	heads := map[string]Head{}
+	breaks := []Break{}
+
+	rows, err := db.Model(&models.AuditEvent{}).Order("user_id NULLS FIRST, seq, id").Rows()
+	if err != nil {
+		return nil, nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		event := models.AuditEvent{}
+		if err := db.ScanRows(rows, &event); err != nil {
+			return nil, nil, err
+		}
+		chain := ChainID(event.UserID)
+		head := heads[chain]
+		report := func(problem string) {
+			id := event.ID
+			breaks = append(breaks, Break{Chain: chain, Seq: event.Seq, EventID: &id, Problem: problem})
+		}
+
+		switch {
+		case event.Seq == head.Seq:
+			report("duplicate position in chain")
+		case event.Seq != head.Seq+1:
+			report(fmt.Sprintf("events %d to %d are missing", head.Seq+1, event.Seq-1))
+		case event.PrevHash != head.Hash:
+			report("does not link to the previous event")
+		}
+		if Hash(event) != event.Hash {
+			report("event was modified after it was recorded")
+		}
+		if event.Seq > head.Seq {
+			heads[chain] = Head{Seq: event.Seq, Hash: event.Hash}
+		}
+	}
+	return heads, breaks, rows.Err()
+}
@@ -0,0 +1,386 @@
+// Package backup snapshots the goPass tables into an encrypted, gzip
+// compressed archive in a blob store and restores them again. Vault data is
+// already encrypted by the clients, the archive key additionally protects
+// accounts, password hashes and the plaintext parts of the vault.
+package backup
+
+import (
+	"bufio"
+	"compress/gzip"
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"log"
+	"strings"
+	"time"
+
+	"goPass/storage"
+	"gorm.io/gorm"
+)
+
+const (
+	Format    = "gopass-backup"
+	Version   = 2 // rows keyed by column, version 1 only had three tables
+	batchSize = 500
+)
+
+// Manifest closes every archive. Restores recount the rows of each table and
+// recompute their hash before trusting a backup.
+type Manifest struct {
+	Format    string              `json:"format"`
+	Version   int                 `json:"version"`
+	CreatedAt time.Time           `json:"createdAt"`
+	Tables    map[string]TableSum `json:"tables"`
+}
+
+type TableSum struct {
+	Rows   int64  `json:"rows"`
+	SHA256 string `json:"sha256"`
+}
+
+// record is one line of the archive: a row of a table, or the manifest as
+// the very last line.
+type record struct {
+	Table    string          `json:"table,omitempty"`
+	Row      json.RawMessage `json:"row,omitempty"`
+	Manifest *Manifest       `json:"manifest,omitempty"`
+}
+
+// table is dumped as whole rows keyed by column name, so every column is
+// kept whatever the Go models expose as JSON, and restored by letting
+// Postgres turn the same objects back into rows.
+type table struct {
+	name string
+	// immutable rows are only ever inserted, existing ones are kept
+	immutable bool
+}
+
+func (t table) dump(db *gorm.DB, emit func(row json.RawMessage) error) error {
+	rows, err := db.Raw("SELECT row_to_json(t)::text FROM " + quote(t.name) + " t").Rows()
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var row string
+		if err := rows.Scan(&row); err != nil {
+			return err
+		}
+		if err := emit(json.RawMessage(row)); err != nil {
+			return err
+		}
+	}
+	return rows.Err()
+}
+
+func (t table) load(tx *gorm.DB, rows []json.RawMessage) error {
+	columnTypes, err := tx.Migrator().ColumnTypes(t.name)
+	if err != nil {
+		return err
+	}
+	// only the columns the archive has, newer ones keep their defaults
+	present := map[string]json.RawMessage{}
+	if err := json.Unmarshal(rows[0], &present); err != nil {
+		return err
+	}
+	columns, keys, updates := []string{}, []string{}, []string{}
+	for _, ct := range columnTypes {
+		name := ct.Name()
+		if _, ok := present[name]; !ok {
+			continue
+		}
+		columns = append(columns, quote(name))
+		if pk, _ := ct.PrimaryKey(); pk {
+			keys = append(keys, quote(name))
+		} else {
+			updates = append(updates, quote(name)+"=EXCLUDED."+quote(name))
+		}
+	}
+	if len(keys) == 0 {
+		return fmt.Errorf("no primary key columns in %s", t.name)
+	}
+
+	conflict := "DO NOTHING"
+	if !t.immutable && len(updates) > 0 {
+		conflict = "DO UPDATE SET " + strings.Join(updates, ", ")
+	}
+	list := strings.Join(columns, ", ")
+	array, err := json.Marshal(rows)
+	if err != nil {
+		return err
+	}
+	return tx.Exec("INSERT INTO "+quote(t.name)+" ("+list+") SELECT "+list+
+		" FROM json_populate_recordset(NULL::"+quote(t.name)+", ?::json)"+
+		" ON CONFLICT ("+strings.Join(keys, ", ")+") "+conflict, string(array)).Error
+}
+
+func quote(name string) string {
+	return `"` + strings.ReplaceAll(name, `"`, `""`) + `"`
+}
+
+// tables lists what gets backed up, parents before children so a restore
+// never breaks a foreign key. Rate limit counters are left out, they only
+// matter for minutes, and schema_migrations is rebuilt by the migrations a
+// restore runs first.
+var tables = []table{
+	{name: "app_users"},
+	{name: "devices"},
+	{name: "organizations"},
+	{name: "memberships"},
+	{name: "collections"},
+	{name: "collection_members"},
+	{name: "folders"},
+	{name: "tags"},
+	{name: "vault_entries"},
+	{name: "vault_entry_tags"},
+	{name: "vault_entry_domains"},
+	{name: "vault_shares"},
+	{name: "attachments"},
+	{name: "attachment_chunks"},
+	{name: "emergency_accesses"},
+	{name: "sends"},
+	{name: "generator_policies"},
+	{name: "site_policies"},
+	{name: "known_logins"},
+	{name: "notification_preferences"},
+	{name: "audit_events", immutable: true},
+	{name: "audit_checkpoints", immutable: true},
+}
+
+// Name returns the blob key of a backup taken at t.
+func Name(t time.Time) string {
+	return "gopass-" + t.UTC().Format("20060102T150405Z") + ".bak"
+}
+
+// Create writes a new archive to the store and returns its name.
+func Create(ctx context.Context, db *gorm.DB, store storage.BlobStore, key []byte) (string, Manifest, error) {
+	manifest := Manifest{
+		Format:    Format,
+		Version:   Version,
+		CreatedAt: time.Now().UTC(),
+		Tables:    map[string]TableSum{},
+	}
+	name := Name(manifest.CreatedAt)
+
+	pr, pw := io.Pipe()
+	go func() {
+		pw.CloseWithError(write(pw, db.WithContext(ctx), key, &manifest))
+	}()
+	if err := store.Put(ctx, name, pr); err != nil {
+		pr.CloseWithError(err)
+		return "", Manifest{}, err
+	}
+	return name, manifest, nil
+}
+
+func write(w io.Writer, db *gorm.DB, key []byte, manifest *Manifest) error {
+	enc, err := newEncryptWriter(w, key)
+	if err != nil {
+		return err
+	}
+	zw := gzip.NewWriter(enc)
+	out := json.NewEncoder(zw)
+
+	// one repeatable read transaction, so the tables agree with each other
+	err = db.Transaction(func(tx *gorm.DB) error {
+		for _, t := range tables {
+			sum := newTableHash()
+			err := t.dump(tx, func(row json.RawMessage) error {
+				sum.add(row)
+				return out.Encode(record{Table: t.name, Row: row})
+			})
+			if err != nil {
+				return fmt.Errorf("dumping %s: %w", t.name, err)
+			}
+			manifest.Tables[t.name] = sum.result()
+		}
+		return nil
+	}, &sql.TxOptions{Isolation: sql.LevelRepeatableRead, ReadOnly: true})
+	if err != nil {
+		return err
+	}
+
+	if err := out.Encode(record{Manifest: manifest}); err != nil {
+		return err
+	}
+	if err := zw.Close(); err != nil {
+		return err
+	}
+	return enc.Close()
+}
+
+// Verify reads a whole archive and checks it against its manifest without
+// touching the database.
+func Verify(ctx context.Context, store storage.BlobStore, name string, key []byte) (Manifest, error) {
+	return read(ctx, store, name, key, nil)
+}
+
+// Restore verifies an archive and then upserts every row in one
+// transaction, rows that exist are overwritten with the backed up version.
+// Rows created after the backup are left alone.
+func Restore(ctx context.Context, db *gorm.DB, store storage.BlobStore, name string, key []byte) (Manifest, error) {
+	if _, err := Verify(ctx, store, name, key); err != nil {
+		return Manifest{}, err
+	}
+
+	var manifest Manifest
+	err := db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		loaders := map[string]func([]json.RawMessage) error{}
+		for _, t := range tables {
+			load := t.load
+			loaders[t.name] = func(rows []json.RawMessage) error { return load(tx, rows) }
+		}
+
+		m, err := read(ctx, store, name, key, loaders)
+		manifest = m
+		return err
+	})
+	return manifest, err
+}
+
+// read decodes an archive, feeding rows in batches to the loader of their
+// table when loaders is set, and fails unless the rows match the manifest.
+func read(ctx context.Context, store storage.BlobStore, name string, key []byte, loaders map[string]func([]json.RawMessage) error) (Manifest, error) {
+	rc, err := store.Get(ctx, name)
+	if err != nil {
+		return Manifest{}, err
+	}
+	defer rc.Close()
+
+	dec, err := newDecryptReader(rc, key)
+	if err != nil {
+		return Manifest{}, err
+	}
+	zr, err := gzip.NewReader(dec)
+	if err != nil {
+		return Manifest{}, ErrCorrupt
+	}
+	in := json.NewDecoder(bufio.NewReader(zr))
+
+	sums := map[string]*tableHash{}
+	pending := map[string][]json.RawMessage{}
+	flush := func(name string) error {
+		if loaders == nil || len(pending[name]) == 0 {
+			return nil
+		}
+		err := loaders[name](pending[name])
+		pending[name] = pending[name][:0]
+		return err
+	}
+
+	var manifest *Manifest
+	last := ""
+	for {
+		rec := record{}
+		err := in.Decode(&rec)
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return Manifest{}, err
+		}
+		if manifest != nil {
+			return Manifest{}, errors.New("data after the manifest")
+		}
+		if rec.Manifest != nil {
+			manifest = rec.Manifest
+			continue
+		}
+
+		if !knownTable(rec.Table) {
+			return Manifest{}, fmt.Errorf("unknown table %q", rec.Table)
+		}
+		if sums[rec.Table] == nil {
+			sums[rec.Table] = newTableHash()
+		}
+		sums[rec.Table].add(rec.Row)
+
+		if loaders != nil {
+			// tables come in order, a table is complete once the next starts
+			if rec.Table != last {
+				if err := flush(last); err != nil {
+					return Manifest{}, fmt.Errorf("restoring %s: %w", last, err)
+				}
+				last = rec.Table
+			}
+			pending[rec.Table] = append(pending[rec.Table], rec.Row)
+			if len(pending[rec.Table]) >= batchSize {
+				if err := flush(rec.Table); err != nil {
+					return Manifest{}, fmt.Errorf("restoring %s: %w", rec.Table, err)
+				}
+			}
+		}
+	}
+
+	if manifest == nil {
+		return Manifest{}, errors.New("backup has no manifest")
+	}
+	if manifest.Format != Format || manifest.Version != Version {
+		return Manifest{}, fmt.Errorf("unsupported backup format %s v%d", manifest.Format, manifest.Version)
+	}
+	for _, t := range tables {
+		sum := sums[t.name]
+		if sum == nil {
+			sum = newTableHash()
+		}
+		if sum.result() != manifest.Tables[t.name] {
+			return Manifest{}, fmt.Errorf("table %s does not match the manifest", t.name)
+		}
+	}
+	if err := flush(last); err != nil {
+		return Manifest{}, fmt.Errorf("restoring %s: %w", last, err)
+	}
+	return *manifest, nil
+}
+
+func knownTable(name string) bool {
+	for _, t := range tables {
+		if t.name == name {
+			return true
+		}
+	}
+	return false
+}
+
+// tableHash hashes the rows of a table in archive order, each prefixed by
+// its length so rows can't be split or merged without changing the sum.
+type tableHash struct {
+	rows int64
+	h    hash.Hash
+}
+
+func newTableHash() *tableHash {
+	return &tableHash{h: sha256.New()}
+}
+
+func (t *tableHash) add(row []byte) {
+	var size [8]byte
+	binary.BigEndian.PutUint64(size[:], uint64(len(row)))
+	t.h.Write(size[:])
+	t.h.Write(row)
+	t.rows++
+}
+
+func (t *tableHash) result() TableSum {
+	return TableSum{Rows: t.rows, SHA256: hex.EncodeToString(t.h.Sum(nil))}
+}
+
+// Job returns a function for jobs.Every that takes a backup and logs the
+// outcome.
+func Job(db *gorm.DB, store storage.BlobStore, key []byte) func() {
+	return func() {
+		name, manifest, err := Create(context.Background(), db, store, key)
+		if err != nil {
+			log.Println("backup failed:", err)
+			return
+		}
+		log.Println("backup written to", name, "with", manifest.Tables)
+	}
+}
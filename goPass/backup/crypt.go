@@ -0,0 +1,193 @@
+package backup
+
+import (
+	"bufio"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/binary"
+	"errors"
+	"io"
+)
+
+// Archives are encrypted as a sequence of AES-256-GCM sealed segments so
+// they can be written and read as a stream. Every segment has its own nonce,
+// made of a random per file prefix, the segment counter and a flag marking
+// the last segment, so segments can't be reordered, dropped or cut off
+// without the archive failing to open.
+//
+//	header:  "GOPASSBK" | version (1 byte) | nonce prefix (7 bytes)
+//	segment: ciphertext of up to segmentSize bytes | 16 byte tag
+const (
+	magic       = "GOPASSBK"
+	cryptoV1    = 1
+	prefixSize  = 7
+	headerSize  = len(magic) + 1 + prefixSize
+	segmentSize = 64 * 1024
+)
+
+var ErrCorrupt = errors.New("backup is corrupted or was encrypted with another key")
+
+type encryptWriter struct {
+	w       io.Writer
+	aead    cipher.AEAD
+	header  []byte
+	prefix  []byte
+	counter uint32
+	buf     []byte
+	closed  bool
+}
+
+func newAEAD(key []byte) (cipher.AEAD, error) {
+	if len(key) != 32 {
+		return nil, errors.New("backup key must be 32 bytes")
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+func newEncryptWriter(w io.Writer, key []byte) (*encryptWriter, error) {
+	aead, err := newAEAD(key)
+	if err != nil {
+		return nil, err
+	}
+	header := make([]byte, headerSize)
+	copy(header, magic)
+	header[len(magic)] = cryptoV1
+	if _, err := rand.Read(header[len(magic)+1:]); err != nil {
+		return nil, err
+	}
+	if _, err := w.Write(header); err != nil {
+		return nil, err
+	}
+	return &encryptWriter{
+		w:      w,
+		aead:   aead,
+		header: header,
+		prefix: header[len(magic)+1:],
+		buf:    make([]byte, 0, segmentSize),
+	}, nil
+}
+
+func (e *encryptWriter) Write(p []byte) (int, error) {
+	if e.closed {
+		return 0, errors.New("backup: write after close")
+	}
+	n := 0
+	for len(p) > 0 {
+		// only seal a full segment once more data shows up, the last one
+		// has to be sealed with the last flag set
+		if len(e.buf) == segmentSize {
+			if err := e.seal(false); err != nil {
+				return n, err
+			}
+		}
+		c := copy(e.buf[len(e.buf):segmentSize], p)
+		e.buf = e.buf[:len(e.buf)+c]
+		p = p[c:]
+		n += c
+	}
+	return n, nil
+}
+
+func (e *encryptWriter) Close() error {
+	if e.closed {
+		return nil
+	}
+	e.closed = true
+	return e.seal(true)
+}
+
+func (e *encryptWriter) seal(last bool) error {
+	out := e.aead.Seal(nil, segmentNonce(e.prefix, e.counter, last), e.buf, e.header)
+	e.counter++
+	e.buf = e.buf[:0]
+	_, err := e.w.Write(out)
+	return err
+}
+
+type decryptReader struct {
+	r      *bufio.Reader
+	aead   cipher.AEAD
+	header []byte
+	prefix []byte
+
+	counter uint32
+	plain   []byte
+	done    bool
+}
+
+func newDecryptReader(r io.Reader, key []byte) (*decryptReader, error) {
+	aead, err := newAEAD(key)
+	if err != nil {
+		return nil, err
+	}
+	header := make([]byte, headerSize)
+	if _, err := io.ReadFull(r, header); err != nil || string(header[:len(magic)]) != magic {
+		return nil, errors.New("not a goPass backup")
+	}
+	if header[len(magic)] != cryptoV1 {
+		return nil, errors.New("unsupported backup version")
+	}
+	return &decryptReader{
+		r:      bufio.NewReaderSize(r, segmentSize+aead.Overhead()+1),
+		aead:   aead,
+		header: header,
+		prefix: header[len(magic)+1:],
+	}, nil
+}
+
+func (d *decryptReader) Read(p []byte) (int, error) {
+	for len(d.plain) == 0 {
+		if d.done {
+			return 0, io.EOF
+		}
+		if err := d.open(); err != nil {
+			return 0, err
+		}
+	}
+	n := copy(p, d.plain)
+	d.plain = d.plain[n:]
+	return n, nil
+}
+
+func (d *decryptReader) open() error {
+	segment := make([]byte, segmentSize+d.aead.Overhead())
+	n, err := io.ReadFull(d.r, segment)
+	last := false
+	switch {
+	case err == io.ErrUnexpectedEOF:
+		last = true
+	case err == io.EOF:
+		// the writer always seals a last segment, even an empty one
+		return ErrCorrupt
+	case err != nil:
+		return err
+	default:
+		if _, err := d.r.Peek(1); err == io.EOF {
+			last = true
+		}
+	}
+
+	plain, err := d.aead.Open(segment[:0], segmentNonce(d.prefix, d.counter, last), segment[:n], d.header)
+	if err != nil {
+		return ErrCorrupt
+	}
+	d.counter++
+	d.plain = plain
+	d.done = last
+	return nil
+}
+
+func segmentNonce(prefix []byte, counter uint32, last bool) []byte {
+	nonce := make([]byte, 12)
+	copy(nonce, prefix)
+	binary.BigEndian.PutUint32(nonce[prefixSize:], counter)
+	if last {
+		nonce[11] = 1
+	}
+	return nonce
+}
@@ -0,0 +1,112 @@
+package breach
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+var (
+	ErrInvalidPrefix = errors.New("prefix must be 5 hex characters")
+	prefixPattern    = regexp.MustCompile(`^[0-9A-F]{5}$`)
+)
+
+const (
+	// Ranges are padded with fake zero count suffixes to at least
+	// minPaddedLines, and beyond that to a multiple of padStep, so the size
+	// of a response says little about which prefix was asked for.
+	minPaddedLines = 1024
+	padStep        = 256
+	maxCacheSize   = 4096
+)
+
+type cached struct {
+	lines   []string
+	expires time.Time
+}
+
+// Service answers range queries from a Source and keeps recent ranges in
+// memory, so popular prefixes don't hit the dataset or upstream each time.
+type Service struct {
+	source Source
+	ttl    time.Duration
+
+	mu    sync.Mutex
+	cache map[string]cached
+}
+
+func NewService(source Source, ttl time.Duration) *Service {
+	return &Service{source: source, ttl: ttl, cache: map[string]cached{}}
+}
+
+// Range returns the padded, sorted range for prefix as the body of a range
+// API response. Fake entries have a count of 0 and clients must ignore them.
+func (s *Service) Range(ctx context.Context, prefix string) (string, error) {
+	prefix = strings.ToUpper(prefix)
+	if !prefixPattern.MatchString(prefix) {
+		return "", ErrInvalidPrefix
+	}
+
+	lines, err := s.lookup(ctx, prefix)
+	if err != nil {
+		return "", err
+	}
+	return strings.Join(pad(lines), "\r\n"), nil
+}
+
+func (s *Service) lookup(ctx context.Context, prefix string) ([]string, error) {
+	now := time.Now()
+	s.mu.Lock()
+	entry, ok := s.cache[prefix]
+	s.mu.Unlock()
+	if ok && now.Before(entry.expires) {
+		return entry.lines, nil
+	}
+
+	lines, err := s.source.Range(ctx, prefix)
+	if err != nil {
+		return nil, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if len(s.cache) >= maxCacheSize {
+		for key, entry := range s.cache {
+			if now.After(entry.expires) {
+				delete(s.cache, key)
+			}
+		}
+		// still full of live ranges, drop arbitrary ones
+		for key := range s.cache {
+			if len(s.cache) < maxCacheSize {
+				break
+			}
+			delete(s.cache, key)
+		}
+	}
+	s.cache[prefix] = cached{lines: lines, expires: now.Add(s.ttl)}
+	return lines, nil
+}
+
+func pad(lines []string) []string {
+	target := minPaddedLines
+	if len(lines) > target {
+		target = (len(lines) + padStep - 1) / padStep * padStep
+	}
+
+	padded := make([]string, len(lines), target)
+	copy(padded, lines)
+	suffix := make([]byte, 18)
+	for len(padded) < target {
+		rand.Read(suffix)
+		padded = append(padded, strings.ToUpper(hex.EncodeToString(suffix)[:35])+":0")
+	}
+	sort.Strings(padded)
+	return padded
+}
@@ -0,0 +1,168 @@
+// Package breach answers k-anonymity range queries for breached passwords:
+// given the first five hex characters of a password's SHA-1 it returns the
+// suffixes of every known breached hash with that prefix, in the format of
+// the Pwned Passwords range API. Clients hash and compare locally, neither
+// this server nor the upstream API ever learn which password was checked.
+package breach
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// Source returns the "SUFFIX:COUNT" lines for an upper case, five character
+// hex prefix.
+type Source interface {
+	Range(ctx context.Context, prefix string) ([]string, error)
+}
+
+// DirSource reads one file per prefix, e.g. 5BAA6.txt, the layout written by
+// the official haveibeenpwned-downloader.
+type DirSource struct {
+	Dir string
+}
+
+func (s DirSource) Range(ctx context.Context, prefix string) ([]string, error) {
+	f, err := os.Open(filepath.Join(s.Dir, prefix+".txt"))
+	if errors.Is(err, os.ErrNotExist) {
+		return []string{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return readLines(f, "")
+}
+
+// FileSource binary searches a single file of "HASH:COUNT" lines sorted by
+// hash, like the "ordered by hash" Pwned Passwords download.
+type FileSource struct {
+	Path string
+}
+
+// scanWindow is how close the binary search gets before reading lines
+// sequentially.
+const scanWindow = 4096
+
+func (s FileSource) Range(ctx context.Context, prefix string) ([]string, error) {
+	f, err := os.Open(s.Path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		return nil, err
+	}
+
+	// The first matching line always starts after lo, or at 0.
+	lo, hi := int64(0), info.Size()
+	for hi-lo > scanWindow {
+		mid := lo + (hi-lo)/2
+		line, err := lineAfter(f, mid)
+		if err != nil {
+			return nil, err
+		}
+		if line == "" || strings.ToUpper(line[:min(len(line), 5)]) >= prefix {
+			hi = mid
+		} else {
+			lo = mid
+		}
+	}
+
+	r := bufio.NewReader(io.NewSectionReader(f, lo, info.Size()-lo))
+	if lo > 0 {
+		// lo is inside a line that sorts before the prefix
+		if _, err := r.ReadString('\n'); err != nil {
+			return []string{}, nil
+		}
+	}
+	return readLines(r, prefix)
+}
+
+// lineAfter returns the first whole line that starts after offset, or ""
+// at the end of the file.
+func lineAfter(f *os.File, offset int64) (string, error) {
+	r := bufio.NewReader(io.NewSectionReader(f, offset, scanWindow*2))
+	if _, err := r.ReadString('\n'); err != nil {
+		return "", nil
+	}
+	line, err := r.ReadString('\n')
+	if err != nil && err != io.EOF {
+		return "", err
+	}
+	return strings.TrimRight(line, "\r\n"), nil
+}
+
+// readLines collects "SUFFIX:COUNT" lines. With a prefix set the lines hold
+// full hashes: lines before the prefix are skipped, the prefix is cut off
+// and reading stops at the first line past it.
+func readLines(r io.Reader, prefix string) ([]string, error) {
+	lines := []string{}
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+		if prefix != "" {
+			if len(line) < 5 {
+				continue
+			}
+			head := strings.ToUpper(line[:5])
+			if head < prefix {
+				continue
+			}
+			if head > prefix {
+				break
+			}
+			line = line[5:]
+		}
+		if !strings.HasSuffix(line, ":0") {
+			lines = append(lines, strings.ToUpper(line))
+		}
+	}
+	return lines, scanner.Err()
+}
+
+// RemoteSource asks an upstream range API, by default the public Pwned
+// Passwords one. Only the prefix leaves the server.
+type RemoteSource struct {
+	BaseURL string
+	Client  *http.Client
+}
+
+func NewRemoteSource(baseURL string) *RemoteSource {
+	if baseURL == "" {
+		baseURL = "https://api.pwnedpasswords.com"
+	}
+	return &RemoteSource{
+		BaseURL: strings.TrimRight(baseURL, "/"),
+		Client:  &http.Client{Timeout: 10 * time.Second},
+	}
+}
+
+func (s *RemoteSource) Range(ctx context.Context, prefix string) ([]string, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, s.BaseURL+"/range/"+prefix, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("User-Agent", "goPass")
+	res, err := s.Client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("range api returned %s", res.Status)
+	}
+	return readLines(io.LimitReader(res.Body, 1<<20), "")
+}
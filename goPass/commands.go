@@ -0,0 +1,138 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+
+	"goPass/audit"
+	"goPass/backup"
+	"goPass/config"
+	"goPass/models"
+)
+
+// runCommand runs one of the maintenance commands instead of the server:
+//
+//	./main backup                        take a backup now
+//	./main backup-verify <name>          check a backup against its manifest
+//	./main backup-restore <name>         verify a backup, then restore it
+//	./main audit-verify [checkpoint...]  check the audit log's hash chains
+//	./main audit-checkpoint              sign and export a checkpoint now
+func runCommand(args []string) {
+	config.ConnectDB()
+	ctx := context.Background()
+
+	switch args[0] {
+	case "backup":
+		requireBackups()
+		name, manifest, err := backup.Create(ctx, config.DB, config.Backups, config.BackupKey)
+		if err != nil {
+			log.Fatal("backup failed: ", err)
+		}
+		log.Println("backup written to", name, "with", manifest.Tables)
+	case "backup-verify":
+		if len(args) != 2 {
+			log.Fatal("usage: backup-verify <name>")
+		}
+		requireBackups()
+		manifest, err := backup.Verify(ctx, config.Backups, args[1], config.BackupKey)
+		if err != nil {
+			log.Fatal("backup is not valid: ", err)
+		}
+		log.Println("backup from", manifest.CreatedAt, "is valid with", manifest.Tables)
+	case "backup-restore":
+		if len(args) != 2 {
+			log.Fatal("usage: backup-restore <name>")
+		}
+		requireBackups()
+		migrate()
+		manifest, err := backup.Restore(ctx, config.DB, config.Backups, args[1], config.BackupKey)
+		if err != nil {
+			log.Fatal("restore failed, nothing was changed: ", err)
+		}
+		log.Println("restored backup from", manifest.CreatedAt, "with", manifest.Tables)
+	case "audit-verify":
+		verifyAuditLog(ctx, args[1:])
+	case "audit-checkpoint":
+		config.ConnectAuditSigner()
+		if config.AuditSigningKey == nil {
+			log.Fatal("audit checkpoints are not configured, set AUDIT_SIGNING_KEY")
+		}
+		checkpoint, err := audit.CreateCheckpoint(ctx, config.DB, config.AuditCheckpoints, config.AuditSigningKey)
+		if err != nil {
+			log.Fatal("checkpoint failed: ", err)
+		}
+		if checkpoint == nil {
+			log.Println("nothing was recorded since the last checkpoint")
+			return
+		}
+		log.Println("checkpoint", audit.CheckpointName(checkpoint.CreatedAt), "taken for", len(checkpoint.Heads), "chains")
+	default:
+		log.Fatal("unknown command ", args[0])
+	}
+}
+
+func requireBackups() {
+	config.ConnectBackupStore()
+	if config.Backups == nil {
+		log.Fatal("backups are not configured, set BACKUP_KEY")
+	}
+}
+
+// verifyAuditLog walks every chain, then checks it against the checkpoints
+// in the database and the exported ones named on the command line. The
+// exported copies are the ones to trust, the database ones could have been
+// removed along with the events they cover.
+func verifyAuditLog(ctx context.Context, names []string) {
+	config.ConnectAuditSigner()
+
+	heads, breaks, err := audit.Verify(config.DB)
+	if err != nil {
+		log.Fatal("audit verification failed: ", err)
+	}
+
+	checkpoints := []audit.Checkpoint{}
+	if config.AuditPublicKey != nil {
+		rows := []models.AuditCheckpoint{}
+		if err := config.DB.Order("created_at").Find(&rows).Error; err != nil {
+			log.Fatal("failed to load checkpoints: ", err)
+		}
+		for _, row := range rows {
+			checkpoint := audit.Checkpoint{}
+			if err := json.Unmarshal(row.Document, &checkpoint); err != nil {
+				log.Println("checkpoint", row.ID, "is unreadable:", err)
+				continue
+			}
+			checkpoints = append(checkpoints, checkpoint)
+		}
+	} else {
+		log.Println("no AUDIT_PUBLIC_KEY or AUDIT_SIGNING_KEY, skipping checkpoints")
+	}
+	for _, name := range names {
+		if config.AuditCheckpoints == nil || config.AuditPublicKey == nil {
+			log.Fatal("exported checkpoints need AUDIT_CHECKPOINT_STORE and a key to verify with")
+		}
+		checkpoint, err := audit.LoadCheckpoint(ctx, config.AuditCheckpoints, name)
+		if err != nil {
+			log.Fatal("failed to load checkpoint ", name, ": ", err)
+		}
+		checkpoints = append(checkpoints, checkpoint)
+	}
+
+	for _, checkpoint := range checkpoints {
+		found, err := audit.VerifyCheckpoint(config.DB, checkpoint, config.AuditPublicKey)
+		if err != nil {
+			breaks = append(breaks, audit.Break{Problem: "checkpoint of " + checkpoint.CreatedAt.String() + ": " + err.Error()})
+			continue
+		}
+		breaks = append(breaks, found...)
+	}
+
+	for _, b := range breaks {
+		log.Println(b)
+	}
+	if len(breaks) > 0 {
+		log.Fatal("audit log has ", len(breaks), " problems")
+	}
+	log.Println("audit log is intact:", len(heads), "chains,", len(checkpoints), "checkpoints")
+}
@@ -0,0 +1,80 @@
+package config
+
+import (
+	"crypto/ed25519"
+	"encoding/base64"
+	"log"
+	"os"
+	"time"
+
+	"goPass/storage"
+)
+
+var (
+	AuditSigningKey         ed25519.PrivateKey
+	AuditPublicKey          ed25519.PublicKey
+	AuditCheckpoints        storage.BlobStore
+	AuditCheckpointInterval = time.Hour
+)
+
+// ConnectAuditSigner sets up signed audit checkpoints. They stay off unless
+// AUDIT_SIGNING_KEY holds a base64 encoded 32 byte Ed25519 seed. Checkpoints
+// are exported to AUDIT_CHECKPOINT_STORE, which should be somewhere the
+// database's administrators can't write, e.g. a bucket with object lock.
+// AUDIT_PUBLIC_KEY lets a verifier check them without the signing key.
+func ConnectAuditSigner() {
+	if raw := os.Getenv("AUDIT_PUBLIC_KEY"); raw != "" {
+		key, err := base64.StdEncoding.DecodeString(raw)
+		if err != nil || len(key) != ed25519.PublicKeySize {
+			log.Fatal("AUDIT_PUBLIC_KEY must be a base64 encoded Ed25519 public key")
+		}
+		AuditPublicKey = key
+	}
+
+	raw := os.Getenv("AUDIT_SIGNING_KEY")
+	if raw == "" {
+		return
+	}
+	seed, err := base64.StdEncoding.DecodeString(raw)
+	if err != nil || len(seed) != ed25519.SeedSize {
+		log.Fatal("AUDIT_SIGNING_KEY must be a base64 encoded 32 byte key")
+	}
+	AuditSigningKey = ed25519.NewKeyFromSeed(seed)
+	if AuditPublicKey == nil {
+		AuditPublicKey = AuditSigningKey.Public().(ed25519.PublicKey)
+	}
+
+	if interval := os.Getenv("AUDIT_CHECKPOINT_INTERVAL"); interval != "" {
+		AuditCheckpointInterval, err = time.ParseDuration(interval)
+		if err != nil || AuditCheckpointInterval < time.Minute {
+			log.Fatal("AUDIT_CHECKPOINT_INTERVAL must be a duration of at least 1m, e.g. 1h")
+		}
+	}
+
+	switch os.Getenv("AUDIT_CHECKPOINT_STORE") {
+	case "s3":
+		bucket := os.Getenv("AUDIT_S3_BUCKET")
+		if bucket == "" {
+			bucket = os.Getenv("S3_BUCKET")
+		}
+		store := storage.NewS3Store(
+			os.Getenv("S3_ENDPOINT"),
+			bucket,
+			os.Getenv("S3_REGION"),
+			os.Getenv("S3_ACCESS_KEY"),
+			os.Getenv("S3_SECRET_KEY"),
+		)
+		store.Prefix = "audit"
+		AuditCheckpoints = store
+	case "local":
+		dir := os.Getenv("AUDIT_CHECKPOINT_DIR")
+		if dir == "" {
+			dir = "./data/audit"
+		}
+		store, err := storage.NewLocalStore(dir)
+		if err != nil {
+			log.Fatal("Failed to open audit checkpoint store:", err)
+		}
+		AuditCheckpoints = store
+	}
+}
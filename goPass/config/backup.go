@@ -0,0 +1,65 @@
+package config
+
+import (
+	"encoding/base64"
+	"log"
+	"os"
+	"time"
+
+	"goPass/storage"
+)
+
+var (
+	Backups        storage.BlobStore
+	BackupKey      []byte
+	BackupInterval = 24 * time.Hour
+)
+
+// ConnectBackupStore sets up where database backups go. Backups stay off
+// unless BACKUP_KEY holds a base64 encoded 32 byte key. Keep that key
+// somewhere other than the backups, without it they can't be restored.
+func ConnectBackupStore() {
+	raw := os.Getenv("BACKUP_KEY")
+	if raw == "" {
+		return
+	}
+	key, err := base64.StdEncoding.DecodeString(raw)
+	if err != nil || len(key) != 32 {
+		log.Fatal("BACKUP_KEY must be a base64 encoded 32 byte key")
+	}
+
+	if interval := os.Getenv("BACKUP_INTERVAL"); interval != "" {
+		BackupInterval, err = time.ParseDuration(interval)
+		if err != nil || BackupInterval < time.Minute {
+			log.Fatal("BACKUP_INTERVAL must be a duration of at least 1m, e.g. 24h")
+		}
+	}
+
+	switch os.Getenv("BACKUP_STORE") {
+	case "s3":
+		bucket := os.Getenv("BACKUP_S3_BUCKET")
+		if bucket == "" {
+			bucket = os.Getenv("S3_BUCKET")
+		}
+		store := storage.NewS3Store(
+			os.Getenv("S3_ENDPOINT"),
+			bucket,
+			os.Getenv("S3_REGION"),
+			os.Getenv("S3_ACCESS_KEY"),
+			os.Getenv("S3_SECRET_KEY"),
+		)
+		store.Prefix = "backups"
+		Backups = store
+	default:
+		dir := os.Getenv("BACKUP_DIR")
+		if dir == "" {
+			dir = "./data/backups"
+		}
+		store, err := storage.NewLocalStore(dir)
+		if err != nil {
+			log.Fatal("Failed to open backup store:", err)
+		}
+		Backups = store
+	}
+	BackupKey = key
+}
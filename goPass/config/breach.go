@@ -0,0 +1,45 @@
+package config
+
+import (
+	"log"
+	"os"
+	"time"
+
+	"goPass/breach"
+)
+
+var Breach *breach.Service
+
+// ConnectBreachSource picks where breached password ranges come from.
+// BREACH_DATASET points at a local download, either a directory of per
+// prefix files or one file sorted by hash, for servers without internet
+// access. Otherwise ranges are fetched from BREACH_API_URL, the public Pwned
+// Passwords API by default, unless BREACH_OFFLINE is set.
+func ConnectBreachSource() {
+	ttl := 24 * time.Hour
+	if v := os.Getenv("BREACH_CACHE_TTL"); v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil {
+			log.Fatal("BREACH_CACHE_TTL must be a duration, e.g. 24h")
+		}
+		ttl = d
+	}
+
+	var source breach.Source
+	if dataset := os.Getenv("BREACH_DATASET"); dataset != "" {
+		info, err := os.Stat(dataset)
+		if err != nil {
+			log.Fatal("Failed to open breach dataset:", err)
+		}
+		if info.IsDir() {
+			source = breach.DirSource{Dir: dataset}
+		} else {
+			source = breach.FileSource{Path: dataset}
+		}
+	} else if os.Getenv("BREACH_OFFLINE") == "true" {
+		return
+	} else {
+		source = breach.NewRemoteSource(os.Getenv("BREACH_API_URL"))
+	}
+	Breach = breach.NewService(source, ttl)
+}
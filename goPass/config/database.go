@@ -11,19 +11,22 @@ import (
 
 var DB *gorm.DB
 
-func ConnectDB() {
+// databaseDSN is the connection string for the database in DB_*.
+func databaseDSN() string {
 	dbHost := os.Getenv("DB_HOST")
 	dbPort := os.Getenv("DB_PORT")
 	dbUser := os.Getenv("DB_USER")
 	dbPass := os.Getenv("DB_PASS")
 	dbName := os.Getenv("DB_NAME")
 
-	dsn := fmt.Sprintf(
+	return fmt.Sprintf(
 		"host=%s user=%s password=%s dbname=%s port=%s sslmode=disable",
 		dbHost, dbUser, dbPass, dbName, dbPort,
 	)
+}
 
-	database, err := gorm.Open(postgres.Open(dsn), &gorm.Config{})
+func ConnectDB() {
+	database, err := gorm.Open(postgres.Open(databaseDSN()), &gorm.Config{})
 	if err != nil {
 		log.Fatal("Failed to connect to database:", err)
 	}
@@ -0,0 +1,46 @@
+package config
+
+import (
+	"log"
+	"os"
+	"time"
+
+	"goPass/icons"
+)
+
+var Icons *icons.Service
+
+// ConnectIconService sets up website icons. ICON_FIXTURES points at a
+// directory of <domain>.<ext> files to serve instead of fetching from the
+// sites, for offline servers and tests. Without it icons are fetched unless
+// ICON_OFFLINE is set. Rendered icons are cached in ICON_DIR for
+// ICON_CACHE_TTL.
+func ConnectIconService() {
+	ttl := 7 * 24 * time.Hour
+	if v := os.Getenv("ICON_CACHE_TTL"); v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil {
+			log.Fatal("ICON_CACHE_TTL must be a duration, e.g. 168h")
+		}
+		ttl = d
+	}
+
+	var source icons.Source
+	if fixtures := os.Getenv("ICON_FIXTURES"); fixtures != "" {
+		source = icons.DirSource{Dir: fixtures}
+	} else if os.Getenv("ICON_OFFLINE") == "true" {
+		return
+	} else {
+		source = icons.NewRemoteSource()
+	}
+
+	dir := os.Getenv("ICON_DIR")
+	if dir == "" {
+		dir = "./data/icons"
+	}
+	service, err := icons.NewService(source, dir, ttl)
+	if err != nil {
+		log.Fatal("Failed to open icon cache:", err)
+	}
+	Icons = service
+}
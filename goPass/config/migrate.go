@@ -0,0 +1,159 @@
+package config
+
+import (
+	"log"
+	"time"
+
+	"goPass/audit"
+	"goPass/models"
+	"gorm.io/datatypes"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+type dataMigration struct {
+	ID  string
+	Run func(tx *gorm.DB) error
+}
+
+// dataMigrations reshape existing rows after AutoMigrate has updated the
+// schema. Append new ones at the end, never edit one that has shipped.
+var dataMigrations = []dataMigration{
+	{ID: "2026-01-metadata-to-custom-fields", Run: migrateMetaDataToCustomFields},
+	{ID: "2026-10-audit-events-append-only", Run: protectAuditEvents},
+	{ID: "2026-10-audit-event-chain", Run: chainAuditEvents},
+	{ID: "2026-10-attachment-chunks-stored", Run: markChunksStored},
+	{ID: "2026-10-plain-uri-index", Run: reindexURIs},
+}
+
+func RunMigrations() {
+	if err := DB.AutoMigrate(&models.SchemaMigration{}); err != nil {
+		log.Fatal("Migration failed:", err)
+	}
+
+	for _, m := range dataMigrations {
+		var count int64
+		DB.Model(&models.SchemaMigration{}).Where("id=?", m.ID).Count(&count)
+		if count > 0 {
+			continue
+		}
+
+		err := DB.Transaction(func(tx *gorm.DB) error {
+			if err := m.Run(tx); err != nil {
+				return err
+			}
+			return tx.Create(&models.SchemaMigration{ID: m.ID, AppliedAt: time.Now()}).Error
+		})
+		if err != nil {
+			log.Fatal("Data migration ", m.ID, " failed:", err)
+		}
+		log.Println("applied data migration", m.ID)
+	}
+}
+
+// migrateMetaDataToCustomFields moves the old free-form MetaData object of
+// every entry into typed custom fields. Entries whose metadata doesn't fit
+// the new limits are left alone and logged so nothing is silently dropped.
+func migrateMetaDataToCustomFields(tx *gorm.DB) error {
+	entries := []models.VaultEntry{}
+	return tx.Select("id", "meta_data").
+		Where("meta_data IS NOT NULL AND meta_data <> '{}'::jsonb").
+		Where("custom_fields IS NULL OR custom_fields = '[]'::jsonb").
+		FindInBatches(&entries, 200, func(batch *gorm.DB, _ int) error {
+			for _, entry := range entries {
+				fields, err := models.CustomFieldsFromMetaData(entry.MetaData)
+				if err == nil {
+					err = models.ValidateCustomFields(fields)
+				}
+				if err != nil {
+					log.Println("skipping metadata of vault entry", entry.ID, ":", err)
+					continue
+				}
+
+				if err := tx.Model(&models.VaultEntry{}).Where("id=?", entry.ID).
+					UpdateColumns(map[string]interface{}{
+						"custom_fields": datatypes.NewJSONSlice(fields),
+						"meta_data":     datatypes.JSON("{}"),
+					}).Error; err != nil {
+					return err
+				}
+			}
+			return nil
+		}).Error
+}
+
+// protectAuditEvents makes the database itself refuse to change or remove
+// audit events, so a bug in the API can't rewrite history.
+func protectAuditEvents(tx *gorm.DB) error {
+	return tx.Exec(`
+CREATE OR REPLACE FUNCTION audit_events_append_only() RETURNS trigger AS $$
+BEGIN
+	RAISE EXCEPTION 'audit_events is append-only';
+END;
+$$ LANGUAGE plpgsql;
+
+DROP TRIGGER IF EXISTS audit_events_append_only ON audit_events;
+CREATE TRIGGER audit_events_append_only BEFORE UPDATE OR DELETE ON audit_events
+	FOR EACH ROW EXECUTE FUNCTION audit_events_append_only();`).Error
+}
+
+// chainAuditEvents links the events recorded before the log was hash
+// chained, oldest first. The append-only trigger is lifted for this
+// transaction only.
+func chainAuditEvents(tx *gorm.DB) error {
+	if err := tx.Exec("ALTER TABLE audit_events DISABLE TRIGGER audit_events_append_only").Error; err != nil {
+		return err
+	}
+
+	heads := map[string]models.AuditEvent{}
+	events := []models.AuditEvent{}
+	if err := tx.Where("seq=0").Order("created_at, id").Find(&events).Error; err != nil {
+		return err
+	}
+	for _, event := range events {
+		chain := audit.ChainID(event.UserID)
+		event.CreatedAt = event.CreatedAt.UTC()
+		event.Seq = heads[chain].Seq + 1
+		event.PrevHash = heads[chain].Hash
+		event.Hash = audit.Hash(event)
+		if err := tx.Model(&models.AuditEvent{}).Where("id=?", event.ID).
+			UpdateColumns(map[string]interface{}{
+				"seq":       event.Seq,
+				"prev_hash": event.PrevHash,
+				"hash":      event.Hash,
+			}).Error; err != nil {
+			return err
+		}
+		heads[chain] = event
+	}
+
+	return tx.Exec("ALTER TABLE audit_events ENABLE TRIGGER audit_events_append_only").Error
+}
+
+// markChunksStored flags the chunks recorded before the flag existed. Back
+// then a chunk row was only kept once its blob was stored.
+func markChunksStored(tx *gorm.DB) error {
+	return tx.Model(&models.AttachmentChunk{}).Where("stored=?", false).Update("stored", true).Error
+}
+
+// reindexURIs rebuilds the domain index, whose buckets used to be stored as
+// SHA-256 hashes and are now kept as they are.
+func reindexURIs(tx *gorm.DB) error {
+	if err := tx.Where("1 = 1").Delete(&models.VaultEntryDomain{}).Error; err != nil {
+		return err
+	}
+	entries := []models.VaultEntry{}
+	return tx.Select("id", "uris").Where("deleted=?", false).
+		FindInBatches(&entries, 200, func(batch *gorm.DB, _ int) error {
+			rows := []models.VaultEntryDomain{}
+			for _, entry := range entries {
+				for _, uri := range entry.URIs {
+					rows = append(rows, models.VaultEntryDomain{VaultEntryID: entry.ID, Bucket: uri.IndexKey()})
+				}
+			}
+			if len(rows) == 0 {
+				return nil
+			}
+			return tx.Omit(clause.Associations).Clauses(clause.OnConflict{DoNothing: true}).Create(&rows).Error
+		}).Error
+}
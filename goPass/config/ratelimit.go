@@ -0,0 +1,35 @@
+package config
+
+import (
+	"os"
+	"strings"
+
+	"goPass/ratelimit"
+)
+
+var (
+	Limiter *ratelimit.Limiter
+	// PublicURL is where clients reach the API, for links in mails.
+	PublicURL string
+)
+
+// ConnectRateLimiter sets up the login and token refresh limits. Counters
+// are kept in memory unless RATE_LIMIT_STORE=postgres, which several
+// instances need to share them. Unlock links in lockout mails point at
+// PUBLIC_URL.
+func ConnectRateLimiter() {
+	var store ratelimit.Store = ratelimit.NewMemoryStore()
+	if os.Getenv("RATE_LIMIT_STORE") == "postgres" {
+		store = ratelimit.PostgresStore{DB: DB}
+	}
+	Limiter = ratelimit.NewLimiter(store)
+
+	PublicURL = strings.TrimSuffix(os.Getenv("PUBLIC_URL"), "/")
+	if PublicURL == "" {
+		port := os.Getenv("PORT")
+		if port == "" {
+			port = "8080"
+		}
+		PublicURL = "http://localhost:" + port
+	}
+}
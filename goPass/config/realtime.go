@@ -0,0 +1,25 @@
+package config
+
+import (
+	"log"
+	"os"
+
+	"goPass/realtime"
+)
+
+var Changes realtime.Broker
+
+// ConnectRealtime sets up the pub/sub behind the change streams. One
+// instance can keep it in memory, with several REALTIME_BACKEND=postgres
+// shares changes between them through the database.
+func ConnectRealtime() {
+	if os.Getenv("REALTIME_BACKEND") != "postgres" {
+		Changes = realtime.NewMemory()
+		return
+	}
+	broker, err := realtime.NewPostgres(DB, databaseDSN())
+	if err != nil {
+		log.Fatal("Failed to listen for changes:", err)
+	}
+	Changes = broker
+}
@@ -0,0 +1,33 @@
+package config
+
+import (
+	"log"
+	"os"
+
+	"goPass/storage"
+)
+
+var Blobs storage.BlobStore
+
+func ConnectBlobStore() {
+	switch os.Getenv("BLOB_STORE") {
+	case "s3":
+		Blobs = storage.NewS3Store(
+			os.Getenv("S3_ENDPOINT"),
+			os.Getenv("S3_BUCKET"),
+			os.Getenv("S3_REGION"),
+			os.Getenv("S3_ACCESS_KEY"),
+			os.Getenv("S3_SECRET_KEY"),
+		)
+	default:
+		dir := os.Getenv("BLOB_DIR")
+		if dir == "" {
+			dir = "./data/blobs"
+		}
+		store, err := storage.NewLocalStore(dir)
+		if err != nil {
+			log.Fatal("Failed to open blob store:", err)
+		}
+		Blobs = store
+	}
+}
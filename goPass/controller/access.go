@@ -0,0 +1,103 @@
+package controller
+
+import (
+	"github.com/google/uuid"
+	"goPass/config"
+	"goPass/models"
+	"gorm.io/gorm"
+)
+
+// Vault entries are either personal (UserID set, no collection) or belong to
+// an organization collection, in which case UserID only records who created
+// them. Every vault query goes through these helpers instead of filtering on
+// user_id directly.
+
+// collectionIDs selects the collections a user can reach. Owners and admins
+// reach every collection of their organization, members only the ones they
+// were added to. With write set, read-only collection grants are skipped.
+func collectionIDs(userId uuid.UUID, write bool) *gorm.DB {
+	grants := config.DB.Model(&models.CollectionMember{}).Select("collection_id").Where("user_id=?", userId)
+	if write {
+		grants = grants.Where("read_only=?", false)
+	}
+
+	return config.DB.Model(&models.Collection{}).Select("collections.id").
+		Joins("JOIN memberships ON memberships.organization_id = collections.organization_id").
+		Where("memberships.user_id=? AND memberships.status=?", userId, models.MembershipConfirmed).
+		Where("(memberships.role IN ? OR collections.id IN (?))", []string{models.RoleOwner, models.RoleAdmin}, grants)
+}
+
+// personalEntries limits a query to the user's own, non collection entries.
+// Folders, tags, favorites and shares only make sense on those.
+func personalEntries(userId uuid.UUID) func(*gorm.DB) *gorm.DB {
+	return func(db *gorm.DB) *gorm.DB {
+		return db.Where("vault_entries.user_id=? AND vault_entries.collection_id IS NULL", userId)
+	}
+}
+
+// acceptedShares selects the entries shared with the user that they
+// accepted, restricted to the given permissions when any are passed.
+func acceptedShares(userId uuid.UUID, permissions ...string) *gorm.DB {
+	shared := config.DB.Model(&models.VaultShare{}).Select("vault_entry_id").
+		Where("recipient_id=? AND status=?", userId, models.ShareStatusAccepted)
+	if len(permissions) > 0 {
+		shared = shared.Where("permission IN ?", permissions)
+	}
+	return shared
+}
+
+// readableEntries limits a query to personal entries, entries in any
+// collection the user can reach and entries shared with them.
+func readableEntries(userId uuid.UUID) func(*gorm.DB) *gorm.DB {
+	return func(db *gorm.DB) *gorm.DB {
+		return db.Where("((vault_entries.user_id=? AND vault_entries.collection_id IS NULL) OR vault_entries.collection_id IN (?) OR vault_entries.id IN (?))",
+			userId, collectionIDs(userId, false), acceptedShares(userId))
+	}
+}
+
+// manageableEntries limits a query to entries the user may change or
+// delete: personal ones and those in collections they can write to.
+func manageableEntries(userId uuid.UUID) func(*gorm.DB) *gorm.DB {
+	return func(db *gorm.DB) *gorm.DB {
+		return db.Where("((vault_entries.user_id=? AND vault_entries.collection_id IS NULL) OR vault_entries.collection_id IN (?))",
+			userId, collectionIDs(userId, true))
+	}
+}
+
+// writableEntries limits a query to entries the user may edit: the
+// manageable ones plus those shared with them with edit permission. Only
+// the owner side can delete a shared entry, so deletes stay on
+// manageableEntries.
+func writableEntries(userId uuid.UUID) func(*gorm.DB) *gorm.DB {
+	return func(db *gorm.DB) *gorm.DB {
+		return db.Where("((vault_entries.user_id=? AND vault_entries.collection_id IS NULL) OR vault_entries.collection_id IN (?) OR vault_entries.id IN (?))",
+			userId, collectionIDs(userId, true), acceptedShares(userId, models.SharePermissionEdit))
+	}
+}
+
+// loadWritableEntry returns a live entry the user is allowed to edit.
+func loadWritableEntry(userId, entryId uuid.UUID) (models.VaultEntry, error) {
+	entry := models.VaultEntry{}
+	err := config.DB.Scopes(writableEntries(userId)).
+		Where("vault_entries.id=? AND vault_entries.deleted=?", entryId, false).
+		First(&entry).Error
+	return entry, err
+}
+
+// canWriteCollection reports whether the user may add entries to the
+// collection.
+func canWriteCollection(userId, collectionId uuid.UUID) bool {
+	var count int64
+	config.DB.Model(&models.Collection{}).
+		Where("id=? AND id IN (?)", collectionId, collectionIDs(userId, true)).
+		Count(&count)
+	return count > 0
+}
+
+// loadMembership returns the user's confirmed membership in an organization.
+func loadMembership(userId uuid.UUID, orgId string) (models.Membership, error) {
+	membership := models.Membership{}
+	err := config.DB.Where("organization_id=? AND user_id=? AND status=?", orgId, userId, models.MembershipConfirmed).
+		First(&membership).Error
+	return membership, err
+}
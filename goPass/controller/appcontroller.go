@@ -4,8 +4,10 @@ package controller
 import (
 	"github.com/gofiber/fiber/v2"
 	"github.com/google/uuid"
+	"goPass/audit"
 	"goPass/config"
 	"goPass/models"
+	"goPass/utils"
 	"gorm.io/datatypes"
 )
 
@@ -49,6 +51,8 @@ func RegisterVaultEntry(c *fiber.Ctx) error {
 		})
 	}
 
+	recordEvent(c, models.AuditEvent{UserID: &id, Event: audit.EventVaultRegister})
+
 	return c.Status(201).JSON(fiber.Map{
 		"message": "vault registered successfully",
 	})
@@ -68,3 +72,60 @@ func CheckIfVaultRegistered(c *fiber.Ctx) error {
 		"message": "Vault initilization found",
 	})
 }
+
+type RegisterKeyPairRequest struct {
+	PublicKey         string         `json:"publickey"`
+	WrappedPrivateKey datatypes.JSON `json:"wrappedprivatekey"`
+}
+
+// RegisterKeyPair stores the user's sharing keypair. Like the vault itself it
+// can only be registered once, replacing it would orphan every share made to
+// the old key.
+func RegisterKeyPair(c *fiber.Ctx) error {
+	id := c.Locals("id").(uuid.UUID)
+
+	var data RegisterKeyPairRequest
+	if err := c.BodyParser(&data); err != nil {
+		return c.Status(400).JSON(fiber.Map{
+			"error": "invalid request",
+		})
+	}
+
+	fingerprint, err := utils.PublicKeyFingerprint(data.PublicKey)
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+	if len(data.WrappedPrivateKey) == 0 {
+		return c.Status(400).JSON(fiber.Map{
+			"error": "wrapped private key is required",
+		})
+	}
+
+	result := config.DB.Model(&models.AppUser{}).
+		Where("id = ? AND (public_key IS NULL OR public_key = '')", id).
+		Updates(map[string]interface{}{
+			"public_key":          data.PublicKey,
+			"wrapped_private_key": data.WrappedPrivateKey,
+		})
+
+	if result.Error != nil {
+		return c.Status(500).JSON(fiber.Map{
+			"error": "failed to register keypair",
+		})
+	}
+
+	if result.RowsAffected == 0 {
+		return c.Status(409).JSON(fiber.Map{
+			"error": "keypair already registered",
+		})
+	}
+
+	recordEvent(c, models.AuditEvent{UserID: &id, Event: audit.EventKeyPairRegister, Detail: fingerprint})
+
+	return c.Status(201).JSON(fiber.Map{
+		"message":     "keypair registered successfully",
+		"fingerprint": fingerprint,
+	})
+}
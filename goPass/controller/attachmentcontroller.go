@@ -0,0 +1,385 @@
+package controller
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+	"goPass/config"
+	"goPass/models"
+	"goPass/storage"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+const (
+	// stays below fiber's default 4MB body limit
+	maxAttachmentChunkSize = 2 * 1024 * 1024
+	maxAttachmentChunks    = 512
+
+	defaultAttachmentQuotaMB = 100
+
+	// uploads that weren't completed by then are given up on
+	staleAttachmentAge = 24 * time.Hour
+)
+
+var (
+	errQuotaExceeded      = errors.New("attachment quota exceeded")
+	errChunksTooLarge     = errors.New("chunks exceed the attachment size")
+	errAttachmentComplete = errors.New("attachment already complete")
+	errUploadIncomplete   = errors.New("upload incomplete")
+)
+
+func attachmentQuota() int64 {
+	quota, err := strconv.ParseInt(os.Getenv("ATTACHMENT_QUOTA_MB"), 10, 64)
+	if err != nil || quota <= 0 {
+		quota = defaultAttachmentQuotaMB
+	}
+	return quota * 1024 * 1024
+}
+
+func attachmentChunkKey(att models.Attachment, index int) string {
+	return fmt.Sprintf("attachments/%s/%s/%d", att.UserID, att.ID, index)
+}
+
+// deleteAttachmentBlobs removes every chunk of an attachment from the blob
+// store. Rows are left to the caller.
+func deleteAttachmentBlobs(ctx context.Context, att models.Attachment) {
+	for i := 0; i < att.ChunkCount; i++ {
+		if err := config.Blobs.Delete(ctx, attachmentChunkKey(att, i)); err != nil {
+			log.Println("failed to delete attachment chunk:", err)
+		}
+	}
+}
+
+type CreateAttachmentRequest struct {
+	VaultID       uuid.UUID `json:"vaultid"`
+	EncryptedName []byte    `json:"encryptedname"`
+	EncryptedKey  []byte    `json:"encryptedkey"`
+	IV            []byte    `json:"iv"`
+	Size          int64     `json:"size"`
+	ChunkCount    int       `json:"chunkcount"`
+}
+
+// CreateAttachment reserves space for an upload. The size counts against
+// the quota straight away, and the check and insert run under a lock on the
+// user row so parallel uploads can't overshoot it.
+func CreateAttachment(c *fiber.Ctx) error {
+	id := c.Locals("id").(uuid.UUID)
+	data := CreateAttachmentRequest{}
+	if err := c.BodyParser(&data); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "failed to parse the request",
+		})
+	}
+
+	if data.VaultID == uuid.Nil || len(data.EncryptedName) == 0 || len(data.EncryptedKey) == 0 || len(data.IV) == 0 {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "invalid data in req",
+		})
+	}
+	if data.Size <= 0 || data.ChunkCount <= 0 || data.ChunkCount > maxAttachmentChunks ||
+		data.Size > int64(data.ChunkCount)*maxAttachmentChunkSize {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "invalid size or chunk count",
+		})
+	}
+
+	if err := config.DB.Scopes(manageableEntries(id)).Where("id=? AND deleted=?", data.VaultID, false).Select("id").First(&models.VaultEntry{}).Error; err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "vault not found in db",
+		})
+	}
+
+	attachment := models.Attachment{
+		ID:            uuid.New(),
+		UserID:        id,
+		VaultEntryID:  data.VaultID,
+		EncryptedName: data.EncryptedName,
+		EncryptedKey:  data.EncryptedKey,
+		IV:            data.IV,
+		Size:          data.Size,
+		ChunkCount:    data.ChunkCount,
+	}
+	err := config.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Select("id").Where("id=?", id).First(&models.AppUser{}).Error; err != nil {
+			return err
+		}
+		var used int64
+		if err := tx.Model(&models.Attachment{}).Where("user_id=?", id).Select("COALESCE(SUM(size), 0)").Scan(&used).Error; err != nil {
+			return err
+		}
+		if used+data.Size > attachmentQuota() {
+			return errQuotaExceeded
+		}
+		return tx.Create(&attachment).Error
+	})
+	if errors.Is(err, errQuotaExceeded) {
+		return c.Status(fiber.StatusRequestEntityTooLarge).JSON(fiber.Map{
+			"error": "attachment quota exceeded",
+		})
+	}
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "failed to create attachment",
+		})
+	}
+
+	return c.Status(fiber.StatusCreated).JSON(fiber.Map{
+		"message":      "attachment created, upload the chunks next",
+		"data":         attachment,
+		"maxChunkSize": maxAttachmentChunkSize,
+	})
+}
+
+// UploadAttachmentChunk takes the raw chunk bytes as the request body.
+// Uploading the same index again replaces the chunk, so clients can retry.
+func UploadAttachmentChunk(c *fiber.Ctx) error {
+	id := c.Locals("id").(uuid.UUID)
+	attachmentId := c.Params("attachmentId")
+	index, err := strconv.Atoi(c.Params("index"))
+	if err != nil || index < 0 {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "invalid chunk index",
+		})
+	}
+
+	attachment := models.Attachment{}
+	if err := config.DB.Where("id=? AND user_id=?", attachmentId, id).First(&attachment).Error; err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "attachment not found",
+		})
+	}
+	if attachment.Complete {
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{
+			"error": "attachment already complete",
+		})
+	}
+	if index >= attachment.ChunkCount {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "chunk index out of range",
+		})
+	}
+
+	body := c.Body()
+	if len(body) == 0 || len(body) > maxAttachmentChunkSize {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "invalid chunk size",
+		})
+	}
+
+	// the chunk is recorded before its blob is stored, so the declared size
+	// caps what an unfinished upload can put in the blob store. It only
+	// counts towards completing the upload once the blob is there.
+	chunk := models.AttachmentChunk{
+		AttachmentID: attachment.ID,
+		ChunkIndex:   index,
+		Size:         int64(len(body)),
+	}
+	err = config.DB.Transaction(func(tx *gorm.DB) error {
+		locked := models.Attachment{}
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Select("id", "complete").Where("id=?", attachment.ID).First(&locked).Error; err != nil {
+			return err
+		}
+		if locked.Complete {
+			return errAttachmentComplete
+		}
+		var uploaded int64
+		err := tx.Model(&models.AttachmentChunk{}).
+			Where("attachment_id=? AND chunk_index<>?", attachment.ID, index).
+			Select("COALESCE(SUM(size), 0)").Scan(&uploaded).Error
+		if err != nil {
+			return err
+		}
+		if uploaded+chunk.Size > attachment.Size {
+			return errChunksTooLarge
+		}
+		return tx.Clauses(clause.OnConflict{UpdateAll: true}).Create(&chunk).Error
+	})
+	if errors.Is(err, errAttachmentComplete) {
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{
+			"error": "attachment already complete",
+		})
+	}
+	if errors.Is(err, errChunksTooLarge) {
+		return c.Status(fiber.StatusRequestEntityTooLarge).JSON(fiber.Map{
+			"error": "chunks exceed the attachment size",
+		})
+	}
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "failed to record chunk",
+		})
+	}
+
+	if err := config.Blobs.Put(c.UserContext(), attachmentChunkKey(attachment, index), bytes.NewReader(body)); err != nil {
+		log.Println("failed to store attachment chunk:", err)
+		config.DB.Where("attachment_id=? AND chunk_index=?", attachment.ID, index).Delete(&models.AttachmentChunk{})
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "failed to store chunk",
+		})
+	}
+	if err := config.DB.Model(&chunk).Update("stored", true).Error; err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "failed to record chunk",
+		})
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"message": "chunk uploaded",
+	})
+}
+
+func CompleteAttachment(c *fiber.Ctx) error {
+	id := c.Locals("id").(uuid.UUID)
+	attachmentId := c.Params("attachmentId")
+
+	// the attachment row is locked like in UploadAttachmentChunk, so no
+	// chunk can be replaced between the check and the update
+	attachment := models.Attachment{}
+	var stored, total int64
+	err := config.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Where("id=? AND user_id=?", attachmentId, id).First(&attachment).Error; err != nil {
+			return err
+		}
+		err := tx.Model(&models.AttachmentChunk{}).
+			Where("attachment_id=? AND stored=?", attachment.ID, true).
+			Select("COUNT(*), COALESCE(SUM(size), 0)").Row().Scan(&stored, &total)
+		if err != nil {
+			return err
+		}
+		if stored != int64(attachment.ChunkCount) || total != attachment.Size {
+			return errUploadIncomplete
+		}
+		return tx.Model(&attachment).Update("complete", true).Error
+	})
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "attachment not found",
+		})
+	}
+	if errors.Is(err, errUploadIncomplete) {
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{
+			"error":          "upload incomplete",
+			"chunksUploaded": stored,
+			"bytesUploaded":  total,
+		})
+	}
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "failed to complete attachment",
+		})
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"message": "attachment uploaded succesfully",
+	})
+}
+
+func ListAttachments(c *fiber.Ctx) error {
+	id := c.Locals("id").(uuid.UUID)
+
+	query := config.DB.Where("vault_entry_id IN (?)", config.DB.Model(&models.VaultEntry{}).Select("id").Scopes(readableEntries(id)))
+	if vaultId := c.Query("vault"); vaultId != "" {
+		query = query.Where("vault_entry_id=?", vaultId)
+	}
+
+	attachments := []models.Attachment{}
+	if err := query.Preload("Chunks").Find(&attachments).Error; err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "failed to fetch attachments",
+		})
+	}
+
+	var used int64
+	for _, att := range attachments {
+		used += att.Size
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"message": "fetched the list of attachments",
+		"data":    attachments,
+		"quota":   attachmentQuota(),
+		"used":    used,
+	})
+}
+
+// DownloadAttachment streams the encrypted chunks in order without holding
+// the whole file in memory.
+func DownloadAttachment(c *fiber.Ctx) error {
+	id := c.Locals("id").(uuid.UUID)
+	attachmentId := c.Params("attachmentId")
+
+	attachment := models.Attachment{}
+	if err := config.DB.Where("id=? AND complete=?", attachmentId, true).
+		Where("vault_entry_id IN (?)", config.DB.Model(&models.VaultEntry{}).Select("id").Scopes(readableEntries(id))).
+		First(&attachment).Error; err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "attachment not found",
+		})
+	}
+
+	keys := make([]string, attachment.ChunkCount)
+	for i := range keys {
+		keys[i] = attachmentChunkKey(attachment, i)
+	}
+
+	c.Set(fiber.HeaderContentType, fiber.MIMEOctetStream)
+	c.Set("X-Chunk-Count", strconv.Itoa(attachment.ChunkCount))
+	// the stream is read after the handler returns, so it can't borrow the
+	// request context
+	return c.SendStream(storage.NewConcatReader(context.Background(), config.Blobs, keys), int(attachment.Size))
+}
+
+func DeleteAttachment(c *fiber.Ctx) error {
+	id := c.Locals("id").(uuid.UUID)
+	attachmentId := c.Params("attachmentId")
+
+	attachment := models.Attachment{}
+	if err := config.DB.Where("id=?", attachmentId).
+		Where("user_id=? OR vault_entry_id IN (?)", id, config.DB.Model(&models.VaultEntry{}).Select("id").Scopes(manageableEntries(id))).
+		First(&attachment).Error; err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "attachment not found",
+		})
+	}
+
+	if err := config.DB.Delete(&attachment).Error; err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "failed to delete attachment",
+		})
+	}
+	deleteAttachmentBlobs(c.UserContext(), attachment)
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"message": "attachment deleted succesfully",
+	})
+}
+
+// DeleteStaleAttachments is run periodically to drop uploads that were never
+// completed, with whatever chunks they got.
+func DeleteStaleAttachments() {
+	attachments := []models.Attachment{}
+	err := config.DB.Where("complete=? AND created_at <= ?", false, time.Now().Add(-staleAttachmentAge)).Find(&attachments).Error
+	if err != nil {
+		log.Println("failed to find stale attachments:", err)
+		return
+	}
+	for _, att := range attachments {
+		if err := config.DB.Delete(&att).Error; err != nil {
+			log.Println("failed to delete stale attachment:", err)
+			continue
+		}
+		deleteAttachmentBlobs(context.Background(), att)
+	}
+	if len(attachments) > 0 {
+		log.Println("reaped", len(attachments), "stale attachments")
+	}
+}
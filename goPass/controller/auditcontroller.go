@@ -0,0 +1,80 @@
+package controller
+
+import (
+	"log"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+	"goPass/audit"
+	"goPass/config"
+	"goPass/models"
+	"gorm.io/gorm"
+)
+
+const (
+	defaultEventsLimit = 50
+	maxEventsLimit     = 200
+)
+
+// recordEvent appends an audit event with the request's IP, user agent and
+// device. A failure to record is logged and never fails the request.
+func recordEvent(c *fiber.Ctx, event models.AuditEvent) {
+	event.IP = c.IP()
+	event.UserAgent = c.Get(fiber.HeaderUserAgent)
+	event.DeviceID = requestDeviceID(c)
+	if err := audit.Record(config.DB, event); err != nil {
+		log.Println("audit: failed to record", event.Event, ":", err)
+	}
+}
+
+// requestDeviceID is the device the client says it is, nil when it didn't.
+func requestDeviceID(c *fiber.Ctx) *uuid.UUID {
+	deviceId, err := uuid.Parse(c.Get("X-Device-ID"))
+	if err != nil {
+		return nil
+	}
+	return &deviceId
+}
+
+// ListAccountEvents pages through the user's audit log, newest first, e.g.
+// /account/events?page=2&limit=50&event=login.
+func ListAccountEvents(c *fiber.Ctx) error {
+	id := c.Locals("id").(uuid.UUID)
+
+	page := c.QueryInt("page", 1)
+	limit := c.QueryInt("limit", defaultEventsLimit)
+	if page < 1 || limit < 1 || limit > maxEventsLimit {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "page must be at least 1 and limit between 1 and 200",
+		})
+	}
+
+	query := config.DB.Model(&models.AuditEvent{}).Where("user_id=?", id)
+	if event := c.Query("event"); event != "" {
+		query = query.Where("event=?", event)
+	}
+	query = query.Session(&gorm.Session{})
+
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "failed to fetch events",
+		})
+	}
+	events := []models.AuditEvent{}
+	if err := query.Order("created_at DESC, id").Offset((page - 1) * limit).Limit(limit).Find(&events).Error; err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "failed to fetch events",
+		})
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"message": "fetched account events",
+		"data": fiber.Map{
+			"events": events,
+			"page":   page,
+			"limit":  limit,
+			"total":  total,
+		},
+	})
+}
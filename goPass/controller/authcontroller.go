@@ -2,12 +2,17 @@ package controller
 
 import (
 	"log"
+	"time"
 
 	"github.com/gofiber/fiber/v2"
 	"github.com/google/uuid"
 	"github.com/lib/pq"
+	"goPass/audit"
 	"goPass/config"
+	"goPass/middlewares"
 	"goPass/models"
+	"goPass/notify"
+	"goPass/ratelimit"
 	"goPass/utils"
 	"golang.org/x/crypto/bcrypt"
 )
@@ -55,6 +60,7 @@ func RegisterAppUser(c *fiber.Ctx) error {
 		}
 		return c.Status(500).JSON(fiber.Map{"error": "Database error"})
 	}
+	recordEvent(c, models.AuditEvent{UserID: &user.ID, Event: audit.EventRegister})
 
 	return c.Status(fiber.StatusCreated).JSON(fiber.Map{
 		"message": "user created succesfully",
@@ -79,20 +85,85 @@ func LoginAppUser(c *fiber.Ctx) error {
 			"error": "invalid form data",
 		})
 	}
-	user := models.AppUser{}
-	if error := config.DB.Where("email=?", data.Email).Select("email", "id", "password").First(&user).Error; error != nil {
-		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
-			"error": "email not found",
+	// Limits go by the email asked for, whether or not it exists.
+	account := ratelimit.Account(data.Email)
+	ctx := c.UserContext()
+	decision, err := config.Limiter.Allow(ctx, ratelimit.AccountLogins, account)
+	if err == nil && decision.Allowed {
+		decision, err = config.Limiter.Backoff(ctx, account)
+	}
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "failed to check rate limit",
 		})
 	}
+	if !decision.Allowed {
+		recordEvent(c, models.AuditEvent{Event: audit.EventLogin, Outcome: audit.OutcomeFailure, Detail: "rate limited"})
+		return middleware.TooManyRequests(c, decision)
+	}
+
+	// Unknown emails, wrong passwords and locked accounts all fail the same
+	// way, so login can't be used to find out who has an account.
+	user := models.AppUser{}
+	if error := config.DB.Where("email=?", data.Email).Select("email", "id", "password", "locked_until").First(&user).Error; error != nil {
+		// spend the time a real password check would take
+		bcrypt.CompareHashAndPassword(dummyPasswordHash, []byte(data.Password))
+		recordEvent(c, models.AuditEvent{Event: audit.EventLogin, Outcome: audit.OutcomeFailure, Detail: "unknown email"})
+		failures, err := config.Limiter.Fail(ctx, account)
+		if err != nil {
+			log.Println("failed to record login failure:", err)
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"error": "failed to check rate limit",
+			})
+		}
+		if failures >= config.Limiter.LockoutAfter {
+			return accountLocked(c)
+		}
+		return invalidCredentials(c)
+	}
+
+	if user.LockedUntil != nil && user.LockedUntil.After(time.Now()) {
+		recordEvent(c, models.AuditEvent{UserID: &user.ID, Event: audit.EventLogin, Outcome: audit.OutcomeFailure, Detail: "account locked"})
+		if _, err := config.Limiter.Fail(ctx, account); err != nil {
+			log.Println("failed to record login failure:", err)
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"error": "failed to check rate limit",
+			})
+		}
+		return accountLocked(c)
+	}
 
 	if err := bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(data.Password)); err != nil {
-		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
-			"error": "invalid credentials",
+		recordEvent(c, models.AuditEvent{UserID: &user.ID, Event: audit.EventLogin, Outcome: audit.OutcomeFailure, Detail: "invalid credentials"})
+		failures, err := config.Limiter.Fail(ctx, account)
+		if err != nil {
+			log.Println("failed to record login failure:", err)
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"error": "failed to check rate limit",
+			})
+		}
+		if failures >= config.Limiter.LockoutAfter {
+			if err := lockAccount(c, user, failures); err != nil {
+				log.Println("failed to lock account:", err)
+			} else {
+				return accountLocked(c)
+			}
+		}
+		return invalidCredentials(c)
+	}
+	if err := config.Limiter.Reset(ctx, account); err != nil {
+		log.Println("failed to reset login failures:", err)
+	}
+	if user.LockedUntil != nil {
+		config.DB.Model(&models.AppUser{}).Where("id=?", user.ID).Updates(map[string]any{
+			"locked_until":      nil,
+			"unlock_token_hash": "",
 		})
 	}
 	accessToken, _ := utils.CreateAppAccessToken(user.ID)
 	refreshToken, _ := utils.CreateAppRefreshToken(user.ID)
+	recordEvent(c, models.AuditEvent{UserID: &user.ID, Event: audit.EventLogin})
+	notify.Login(user.ID, requestDeviceID(c), c.IP(), c.Get(fiber.HeaderUserAgent))
 
 	return c.Status(fiber.StatusCreated).JSON(fiber.Map{
 		"message":      "user logged in succesfully",
@@ -101,6 +172,24 @@ func LoginAppUser(c *fiber.Ctx) error {
 	})
 }
 
+// dummyPasswordHash is checked against when the email is unknown. It has
+// the cost RegisterAppUser hashes with.
+var dummyPasswordHash, _ = bcrypt.GenerateFromPassword([]byte("not a real password"), 10)
+
+func invalidCredentials(c *fiber.Ctx) error {
+	return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+		"error": "invalid credentials",
+	})
+}
+
+// accountLocked is also what an unknown email gets once it failed as often
+// as it takes to lock a real account.
+func accountLocked(c *fiber.Ctx) error {
+	return c.Status(fiber.StatusLocked).JSON(fiber.Map{
+		"error": "too many failed attempts, account is locked, check your email to unlock it",
+	})
+}
+
 func AppGetProfile(c *fiber.Ctx) error {
 	id := c.Locals("id")
 	data := models.AppUser{}
@@ -132,6 +221,7 @@ func RefreshAppToken(c *fiber.Ctx) error {
 
 	data, err := utils.VerifyRefreshToken(bearerToken)
 	if err != nil {
+		recordEvent(c, models.AuditEvent{Event: audit.EventTokenRefresh, Outcome: audit.OutcomeFailure, Detail: "invalid token"})
 		return c.Status(fiber.ErrBadRequest.Code).JSON(fiber.Map{
 			"error": "invalid token",
 		})
@@ -142,6 +232,7 @@ func RefreshAppToken(c *fiber.Ctx) error {
 			"error": "invalid token generation",
 		})
 	}
+	recordEvent(c, models.AuditEvent{UserID: &data.Id, Event: audit.EventTokenRefresh})
 	return c.Status(fiber.StatusOK).JSON(fiber.Map{
 		"newToken": newAccessToken,
 	})
@@ -0,0 +1,85 @@
+package controller
+
+import (
+	"log"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+	"goPass/config"
+	"goPass/models"
+	"goPass/notify"
+	"goPass/realtime"
+)
+
+// What happened to the vault, as told to the user's other devices.
+const (
+	ChangeCreated  = "created"
+	ChangeUpdated  = "updated"
+	ChangeDeleted  = "deleted"
+	ChangeImported = "imported"
+)
+
+// vaultChanged lets everyone who can see the entries know they should sync:
+// the user, the other members of a collection and those an entry is shared
+// with. Open apps hear it through their change stream and the rest by push.
+// The device that made the change already has it.
+func vaultChanged(c *fiber.Ctx, userId uuid.UUID, action string, ids ...uuid.UUID) {
+	publishChange(c, changeAudience(userId, ids), action, ids)
+}
+
+// changeAudience returns userId and every other user who can read one of
+// the entries. Call it before a change that takes the access away.
+func changeAudience(userId uuid.UUID, ids []uuid.UUID) []uuid.UUID {
+	audience := []uuid.UUID{userId}
+	if len(ids) == 0 {
+		return audience
+	}
+
+	var owners, members, recipients []uuid.UUID
+	config.DB.Model(&models.VaultEntry{}).
+		Where("id IN ? AND collection_id IS NULL", ids).
+		Distinct().Pluck("user_id", &owners)
+	config.DB.Model(&models.VaultEntry{}).
+		Joins("JOIN collections ON collections.id = vault_entries.collection_id").
+		Joins("JOIN memberships ON memberships.organization_id = collections.organization_id").
+		Where("vault_entries.id IN ? AND memberships.status=?", ids, models.MembershipConfirmed).
+		Where("(memberships.role IN ? OR EXISTS (SELECT 1 FROM collection_members WHERE collection_members.collection_id = collections.id AND collection_members.user_id = memberships.user_id))",
+			[]string{models.RoleOwner, models.RoleAdmin}).
+		Distinct().Pluck("memberships.user_id", &members)
+	config.DB.Model(&models.VaultShare{}).
+		Where("vault_entry_id IN ? AND status=?", ids, models.ShareStatusAccepted).
+		Distinct().Pluck("recipient_id", &recipients)
+
+	seen := map[uuid.UUID]bool{userId: true}
+	for _, list := range [][]uuid.UUID{owners, members, recipients} {
+		for _, id := range list {
+			if !seen[id] {
+				seen[id] = true
+				audience = append(audience, id)
+			}
+		}
+	}
+	return audience
+}
+
+func publishChange(c *fiber.Ctx, audience []uuid.UUID, action string, ids []uuid.UUID) {
+	deviceId := requestDeviceID(c)
+	for _, userId := range audience {
+		notify.VaultChanged(userId, deviceId, action, ids)
+	}
+
+	if config.Changes == nil {
+		return
+	}
+	var idStrings []string
+	for _, id := range ids {
+		idStrings = append(idStrings, id.String())
+	}
+	for _, userId := range audience {
+		change := realtime.Change{UserID: userId, Action: action, IDs: idStrings, DeviceID: deviceId, At: time.Now().UTC()}
+		if err := config.Changes.Publish(c.UserContext(), change); err != nil {
+			log.Println("realtime: failed to publish change:", err)
+		}
+	}
+}
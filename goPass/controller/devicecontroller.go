@@ -1,11 +1,16 @@
 package controller
 
 import (
+	"errors"
+
 	"github.com/gofiber/fiber/v2"
+	"goPass/audit"
 	"goPass/config"
 	"goPass/models"
+	"goPass/notify"
 
 	"github.com/google/uuid"
+	"gorm.io/gorm"
 )
 
 type RegisterDeviceRequest struct {
@@ -41,6 +46,9 @@ func RegisterDevice(c *fiber.Ctx) error {
 		})
 	}
 
+	recordEvent(c, models.AuditEvent{UserID: &id, Event: audit.EventDeviceRegister, TargetID: &newDevice.ID, Detail: newDevice.DeviceName})
+	notify.DeviceRegistered(id, newDevice, c.IP())
+
 	return c.Status(fiber.StatusCreated).JSON(fiber.Map{
 		"messaage": "succesfully add new device",
 	})
@@ -69,7 +77,7 @@ func ListDevices(c *fiber.Ctx) error {
 }
 
 func RevokeDevice(c *fiber.Ctx) error {
-	deviceId := c.Params("deviceId")
+	deviceId := c.Params("id")
 	id := c.Locals("id").(uuid.UUID)
 
 	if deviceId == "" || id == uuid.Nil {
@@ -84,7 +92,70 @@ func RevokeDevice(c *fiber.Ctx) error {
 			"error": "device not found",
 		})
 	}
+	if revoked, err := uuid.Parse(deviceId); err == nil {
+		recordEvent(c, models.AuditEvent{UserID: &id, Event: audit.EventDeviceRevoke, TargetID: &revoked})
+	}
 	return c.Status(fiber.StatusOK).JSON(fiber.Map{
 		"messaage": "succesfully unsynced device" + deviceId,
 	})
 }
+
+type SetPushTokenRequest struct {
+	DeviceID  uuid.UUID `json:"deviceid"`
+	PushToken string    `json:"pushtoken"`
+}
+
+// SetPushToken stores the Expo push token of a device, an empty token turns
+// pushes off for it. A token moves with the app, so it is taken away from
+// any other device that had it.
+func SetPushToken(c *fiber.Ctx) error {
+	id := c.Locals("id").(uuid.UUID)
+	data := SetPushTokenRequest{}
+	if err := c.BodyParser(&data); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "failed to parse the request",
+		})
+	}
+
+	if data.DeviceID == uuid.Nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "invalid data in req",
+		})
+	}
+	if data.PushToken != "" && !notify.ValidExpoToken(data.PushToken) {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "not an expo push token",
+		})
+	}
+
+	err := config.DB.Transaction(func(tx *gorm.DB) error {
+		if data.PushToken != "" {
+			if err := tx.Model(&models.Device{}).Where("push_token=? AND id<>?", data.PushToken, data.DeviceID).
+				Update("push_token", "").Error; err != nil {
+				return err
+			}
+		}
+		res := tx.Model(&models.Device{}).Where("id=? AND user_id=?", data.DeviceID, id).Update("push_token", data.PushToken)
+		if res.Error != nil {
+			return res.Error
+		}
+		if res.RowsAffected == 0 {
+			return gorm.ErrRecordNotFound
+		}
+		return nil
+	})
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "device not found",
+		})
+	}
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "failed to update push token",
+		})
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"message": "push token updated succesfully",
+	})
+}
@@ -0,0 +1,354 @@
+package controller
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+	"goPass/config"
+	"goPass/models"
+	"goPass/notify"
+)
+
+const (
+	minEmergencyWaitDays = 1
+	maxEmergencyWaitDays = 90
+)
+
+type InviteEmergencyRequest struct {
+	Email    string `json:"email"`
+	WaitDays int    `json:"waitdays"`
+}
+
+// InviteEmergencyContact asks another user to become the caller's trusted
+// contact.
+func InviteEmergencyContact(c *fiber.Ctx) error {
+	id := c.Locals("id").(uuid.UUID)
+	data := InviteEmergencyRequest{}
+	if err := c.BodyParser(&data); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "failed to parse the request",
+		})
+	}
+
+	if data.Email == "" || data.WaitDays < minEmergencyWaitDays || data.WaitDays > maxEmergencyWaitDays {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": fmt.Sprintf("email and a waitdays between %d and %d are required", minEmergencyWaitDays, maxEmergencyWaitDays),
+		})
+	}
+
+	grantee := models.AppUser{}
+	// the vault key is later wrapped with the grantee's public key, so a
+	// contact without one could never take over
+	if err := config.DB.Where("email=?", data.Email).Select("id", "public_key").First(&grantee).Error; err != nil || grantee.PublicKey == "" {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "user not found or has no public key",
+		})
+	}
+	if grantee.ID == id {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "cannot be your own emergency contact",
+		})
+	}
+
+	access := models.EmergencyAccess{
+		ID:        uuid.New(),
+		GrantorID: id,
+		GranteeID: grantee.ID,
+		Status:    models.EmergencyInvited,
+		WaitDays:  data.WaitDays,
+	}
+	if err := config.DB.Create(&access).Error; err != nil {
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{
+			"error": "this user is already your emergency contact",
+		})
+	}
+
+	notify.User(grantee.ID, "You were added as an emergency contact",
+		"Someone added you as a trusted emergency contact on goPass. Open the app to accept or decline.")
+
+	return c.Status(fiber.StatusCreated).JSON(fiber.Map{
+		"message": "emergency contact invited",
+		"data":    access,
+	})
+}
+
+type emergencyRow struct {
+	ID          uuid.UUID  `json:"id"`
+	UserID      uuid.UUID  `json:"userId"`
+	Email       string     `json:"email"`
+	FullName    string     `json:"fullName"`
+	Status      string     `json:"status"`
+	WaitDays    int        `json:"waitDays"`
+	RequestedAt *time.Time `json:"requestedAt"`
+}
+
+// ListEmergencyContacts returns the people the caller trusts.
+func ListEmergencyContacts(c *fiber.Ctx) error {
+	id := c.Locals("id").(uuid.UUID)
+	return listEmergencyAccess(c, "grantor_id", "grantee_id", id)
+}
+
+// ListEmergencyGrantors returns the people who trust the caller.
+func ListEmergencyGrantors(c *fiber.Ctx) error {
+	id := c.Locals("id").(uuid.UUID)
+	return listEmergencyAccess(c, "grantee_id", "grantor_id", id)
+}
+
+func listEmergencyAccess(c *fiber.Ctx, self, other string, id uuid.UUID) error {
+	rows := []emergencyRow{}
+	if err := config.DB.Model(&models.EmergencyAccess{}).
+		Select("emergency_accesses.id, app_users.id AS user_id, app_users.email, app_users.full_name, "+
+			"emergency_accesses.status, emergency_accesses.wait_days, emergency_accesses.requested_at").
+		Joins("JOIN app_users ON app_users.id = emergency_accesses."+other).
+		Where("emergency_accesses."+self+"=?", id).
+		Scan(&rows).Error; err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "failed to fetch emergency contacts",
+		})
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"message": "fetched emergency contacts",
+		"data":    rows,
+	})
+}
+
+// transitionEmergency moves an emergency access row from one status to
+// another on behalf of the grantor or grantee, and returns the updated row.
+func transitionEmergency(c *fiber.Ctx, asGrantor bool, from string, updates map[string]interface{}) (models.EmergencyAccess, bool) {
+	id := c.Locals("id").(uuid.UUID)
+	accessId := c.Params("accessId")
+
+	party := "grantee_id=?"
+	if asGrantor {
+		party = "grantor_id=?"
+	}
+
+	access := models.EmergencyAccess{}
+	res := config.DB.Model(&access).
+		Where("id=? AND status=?", accessId, from).
+		Where(party, id).
+		Updates(updates)
+	if res.Error != nil || res.RowsAffected == 0 {
+		return access, false
+	}
+	config.DB.Where("id=?", accessId).First(&access)
+	return access, true
+}
+
+func AcceptEmergencyInvite(c *fiber.Ctx) error {
+	access, ok := transitionEmergency(c, false, models.EmergencyInvited, map[string]interface{}{
+		"status": models.EmergencyAccepted,
+	})
+	if !ok {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "emergency invite not found",
+		})
+	}
+
+	notify.User(access.GrantorID, "Your emergency contact accepted",
+		"Your emergency contact accepted the invite. Open goPass to confirm them, this shares your encrypted vault key with them.")
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"message": "emergency invite accepted",
+	})
+}
+
+type ConfirmEmergencyRequest struct {
+	WrappedVaultKey []byte `json:"wrappedvaultkey"`
+}
+
+// ConfirmEmergencyContact is the grantor handing over the vault key wrapped
+// with the grantee's public key. Nothing is readable by the grantee until a
+// recovery request is approved.
+func ConfirmEmergencyContact(c *fiber.Ctx) error {
+	data := ConfirmEmergencyRequest{}
+	if err := c.BodyParser(&data); err != nil || len(data.WrappedVaultKey) == 0 {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "wrappedvaultkey is required",
+		})
+	}
+
+	access, ok := transitionEmergency(c, true, models.EmergencyAccepted, map[string]interface{}{
+		"status":            models.EmergencyConfirmed,
+		"wrapped_vault_key": data.WrappedVaultKey,
+	})
+	if !ok {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "accepted emergency contact not found",
+		})
+	}
+
+	notify.User(access.GranteeID, "You are now an emergency contact",
+		"You were confirmed as an emergency contact. If you ever need access, request it from the goPass app.")
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"message": "emergency contact confirmed",
+	})
+}
+
+func RequestEmergencyAccess(c *fiber.Ctx) error {
+	access, ok := transitionEmergency(c, false, models.EmergencyConfirmed, map[string]interface{}{
+		"status":       models.EmergencyRequested,
+		"requested_at": time.Now(),
+	})
+	if !ok {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "confirmed emergency access not found",
+		})
+	}
+
+	notify.User(access.GrantorID, "Emergency access requested",
+		fmt.Sprintf("Your emergency contact requested access to your vault. It will be granted automatically in %d days unless you reject the request in the goPass app.", access.WaitDays))
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"message":  "emergency access requested",
+		"waitDays": access.WaitDays,
+	})
+}
+
+// ApproveEmergencyAccess lets the grantor skip the waiting period.
+func ApproveEmergencyAccess(c *fiber.Ctx) error {
+	access, ok := transitionEmergency(c, true, models.EmergencyRequested, map[string]interface{}{
+		"status": models.EmergencyApproved,
+	})
+	if !ok {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "pending emergency request not found",
+		})
+	}
+
+	notify.User(access.GranteeID, "Emergency access granted",
+		"Your emergency access request was approved. You can now open the vault from the goPass app.")
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"message": "emergency access approved",
+	})
+}
+
+func RejectEmergencyAccess(c *fiber.Ctx) error {
+	access, ok := transitionEmergency(c, true, models.EmergencyRequested, map[string]interface{}{
+		"status":       models.EmergencyConfirmed,
+		"requested_at": nil,
+	})
+	if !ok {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "pending emergency request not found",
+		})
+	}
+
+	notify.User(access.GranteeID, "Emergency access rejected",
+		"Your emergency access request was rejected by the vault owner.")
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"message": "emergency access rejected",
+	})
+}
+
+// GetEmergencyVault hands an approved grantee the wrapped vault key and the
+// grantor's encrypted personal entries.
+func GetEmergencyVault(c *fiber.Ctx) error {
+	id := c.Locals("id").(uuid.UUID)
+	accessId := c.Params("accessId")
+
+	access := models.EmergencyAccess{}
+	if err := config.DB.Where("id=? AND grantee_id=?", accessId, id).First(&access).Error; err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "emergency access not found",
+		})
+	}
+
+	// the background job approves expired requests too, this just saves the
+	// grantee from waiting for its next run
+	if access.WaitOver(time.Now()) {
+		if approveEmergencyAccess(access) {
+			access.Status = models.EmergencyApproved
+		}
+	}
+	if access.Status != models.EmergencyApproved {
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
+			"error":  "emergency access not granted",
+			"status": access.Status,
+		})
+	}
+
+	entries := []models.VaultEntry{}
+	if err := config.DB.Scopes(personalEntries(access.GrantorID)).Where("deleted=?", false).Find(&entries).Error; err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "failed to fetch vault from db",
+		})
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"message":         "fetched emergency vault",
+		"wrappedVaultKey": access.WrappedVaultKey,
+		"data":            entries,
+	})
+}
+
+// approveEmergencyAccess grants a request whose waiting period ran out and
+// tells both sides. It is safe to race with the background job, only one
+// of them gets to flip the status.
+func approveEmergencyAccess(access models.EmergencyAccess) bool {
+	res := config.DB.Model(&models.EmergencyAccess{}).
+		Where("id=? AND status=?", access.ID, models.EmergencyRequested).
+		Update("status", models.EmergencyApproved)
+	if res.Error != nil || res.RowsAffected == 0 {
+		return false
+	}
+
+	notify.User(access.GranteeID, "Emergency access granted",
+		"The waiting period passed without a rejection. You can now open the vault from the goPass app.")
+	notify.User(access.GrantorID, "Emergency access granted",
+		"Your emergency contact has been granted access to your vault after the waiting period.")
+	return true
+}
+
+// ApproveExpiredEmergencyAccess is run periodically to grant every request
+// that sat through its waiting period.
+func ApproveExpiredEmergencyAccess() {
+	pending := []models.EmergencyAccess{}
+	if err := config.DB.Where("status=?", models.EmergencyRequested).Find(&pending).Error; err != nil {
+		return
+	}
+
+	now := time.Now()
+	for _, access := range pending {
+		if access.WaitOver(now) {
+			approveEmergencyAccess(access)
+		}
+	}
+}
+
+// RevokeEmergencyAccess ends the relationship. Either side can do it, and
+// the wrapped vault key goes with the row.
+func RevokeEmergencyAccess(c *fiber.Ctx) error {
+	id := c.Locals("id").(uuid.UUID)
+	accessId := c.Params("accessId")
+
+	access := models.EmergencyAccess{}
+	if err := config.DB.Where("id=? AND (grantor_id=? OR grantee_id=?)", accessId, id, id).First(&access).Error; err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "emergency access not found",
+		})
+	}
+
+	if err := config.DB.Delete(&access).Error; err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "failed to revoke emergency access",
+		})
+	}
+
+	other := access.GranteeID
+	if other == id {
+		other = access.GrantorID
+	}
+	notify.User(other, "Emergency access removed",
+		"An emergency access relationship on your goPass account was removed.")
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"message": "emergency access revoked",
+	})
+}
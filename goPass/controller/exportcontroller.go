@@ -0,0 +1,166 @@
+package controller
+
+import (
+	"bufio"
+	"encoding/json"
+	"log"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+	"goPass/config"
+	"goPass/models"
+	"goPass/vaultexport"
+	"gorm.io/gorm"
+)
+
+const exportBatchSize = 200
+
+// ExportVault streams the user's personal entries as a vaultexport document.
+// Collection entries belong to the organization and are left out. Nothing is
+// decrypted here, the file is only as readable as the vault itself.
+func ExportVault(c *fiber.Ctx) error {
+	id := c.Locals("id").(uuid.UUID)
+
+	user := models.AppUser{}
+	if err := config.DB.Where("id=?", id).First(&user).Error; err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "user not found",
+		})
+	}
+
+	master, ok := wrappedMasterKey(user)
+	if !ok {
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{
+			"error": "vault keys are not set up for this account",
+		})
+	}
+
+	folders := []models.Folder{}
+	tags := []models.Tag{}
+	if err := config.DB.Where("user_id=?", id).Find(&folders).Error; err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "failed to export vault",
+		})
+	}
+	if err := config.DB.Where("user_id=?", id).Find(&tags).Error; err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "failed to export vault",
+		})
+	}
+
+	doc := vaultexport.Document{
+		ExportedAt: time.Now().UTC(),
+		Account:    vaultexport.Account{ID: user.ID.String(), Email: user.Email},
+		KDF: vaultexport.KDF{
+			Algorithm:  vaultexport.KDFPBKDF2SHA256,
+			Iterations: vaultexport.DefaultKDFIterations,
+			KeyLength:  vaultexport.DefaultKDFKeyLength,
+			Salt:       *user.MasterSalt,
+		},
+		Keys: vaultexport.Keys{Cipher: vaultexport.CipherAES256CBC, Master: master},
+	}
+	for _, folder := range folders {
+		doc.Folders = append(doc.Folders, vaultexport.Folder{
+			ID:            folder.ID.String(),
+			ParentID:      uuidString(folder.ParentID),
+			EncryptedName: folder.EncryptedName,
+			IV:            folder.IV,
+		})
+	}
+	for _, tag := range tags {
+		doc.Tags = append(doc.Tags, vaultexport.Tag{
+			ID:            tag.ID.String(),
+			EncryptedName: tag.EncryptedName,
+			IV:            tag.IV,
+		})
+	}
+
+	c.Set(fiber.HeaderContentType, fiber.MIMEApplicationJSON)
+	c.Set(fiber.HeaderContentDisposition, `attachment; filename="gopass-export-`+doc.ExportedAt.Format("20060102-150405")+`.json"`)
+	c.Context().SetBodyStreamWriter(func(w *bufio.Writer) {
+		// The status line is already out by now, so a failure can only cut
+		// the document short. Decoders reject a truncated export.
+		out, err := vaultexport.NewWriter(w, doc)
+		if err != nil {
+			log.Println("vault export failed:", err)
+			return
+		}
+
+		entries := []models.VaultEntry{}
+		err = config.DB.Scopes(personalEntries(id)).Where("deleted=?", false).
+			Preload("Tags").
+			FindInBatches(&entries, exportBatchSize, func(tx *gorm.DB, _ int) error {
+				for _, entry := range entries {
+					if err := out.WriteEntry(exportEntry(entry)); err != nil {
+						return err
+					}
+				}
+				return w.Flush()
+			}).Error
+		if err != nil {
+			log.Println("vault export failed:", err)
+			return
+		}
+		if err := out.Close(); err != nil {
+			log.Println("vault export failed:", err)
+		}
+	})
+	return nil
+}
+
+// wrappedMasterKey returns the user's vault key as wrapped by the master
+// key, or false if the vault was never set up.
+func wrappedMasterKey(user models.AppUser) (vaultexport.WrappedKey, bool) {
+	master := vaultexport.WrappedKey{}
+	if user.MasterSalt == nil || json.Unmarshal(user.AesHashKeyMaster, &master) != nil || master.Ciphertext == "" {
+		return master, false
+	}
+	return master, true
+}
+
+func exportEntry(entry models.VaultEntry) vaultexport.Entry {
+	out := vaultexport.Entry{
+		ID:                entry.ID.String(),
+		ItemType:          entry.ItemType,
+		PlatformName:      entry.PlatformName,
+		EntryKey:          entry.EntryKey,
+		EncryptedPassword: entry.EncryptedPassword,
+		IV:                entry.IV,
+		EncryptedItemKey:  entry.EncryptedItemKey,
+		Envelope:          json.RawMessage(entry.Envelope),
+		FolderID:          uuidString(entry.FolderID),
+		Favorite:          entry.Favorite,
+		CreatedAt:         entry.CreatedAt,
+		UpdatedAt:         entry.UpdatedAt,
+	}
+	if fields, err := json.Marshal(entry.CustomFields); err == nil {
+		out.CustomFields = fields
+	}
+	if len(entry.URIs) > 0 {
+		if uris, err := json.Marshal(entry.URIs); err == nil {
+			out.URIs = uris
+		}
+	}
+	if entry.TOTP != nil && entry.HasTOTP {
+		out.TOTP = &vaultexport.TOTP{
+			EncryptedSeed: entry.TOTP.EncryptedSeed,
+			SeedIV:        entry.TOTP.SeedIV,
+			Algorithm:     entry.TOTP.Algorithm,
+			Digits:        entry.TOTP.Digits,
+			Period:        entry.TOTP.Period,
+		}
+	}
+	for _, tag := range entry.Tags {
+		out.TagIDs = append(out.TagIDs, tag.ID.String())
+	}
+	return out
+}
+
+func uuidString(id *uuid.UUID) *string {
+	if id == nil {
+		return nil
+	}
+	s := id.String()
+	return &s
+}
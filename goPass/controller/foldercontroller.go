@@ -0,0 +1,227 @@
+package controller
+
+import (
+	"errors"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+	"goPass/config"
+	"goPass/models"
+	"gorm.io/gorm"
+)
+
+// deep enough for any sane folder tree, and stops a corrupt parent chain
+// from looping forever
+const maxFolderDepth = 32
+
+type CreateFolderRequest struct {
+	ParentID      *uuid.UUID `json:"parentid"`
+	EncryptedName []byte     `json:"encryptedname"`
+	IV            []byte     `json:"iv"`
+}
+
+func CreateFolder(c *fiber.Ctx) error {
+	id := c.Locals("id").(uuid.UUID)
+	data := CreateFolderRequest{}
+	if err := c.BodyParser(&data); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "failed to parse the request",
+		})
+	}
+
+	if len(data.EncryptedName) == 0 || len(data.IV) == 0 {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "EncryptedName and IV cannot be empty",
+		})
+	}
+
+	if data.ParentID != nil {
+		if err := config.DB.Where("id=? AND user_id=?", *data.ParentID, id).First(&models.Folder{}).Error; err != nil {
+			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+				"error": "parent folder not found",
+			})
+		}
+	}
+
+	folder := models.Folder{
+		ID:            uuid.New(),
+		UserID:        id,
+		ParentID:      data.ParentID,
+		EncryptedName: data.EncryptedName,
+		IV:            data.IV,
+	}
+	if err := config.DB.Create(&folder).Error; err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "failed to create folder",
+		})
+	}
+
+	return c.Status(fiber.StatusCreated).JSON(fiber.Map{
+		"message": "folder created succesfully",
+		"data":    folder,
+	})
+}
+
+func ListFolders(c *fiber.Ctx) error {
+	id := c.Locals("id").(uuid.UUID)
+
+	folders := []models.Folder{}
+	if err := config.DB.Where("user_id=?", id).Find(&folders).Error; err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "failed to fetch folders",
+		})
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"message": "fetched the list of folders",
+		"data":    folders,
+	})
+}
+
+type RenameFolderRequest struct {
+	Id            uuid.UUID `json:"id"`
+	EncryptedName []byte    `json:"encryptedname"`
+	IV            []byte    `json:"iv"`
+}
+
+func RenameFolder(c *fiber.Ctx) error {
+	id := c.Locals("id").(uuid.UUID)
+	data := RenameFolderRequest{}
+	if err := c.BodyParser(&data); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "failed to parse the request",
+		})
+	}
+
+	if data.Id == uuid.Nil || len(data.EncryptedName) == 0 || len(data.IV) == 0 {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "invalid data in req",
+		})
+	}
+
+	res := config.DB.Model(&models.Folder{}).
+		Where("id=? AND user_id=?", data.Id, id).
+		Updates(map[string]interface{}{
+			"encrypted_name": data.EncryptedName,
+			"iv":             data.IV,
+		})
+	if res.Error != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "failed to rename folder",
+		})
+	}
+	if res.RowsAffected == 0 {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "folder not found",
+		})
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"message": "folder renamed succesfully",
+	})
+}
+
+type MoveFolderRequest struct {
+	Id       uuid.UUID  `json:"id"`
+	ParentID *uuid.UUID `json:"parentid"`
+}
+
+func MoveFolder(c *fiber.Ctx) error {
+	id := c.Locals("id").(uuid.UUID)
+	data := MoveFolderRequest{}
+	if err := c.BodyParser(&data); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "failed to parse the request",
+		})
+	}
+
+	if data.Id == uuid.Nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "invalid data in req",
+		})
+	}
+
+	if err := config.DB.Where("id=? AND user_id=?", data.Id, id).First(&models.Folder{}).Error; err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "folder not found",
+		})
+	}
+
+	if data.ParentID != nil {
+		if err := checkFolderParent(id, data.Id, *data.ParentID); err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": err.Error(),
+			})
+		}
+	}
+
+	if err := config.DB.Model(&models.Folder{}).
+		Where("id=? AND user_id=?", data.Id, id).
+		Update("parent_id", data.ParentID).Error; err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "failed to move folder",
+		})
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"message": "folder moved succesfully",
+	})
+}
+
+// checkFolderParent walks up from the new parent to make sure the folder
+// being moved is not one of its ancestors.
+func checkFolderParent(userId, folderId, parentId uuid.UUID) error {
+	current := &parentId
+	for depth := 0; current != nil; depth++ {
+		if depth >= maxFolderDepth {
+			return errors.New("folders nested too deep")
+		}
+		if *current == folderId {
+			return errors.New("cannot move a folder into itself")
+		}
+
+		folder := models.Folder{}
+		if err := config.DB.Where("id=? AND user_id=?", *current, userId).Select("id", "parent_id").First(&folder).Error; err != nil {
+			return errors.New("parent folder not found")
+		}
+		current = folder.ParentID
+	}
+	return nil
+}
+
+// DeleteFolder removes a folder without losing what was inside it: entries
+// and sub folders are handed over to the parent of the deleted folder.
+func DeleteFolder(c *fiber.Ctx) error {
+	folderId := c.Params("folderId")
+	id := c.Locals("id").(uuid.UUID)
+
+	folder := models.Folder{}
+	if err := config.DB.Where("id=? AND user_id=?", folderId, id).First(&folder).Error; err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "folder not found",
+		})
+	}
+
+	err := config.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&models.VaultEntry{}).
+			Where("folder_id=? AND user_id=?", folder.ID, id).
+			Update("folder_id", folder.ParentID).Error; err != nil {
+			return err
+		}
+		if err := tx.Model(&models.Folder{}).
+			Where("parent_id=? AND user_id=?", folder.ID, id).
+			Update("parent_id", folder.ParentID).Error; err != nil {
+			return err
+		}
+		return tx.Delete(&folder).Error
+	})
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "failed to delete folder",
+		})
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"message": "folder deleted succesfully",
+	})
+}
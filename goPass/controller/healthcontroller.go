@@ -0,0 +1,204 @@
+package controller
+
+import (
+	"errors"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+	"goPass/config"
+	"goPass/models"
+	"gorm.io/gorm"
+)
+
+const (
+	maxHealthUpdates    = 1000
+	maxFingerprintSize  = 128
+	minFingerprintSize  = 16
+	maxStrengthScore    = 4
+	defaultWeakScore    = 2
+	defaultRotationDays = 180
+)
+
+type HealthScore struct {
+	ID          uuid.UUID `json:"id"`
+	Fingerprint string    `json:"fingerprint"`
+	Strength    *int      `json:"strength"`
+}
+
+type UpdateHealthRequest struct {
+	Entries []HealthScore `json:"entries"`
+}
+
+func validateHealthScore(fingerprint string, strength *int) error {
+	if len(fingerprint) < minFingerprintSize || len(fingerprint) > maxFingerprintSize {
+		return errors.New("fingerprint must be 16-128 characters")
+	}
+	if strength != nil && (*strength < 0 || *strength > maxStrengthScore) {
+		return errors.New("strength must be between 0 and 4")
+	}
+	return nil
+}
+
+// UpdateVaultHealth stores the fingerprints and strength scores the client
+// computed for its entries. The fingerprint must be a keyed hash (e.g. an
+// HMAC under a key derived from the vault key) so the server can tell two
+// equal passwords apart from two different ones and nothing more. A changed
+// fingerprint counts as a password change for the rotation check.
+func UpdateVaultHealth(c *fiber.Ctx) error {
+	id := c.Locals("id").(uuid.UUID)
+	data := UpdateHealthRequest{}
+	if err := c.BodyParser(&data); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "failed to parse the request",
+		})
+	}
+
+	if len(data.Entries) == 0 || len(data.Entries) > maxHealthUpdates {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "send between 1 and 1000 entries",
+		})
+	}
+	ids := make([]uuid.UUID, len(data.Entries))
+	for i, score := range data.Entries {
+		if err := validateHealthScore(score.Fingerprint, score.Strength); err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": err.Error(),
+			})
+		}
+		ids[i] = score.ID
+	}
+
+	entries := []models.VaultEntry{}
+	if err := config.DB.Scopes(personalEntries(id)).Where("id IN ?", ids).Select("id", "fingerprint").Find(&entries).Error; err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "failed to update vault health",
+		})
+	}
+	current := map[uuid.UUID]string{}
+	for _, entry := range entries {
+		current[entry.ID] = entry.Fingerprint
+	}
+
+	updated := 0
+	now := time.Now()
+	err := config.DB.Transaction(func(tx *gorm.DB) error {
+		for _, score := range data.Entries {
+			fingerprint, ok := current[score.ID]
+			if !ok {
+				continue
+			}
+			changes := map[string]interface{}{
+				"fingerprint":    score.Fingerprint,
+				"strength_score": score.Strength,
+			}
+			// the first fingerprint only tells us what the password is,
+			// not that it just changed
+			if fingerprint != "" && fingerprint != score.Fingerprint {
+				changes["password_changed_at"] = now
+			}
+			if err := tx.Model(&models.VaultEntry{}).Where("id=?", score.ID).UpdateColumns(changes).Error; err != nil {
+				return err
+			}
+			updated++
+		}
+		return nil
+	})
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "failed to update vault health",
+		})
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"message": "vault health updated succesfully",
+		"data": fiber.Map{
+			"updated": updated,
+		},
+	})
+}
+
+type HealthEntry struct {
+	ID           uuid.UUID `json:"id"`
+	PlatformName string    `json:"platformName"`
+}
+
+// GetVaultHealth reports reused, weak and old passwords of the personal
+// vault from the stored fingerprints and scores. ?weak sets the highest
+// score that counts as weak and ?days how old a password may get.
+func GetVaultHealth(c *fiber.Ctx) error {
+	id := c.Locals("id").(uuid.UUID)
+	weakScore := c.QueryInt("weak", defaultWeakScore)
+	days := c.QueryInt("days", defaultRotationDays)
+	if weakScore < 0 || weakScore > maxStrengthScore || days < 1 {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "weak must be between 0 and 4 and days at least 1",
+		})
+	}
+
+	entries := []models.VaultEntry{}
+	if err := config.DB.Scopes(personalEntries(id)).
+		Where("deleted=? AND item_type=?", false, models.ItemTypeLogin).
+		Select("id", "platform_name", "fingerprint", "strength_score", "password_changed_at", "created_at").
+		Find(&entries).Error; err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "failed to build vault health report",
+		})
+	}
+
+	cutoff := time.Now().AddDate(0, 0, -days)
+	groups := map[string][]HealthEntry{}
+	order := []string{}
+	weak := []HealthEntry{}
+	old := []HealthEntry{}
+	unscored := []HealthEntry{}
+	for _, entry := range entries {
+		item := HealthEntry{ID: entry.ID, PlatformName: entry.PlatformName}
+		if entry.Fingerprint == "" {
+			unscored = append(unscored, item)
+			continue
+		}
+		if groups[entry.Fingerprint] == nil {
+			order = append(order, entry.Fingerprint)
+		}
+		groups[entry.Fingerprint] = append(groups[entry.Fingerprint], item)
+
+		if entry.StrengthScore != nil && *entry.StrengthScore <= weakScore {
+			weak = append(weak, item)
+		}
+		changedAt := entry.CreatedAt
+		if entry.PasswordChangedAt != nil {
+			changedAt = *entry.PasswordChangedAt
+		}
+		if changedAt.Before(cutoff) {
+			old = append(old, item)
+		}
+	}
+
+	// fingerprints themselves stay out of the report, the groups are enough
+	reused := [][]HealthEntry{}
+	reusedCount := 0
+	for _, fingerprint := range order {
+		if len(groups[fingerprint]) > 1 {
+			reused = append(reused, groups[fingerprint])
+			reusedCount += len(groups[fingerprint])
+		}
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"message": "fetched vault health report",
+		"data": fiber.Map{
+			"summary": fiber.Map{
+				"total":    len(entries),
+				"reused":   reusedCount,
+				"weak":     len(weak),
+				"old":      len(old),
+				"unscored": len(unscored),
+			},
+			"reused":   reused,
+			"weak":     weak,
+			"old":      old,
+			"unscored": unscored,
+		},
+	})
+}
@@ -0,0 +1,45 @@
+package controller
+
+import (
+	"errors"
+
+	"github.com/gofiber/fiber/v2"
+	"goPass/config"
+	"goPass/icons"
+)
+
+// GetIcon serves the icon of a website as a square PNG, e.g.
+// /icons/github.com?size=64. It is deliberately public and not logged: the
+// response is the same for everyone and no request can be traced back to
+// the user whose vault it came from.
+func GetIcon(c *fiber.Ctx) error {
+	if config.Icons == nil {
+		return c.Status(fiber.StatusServiceUnavailable).JSON(fiber.Map{
+			"error": "icons are not available on this server",
+		})
+	}
+
+	size := c.QueryInt("size", icons.DefaultSize)
+	data, err := config.Icons.Icon(c.UserContext(), c.Params("domain"), size)
+	if errors.Is(err, icons.ErrInvalidDomain) || errors.Is(err, icons.ErrInvalidSize) {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+	if errors.Is(err, icons.ErrNotFound) {
+		c.Set(fiber.HeaderCacheControl, "public, max-age=3600")
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "no icon for this domain",
+		})
+	}
+	if err != nil {
+		return c.Status(fiber.StatusBadGateway).JSON(fiber.Map{
+			"error": "failed to fetch icon",
+		})
+	}
+
+	c.Set(fiber.HeaderCacheControl, "public, max-age=86400")
+	c.Set(fiber.HeaderContentType, "image/png")
+	c.Set("Referrer-Policy", "no-referrer")
+	return c.Status(fiber.StatusOK).Send(data)
+}
@@ -0,0 +1,695 @@
+package controller
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"reflect"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+	"goPass/audit"
+	"goPass/config"
+	"goPass/importer"
+	"goPass/models"
+	"goPass/vaultexport"
+	"gorm.io/datatypes"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+const importBatchSize = 100
+
+// readImportFile returns the uploaded file, sent either as the multipart
+// field "file" or as the raw body.
+func readImportFile(c *fiber.Ctx) ([]byte, error) {
+	file, err := c.FormFile("file")
+	if err != nil {
+		if len(c.Body()) == 0 {
+			return nil, errors.New("no file to import")
+		}
+		return c.Body(), nil
+	}
+
+	f, err := file.Open()
+	if err != nil {
+		return nil, errors.New("failed to read the file")
+	}
+	defer f.Close()
+	data, err := io.ReadAll(f)
+	if err != nil || len(data) == 0 {
+		return nil, errors.New("failed to read the file")
+	}
+	return data, nil
+}
+
+// ParseImport turns another password manager's export into plaintext items
+// for the client to encrypt. Nothing parsed here is stored or logged.
+func ParseImport(c *fiber.Ctx) error {
+	id := c.Locals("id").(uuid.UUID)
+	format := c.Query("format")
+
+	data, err := readImportFile(c)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+
+	res, err := importer.Parse(format, data)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+
+	existing, err := existingEntryKeys(id)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "failed to check for duplicates",
+		})
+	}
+	for i := range res.Items {
+		key := duplicateKey(res.Items[i].Name, res.Items[i].Username)
+		res.Items[i].Duplicate = existing[key]
+		existing[key] = true
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"message": "parsed import file",
+		"data":    res,
+	})
+}
+
+type ImportItemRequest struct {
+	Row int `json:"row"`
+	CreateVaultRequest
+	FolderID *uuid.UUID `json:"folderid"`
+	Favorite bool       `json:"favorite"`
+}
+
+type CommitImportRequest struct {
+	Items           []ImportItemRequest `json:"items"`
+	AllowDuplicates bool                `json:"allowduplicates"`
+}
+
+// CommitImport stores the encrypted items the client built from ParseImport.
+// Every row is validated on its own and reported back, the valid ones are
+// inserted together. Rows matching an existing entry on PlatformName and
+// EntryKey are skipped unless allowduplicates is set.
+func CommitImport(c *fiber.Ctx) error {
+	id := c.Locals("id").(uuid.UUID)
+	data := CommitImportRequest{}
+	if err := c.BodyParser(&data); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "failed to parse the request",
+		})
+	}
+
+	if len(data.Items) == 0 {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "no items to import",
+		})
+	}
+	if len(data.Items) > importer.MaxItems {
+		return c.Status(fiber.StatusRequestEntityTooLarge).JSON(fiber.Map{
+			"error": importer.ErrTooManyItems.Error(),
+		})
+	}
+
+	existing, err := existingEntryKeys(id)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "failed to check for duplicates",
+		})
+	}
+	folderIds := []uuid.UUID{}
+	if err := config.DB.Model(&models.Folder{}).Where("user_id=?", id).Pluck("id", &folderIds).Error; err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "failed to import vault",
+		})
+	}
+	folders := map[uuid.UUID]bool{}
+	for _, folderId := range folderIds {
+		folders[folderId] = true
+	}
+
+	entries := []models.VaultEntry{}
+	rows := []int{}
+	rowErrors := []importer.RowError{}
+	duplicates := []int{}
+	for _, item := range data.Items {
+		// imports always land in the personal vault
+		item.CollectionID = nil
+
+		key := duplicateKey(item.PlatformName, item.EntryKey)
+		if existing[key] && !data.AllowDuplicates {
+			duplicates = append(duplicates, item.Row)
+			continue
+		}
+		if item.FolderID != nil && !folders[*item.FolderID] {
+			rowErrors = append(rowErrors, importer.RowError{Row: item.Row, Error: "folder not found"})
+			continue
+		}
+
+		entry, err := newVaultEntry(id, item.CreateVaultRequest)
+		if err != nil {
+			rowErrors = append(rowErrors, importer.RowError{Row: item.Row, Error: err.Error()})
+			continue
+		}
+		entry.FolderID = item.FolderID
+		entry.Favorite = item.Favorite
+
+		existing[key] = true
+		entries = append(entries, entry)
+		rows = append(rows, item.Row)
+	}
+
+	if len(entries) > 0 {
+		err := config.DB.Transaction(func(tx *gorm.DB) error {
+			if err := tx.CreateInBatches(&entries, importBatchSize).Error; err != nil {
+				return err
+			}
+			return indexEntryURIs(tx, entries...)
+		})
+		if err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"error": "failed to import vault",
+			})
+		}
+	}
+
+	created := make([]fiber.Map, len(entries))
+	for i, entry := range entries {
+		created[i] = fiber.Map{"row": rows[i], "id": entry.ID}
+	}
+	if len(entries) > 0 {
+		recordEvent(c, models.AuditEvent{UserID: &id, Event: audit.EventVaultImport, Detail: fmt.Sprintf("%d entries created", len(entries))})
+		ids := make([]uuid.UUID, len(entries))
+		for i, entry := range entries {
+			ids[i] = entry.ID
+		}
+		vaultChanged(c, id, ChangeImported, ids...)
+	}
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"message": "vault imported succesfully",
+		"data": fiber.Map{
+			"created":    created,
+			"duplicates": duplicates,
+			"errors":     rowErrors,
+		},
+	})
+}
+
+// existingEntryKeys returns the PlatformName and EntryKey pairs already in
+// the user's personal vault, for duplicate detection.
+func existingEntryKeys(userId uuid.UUID) (map[string]bool, error) {
+	rows := []struct {
+		PlatformName string
+		EntryKey     string
+	}{}
+	err := config.DB.Model(&models.VaultEntry{}).Scopes(personalEntries(userId)).
+		Where("deleted=?", false).
+		Select("platform_name", "entry_key").
+		Find(&rows).Error
+	if err != nil {
+		return nil, err
+	}
+
+	keys := make(map[string]bool, len(rows))
+	for _, row := range rows {
+		keys[duplicateKey(row.PlatformName, row.EntryKey)] = true
+	}
+	return keys, nil
+}
+
+func duplicateKey(platformName, entryKey string) string {
+	return platformName + "\x00" + entryKey
+}
+
+// Merge strategies for restoring a goPass export over an existing vault.
+// Entries are matched on their ID.
+const (
+	MergeSkip      = "skip"
+	MergeOverwrite = "overwrite"
+	MergeKeepBoth  = "keep"
+)
+
+// Actions reported per entry by ImportGoPassExport.
+const (
+	RestoreCreated   = "created"
+	RestoreUpdated   = "updated"
+	RestoreUnchanged = "unchanged"
+	RestoreSkipped   = "skipped"
+	RestoreCopied    = "copied"
+)
+
+var errDryRun = errors.New("dry run")
+
+type RestoreAction struct {
+	ID     string     `json:"id"`
+	Action string     `json:"action"`
+	NewID  *uuid.UUID `json:"newId,omitempty"`
+}
+
+type RestoreResult struct {
+	Strategy       string          `json:"strategy"`
+	DryRun         bool            `json:"dryRun"`
+	FoldersCreated int             `json:"foldersCreated"`
+	TagsCreated    int             `json:"tagsCreated"`
+	Summary        map[string]int  `json:"summary"`
+	Entries        []RestoreAction `json:"entries"`
+}
+
+// ImportGoPassExport restores a vaultexport document into the personal vault.
+// An entry whose ID is not in the vault yet is created with that ID, so
+// restoring the same file twice doesn't duplicate anything. For entries that
+// already exist, strategy picks between skip, overwrite and keep (both, the
+// import getting a new ID). Everything runs in one transaction, with dryrun
+// set it is rolled back and only the report is returned.
+func ImportGoPassExport(c *fiber.Ctx) error {
+	id := c.Locals("id").(uuid.UUID)
+	strategy := c.Query("strategy", MergeSkip)
+	if strategy != MergeSkip && strategy != MergeOverwrite && strategy != MergeKeepBoth {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "strategy must be skip, overwrite or keep",
+		})
+	}
+	dryRun := c.QueryBool("dryrun")
+
+	data, err := readImportFile(c)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+	doc, err := vaultexport.Decode(bytes.NewReader(data))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+	if len(doc.Entries) > importer.MaxItems {
+		return c.Status(fiber.StatusRequestEntityTooLarge).JSON(fiber.Map{
+			"error": importer.ErrTooManyItems.Error(),
+		})
+	}
+
+	// The entries can only be opened with the keys they were exported
+	// with, restoring them under other keys would leave them unreadable.
+	user := models.AppUser{}
+	if err := config.DB.Where("id=?", id).First(&user).Error; err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "user not found",
+		})
+	}
+	master, ok := wrappedMasterKey(user)
+	if !ok || doc.KDF.Salt != *user.MasterSalt || doc.Keys.Master != master {
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{
+			"error": "export was made with different vault keys",
+		})
+	}
+
+	entries := make([]models.VaultEntry, len(doc.Entries))
+	rowErrors := []importer.RowError{}
+	for i, e := range doc.Entries {
+		entry, err := restoredEntry(id, e)
+		if err != nil {
+			rowErrors = append(rowErrors, importer.RowError{Row: i + 1, Error: err.Error()})
+			continue
+		}
+		entries[i] = entry
+	}
+	if len(rowErrors) > 0 {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "export contains invalid entries",
+			"data":  rowErrors,
+		})
+	}
+
+	result := RestoreResult{
+		Strategy: strategy,
+		DryRun:   dryRun,
+		Summary:  map[string]int{},
+		Entries:  make([]RestoreAction, 0, len(entries)),
+	}
+	err = config.DB.Transaction(func(tx *gorm.DB) error {
+		folderIds, created, err := restoreFolders(tx, id, doc.Folders)
+		if err != nil {
+			return err
+		}
+		result.FoldersCreated = created
+		tagIds, created, err := restoreTags(tx, id, doc.Tags)
+		if err != nil {
+			return err
+		}
+		result.TagsCreated = created
+
+		ids := make([]uuid.UUID, len(entries))
+		for i, entry := range entries {
+			ids[i] = entry.ID
+		}
+		existingEntries := []models.VaultEntry{}
+		if err := tx.Where("id IN ?", ids).Preload("Tags").Find(&existingEntries).Error; err != nil {
+			return err
+		}
+		existing := map[uuid.UUID]models.VaultEntry{}
+		for _, entry := range existingEntries {
+			existing[entry.ID] = entry
+		}
+
+		for i, entry := range entries {
+			entry.FolderID = mappedID(folderIds, doc.Entries[i].FolderID)
+			// only used to compare and link, the entry itself is written
+			// without associations
+			for _, tagId := range doc.Entries[i].TagIDs {
+				if mapped := mappedID(tagIds, &tagId); mapped != nil {
+					entry.Tags = append(entry.Tags, models.Tag{ID: *mapped})
+				}
+			}
+
+			action := RestoreAction{ID: entry.ID.String()}
+			current, found := existing[entry.ID]
+			switch {
+			case !found:
+				action.Action = RestoreCreated
+			case current.UserID != id || current.CollectionID != nil, strategy == MergeKeepBoth:
+				// the ID is taken by an entry this vault can't overwrite,
+				// or both versions are wanted
+				entry.ID = uuid.New()
+				action.Action = RestoreCopied
+				action.NewID = &entry.ID
+			case strategy == MergeSkip && !current.Deleted:
+				// a deleted entry is as good as missing and gets revived
+				action.Action = RestoreSkipped
+			case sameEntry(current, entry):
+				action.Action = RestoreUnchanged
+			default:
+				action.Action = RestoreUpdated
+			}
+
+			switch action.Action {
+			case RestoreCreated, RestoreCopied:
+				if err := tx.Omit(clause.Associations).Create(&entry).Error; err != nil {
+					return err
+				}
+				if err := indexEntryURIs(tx, entry); err != nil {
+					return err
+				}
+			case RestoreUpdated:
+				current.ItemType = entry.ItemType
+				current.PlatformName = entry.PlatformName
+				current.EntryKey = entry.EntryKey
+				current.EncryptedPassword = entry.EncryptedPassword
+				current.IV = entry.IV
+				current.EncryptedItemKey = entry.EncryptedItemKey
+				current.Envelope = entry.Envelope
+				current.CustomFields = entry.CustomFields
+				current.URIs = entry.URIs
+				current.TOTP = entry.TOTP
+				current.HasTOTP = entry.HasTOTP
+				current.FolderID = entry.FolderID
+				current.Favorite = entry.Favorite
+				current.Deleted = false
+				if err := tx.Omit(clause.Associations).Save(&current).Error; err != nil {
+					return err
+				}
+				if err := indexEntryURIs(tx, current); err != nil {
+					return err
+				}
+				if err := tx.Exec("DELETE FROM vault_entry_tags WHERE vault_entry_id = ?", current.ID).Error; err != nil {
+					return err
+				}
+			}
+			if action.Action != RestoreSkipped && action.Action != RestoreUnchanged {
+				for _, tag := range entry.Tags {
+					if err := tx.Exec("INSERT INTO vault_entry_tags (vault_entry_id, tag_id) VALUES (?, ?) ON CONFLICT DO NOTHING", entry.ID, tag.ID).Error; err != nil {
+						return err
+					}
+				}
+			}
+
+			result.Summary[action.Action]++
+			result.Entries = append(result.Entries, action)
+		}
+
+		if dryRun {
+			return errDryRun
+		}
+		return nil
+	})
+	if err != nil && !errors.Is(err, errDryRun) {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "failed to import vault",
+		})
+	}
+
+	message := "vault imported succesfully"
+	if dryRun {
+		message = "dry run, nothing was changed"
+	} else {
+		recordEvent(c, models.AuditEvent{UserID: &id, Event: audit.EventVaultImport,
+			Detail: fmt.Sprintf("goPass export, %d created, %d updated, %d copied", result.Summary[RestoreCreated], result.Summary[RestoreUpdated], result.Summary[RestoreCopied])})
+		vaultChanged(c, id, ChangeImported)
+	}
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"message": message,
+		"data":    result,
+	})
+}
+
+// restoredEntry validates an exported entry the same way a create would and
+// keeps its ID and creation time.
+func restoredEntry(userId uuid.UUID, e vaultexport.Entry) (models.VaultEntry, error) {
+	entryId, err := uuid.Parse(e.ID)
+	if err != nil {
+		return models.VaultEntry{}, errors.New("invalid entry id")
+	}
+
+	data := CreateVaultRequest{
+		ItemType:          e.ItemType,
+		PlatformName:      e.PlatformName,
+		EntryKey:          e.EntryKey,
+		EncryptedPassword: e.EncryptedPassword,
+		IV:                e.IV,
+		Envelope:          datatypes.JSON(e.Envelope),
+		CustomFields:      []models.CustomField{},
+		EncryptedItemKey:  e.EncryptedItemKey,
+	}
+	if len(e.CustomFields) > 0 {
+		if err := json.Unmarshal(e.CustomFields, &data.CustomFields); err != nil {
+			return models.VaultEntry{}, errors.New("invalid custom fields")
+		}
+	}
+	if len(e.URIs) > 0 {
+		if err := json.Unmarshal(e.URIs, &data.URIs); err != nil {
+			return models.VaultEntry{}, errors.New("invalid uris")
+		}
+	}
+	if e.TOTP != nil {
+		data.TOTP = &TOTPRequest{
+			EncryptedSeed: e.TOTP.EncryptedSeed,
+			SeedIV:        e.TOTP.SeedIV,
+			Algorithm:     e.TOTP.Algorithm,
+			Digits:        e.TOTP.Digits,
+			Period:        e.TOTP.Period,
+		}
+	}
+
+	entry, err := newVaultEntry(userId, data)
+	if err != nil {
+		return models.VaultEntry{}, err
+	}
+	entry.ID = entryId
+	entry.Favorite = e.Favorite
+	entry.CreatedAt = e.CreatedAt
+	return entry, nil
+}
+
+// restoreFolders creates the exported folders that aren't in the vault yet
+// and returns how old folder IDs map onto the vault's. Existing folders are
+// left as they are, an ID taken by someone else's folder gets a new one.
+func restoreFolders(tx *gorm.DB, userId uuid.UUID, exported []vaultexport.Folder) (map[string]uuid.UUID, int, error) {
+	ids := map[string]uuid.UUID{}
+	for _, f := range exported {
+		if folderId, err := uuid.Parse(f.ID); err == nil {
+			ids[f.ID] = folderId
+		}
+	}
+	owners, err := ownersOf(tx, &models.Folder{}, ids)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	pending := []vaultexport.Folder{}
+	for _, f := range exported {
+		folderId, ok := ids[f.ID]
+		if !ok {
+			continue
+		}
+		owner, found := owners[folderId]
+		if found && owner == userId {
+			continue
+		}
+		if found {
+			ids[f.ID] = uuid.New()
+		}
+		pending = append(pending, f)
+	}
+
+	// parents can only be resolved once every folder has its final ID
+	folders := make([]models.Folder, len(pending))
+	for i, f := range pending {
+		folders[i] = models.Folder{
+			ID:            ids[f.ID],
+			UserID:        userId,
+			ParentID:      mappedID(ids, f.ParentID),
+			EncryptedName: f.EncryptedName,
+			IV:            f.IV,
+		}
+	}
+
+	if len(folders) > 0 {
+		if err := tx.Omit(clause.Associations).Create(&folders).Error; err != nil {
+			return nil, 0, err
+		}
+	}
+	return ids, len(folders), nil
+}
+
+// restoreTags does for tags what restoreFolders does for folders.
+func restoreTags(tx *gorm.DB, userId uuid.UUID, exported []vaultexport.Tag) (map[string]uuid.UUID, int, error) {
+	ids := map[string]uuid.UUID{}
+	for _, t := range exported {
+		if tagId, err := uuid.Parse(t.ID); err == nil {
+			ids[t.ID] = tagId
+		}
+	}
+	owners, err := ownersOf(tx, &models.Tag{}, ids)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	tags := []models.Tag{}
+	for _, t := range exported {
+		tagId, ok := ids[t.ID]
+		if !ok {
+			continue
+		}
+		owner, found := owners[tagId]
+		if found && owner == userId {
+			continue
+		}
+		if found {
+			ids[t.ID] = uuid.New()
+		}
+		tags = append(tags, models.Tag{
+			ID:            ids[t.ID],
+			UserID:        userId,
+			EncryptedName: t.EncryptedName,
+			IV:            t.IV,
+		})
+	}
+
+	if len(tags) > 0 {
+		if err := tx.Omit(clause.Associations).Create(&tags).Error; err != nil {
+			return nil, 0, err
+		}
+	}
+	return ids, len(tags), nil
+}
+
+// ownersOf returns who owns the rows of model with the given IDs.
+func ownersOf(tx *gorm.DB, model interface{}, ids map[string]uuid.UUID) (map[uuid.UUID]uuid.UUID, error) {
+	owners := map[uuid.UUID]uuid.UUID{}
+	if len(ids) == 0 {
+		return owners, nil
+	}
+	list := make([]uuid.UUID, 0, len(ids))
+	for _, id := range ids {
+		list = append(list, id)
+	}
+
+	rows := []struct {
+		ID     uuid.UUID
+		UserID uuid.UUID
+	}{}
+	if err := tx.Model(model).Select("id", "user_id").Where("id IN ?", list).Find(&rows).Error; err != nil {
+		return nil, err
+	}
+	for _, row := range rows {
+		owners[row.ID] = row.UserID
+	}
+	return owners, nil
+}
+
+func mappedID(ids map[string]uuid.UUID, old *string) *uuid.UUID {
+	if old == nil {
+		return nil
+	}
+	id, ok := ids[*old]
+	if !ok {
+		return nil
+	}
+	return &id
+}
+
+// sameEntry reports whether restoring b over a would change anything the
+// user can see.
+func sameEntry(a, b models.VaultEntry) bool {
+	if a.Deleted || a.ItemType != b.ItemType || a.PlatformName != b.PlatformName || a.EntryKey != b.EntryKey ||
+		a.Favorite != b.Favorite || !bytes.Equal(a.EncryptedPassword, b.EncryptedPassword) || !bytes.Equal(a.IV, b.IV) ||
+		!bytes.Equal(a.EncryptedItemKey, b.EncryptedItemKey) || a.HasTOTP != b.HasTOTP {
+		return false
+	}
+	if (a.FolderID == nil) != (b.FolderID == nil) || (a.FolderID != nil && *a.FolderID != *b.FolderID) {
+		return false
+	}
+	if a.HasTOTP && !reflect.DeepEqual(a.TOTP, b.TOTP) {
+		return false
+	}
+	if len(a.CustomFields) != len(b.CustomFields) || (len(a.CustomFields) > 0 && !reflect.DeepEqual(a.CustomFields, b.CustomFields)) {
+		return false
+	}
+	if len(a.URIs) != len(b.URIs) || (len(a.URIs) > 0 && !reflect.DeepEqual(a.URIs, b.URIs)) {
+		return false
+	}
+	if !sameTags(a.Tags, b.Tags) {
+		return false
+	}
+	return sameJSON(a.Envelope, b.Envelope)
+}
+
+// sameTags compares the tags of two entries as sets of IDs.
+func sameTags(a, b []models.Tag) bool {
+	ids := map[uuid.UUID]bool{}
+	for _, tag := range a {
+		ids[tag.ID] = true
+	}
+	other := map[uuid.UUID]bool{}
+	for _, tag := range b {
+		if !ids[tag.ID] {
+			return false
+		}
+		other[tag.ID] = true
+	}
+	return len(ids) == len(other)
+}
+
+// sameJSON compares two JSON values ignoring key order and whitespace, which
+// Postgres doesn't keep for jsonb.
+func sameJSON(a, b []byte) bool {
+	var va, vb interface{}
+	if len(a) == 0 {
+		a = []byte("{}")
+	}
+	if len(b) == 0 {
+		b = []byte("{}")
+	}
+	if json.Unmarshal(a, &va) != nil || json.Unmarshal(b, &vb) != nil {
+		return false
+	}
+	return reflect.DeepEqual(va, vb)
+}
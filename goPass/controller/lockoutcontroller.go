@@ -0,0 +1,146 @@
+package controller
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"html/template"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"goPass/audit"
+	"goPass/config"
+	"goPass/models"
+	"goPass/notify"
+	"goPass/ratelimit"
+)
+
+func hashUnlockToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// lockAccount locks user out of password logins for LockoutFor and mails
+// them a link that lifts the lock early.
+func lockAccount(c *fiber.Ctx, user models.AppUser, failures int) error {
+	raw := make([]byte, 32)
+	if _, err := rand.Read(raw); err != nil {
+		return err
+	}
+	token := base64.RawURLEncoding.EncodeToString(raw)
+	until := time.Now().Add(config.Limiter.LockoutFor)
+
+	err := config.DB.Model(&models.AppUser{}).Where("id=?", user.ID).Updates(map[string]any{
+		"locked_until":      until,
+		"unlock_token_hash": hashUnlockToken(token),
+	}).Error
+	if err != nil {
+		return err
+	}
+
+	recordEvent(c, models.AuditEvent{UserID: &user.ID, Event: audit.EventAccountLock, Detail: fmt.Sprintf("%d failed logins", failures)})
+	link := config.PublicURL + "/auth/unlock?token=" + url.QueryEscape(token)
+	notify.User(user.ID, "Your goPass account is locked",
+		fmt.Sprintf("There were %d failed attempts to sign in to your goPass account, so password sign-ins are blocked until %s.\n\n"+
+			"If this was you, open this link to unlock your account now:\n%s\n\n"+
+			"If it wasn't, someone may be guessing your password. Your vault stays encrypted with your master password either way.",
+			failures, until.UTC().Format(time.RFC1123), link))
+	return nil
+}
+
+// unlockPage is what the link in the lockout mail opens. Opening a link
+// must not change anything, mail scanners and link previews open them too,
+// so the page only asks to confirm and the unlock happens on the POST.
+var unlockPage = template.Must(template.New("unlock").Parse(`<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<meta name="viewport" content="width=device-width, initial-scale=1">
+<title>Unlock your goPass account</title>
+</head>
+<body>
+{{if .Message}}<p>{{.Message}}</p>{{else}}<form method="post" action="unlock">
+<p>Unlock your goPass account so you can sign in with your password again.</p>
+<input type="hidden" name="token" value="{{.Token}}">
+<button type="submit">Unlock my account</button>
+</form>{{end}}
+</body>
+</html>
+`))
+
+type unlockPageData struct {
+	Token   string
+	Message string
+}
+
+func renderUnlockPage(c *fiber.Ctx, status int, data unlockPageData) error {
+	// the token is in the URL, it must not leak to anything the page loads
+	c.Set("Referrer-Policy", "no-referrer")
+	c.Set("Content-Security-Policy", "default-src 'none'; form-action 'self'")
+	c.Set(fiber.HeaderCacheControl, "no-store")
+	c.Type("html", "utf-8")
+	c.Status(status)
+	return unlockPage.Execute(c.Response().BodyWriter(), data)
+}
+
+// UnlockAccountPage shows the confirmation page for the link in the
+// lockout mail.
+func UnlockAccountPage(c *fiber.Ctx) error {
+	token := c.Query("token")
+	if token == "" {
+		return renderUnlockPage(c, fiber.StatusBadRequest, unlockPageData{Message: "This unlock link is incomplete."})
+	}
+	return renderUnlockPage(c, fiber.StatusOK, unlockPageData{Token: token})
+}
+
+type UnlockAccountRequest struct {
+	Token string `json:"token" form:"token"`
+}
+
+// UnlockAccount lifts a lockout with the token from the lockout mail. The
+// confirmation page posts a form and gets a page back, API clients post
+// JSON and get JSON.
+func UnlockAccount(c *fiber.Ctx) error {
+	fromPage := strings.HasPrefix(string(c.Request().Header.ContentType()), fiber.MIMEApplicationForm)
+	fail := func(status int, message string) error {
+		if fromPage {
+			return renderUnlockPage(c, status, unlockPageData{Message: "Your account could not be unlocked: " + message + "."})
+		}
+		return c.Status(status).JSON(fiber.Map{
+			"error": message,
+		})
+	}
+
+	data := UnlockAccountRequest{}
+	if err := c.BodyParser(&data); err != nil || data.Token == "" {
+		return fail(fiber.StatusBadRequest, "missing unlock token")
+	}
+
+	user := models.AppUser{}
+	if err := config.DB.Where("unlock_token_hash=?", hashUnlockToken(data.Token)).Select("id", "email").First(&user).Error; err != nil {
+		return fail(fiber.StatusBadRequest, "invalid or used unlock token")
+	}
+
+	err := config.DB.Model(&models.AppUser{}).Where("id=?", user.ID).Updates(map[string]any{
+		"locked_until":      nil,
+		"unlock_token_hash": "",
+	}).Error
+	if err != nil {
+		return fail(fiber.StatusInternalServerError, "failed to unlock account")
+	}
+	if err := config.Limiter.Reset(c.UserContext(), ratelimit.Account(user.Email)); err != nil {
+		return fail(fiber.StatusInternalServerError, "failed to unlock account")
+	}
+
+	recordEvent(c, models.AuditEvent{UserID: &user.ID, Event: audit.EventAccountUnlock})
+	if fromPage {
+		return renderUnlockPage(c, fiber.StatusOK, unlockPageData{Message: "Your account is unlocked, you can sign in again."})
+	}
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"message": "account unlocked succesfully",
+	})
+}
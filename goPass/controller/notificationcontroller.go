@@ -0,0 +1,77 @@
+package controller
+
+import (
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+	"goPass/config"
+	"goPass/notify"
+	"gorm.io/gorm/clause"
+)
+
+func GetNotificationPreferences(c *fiber.Ctx) error {
+	id := c.Locals("id").(uuid.UUID)
+
+	prefs, err := notify.Preferences(id)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "failed to fetch notification preferences",
+		})
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"message": "fetched notification preferences",
+		"data":    prefs,
+	})
+}
+
+// UpdateNotificationPreferencesRequest leaves out what the user didn't
+// change.
+type UpdateNotificationPreferencesRequest struct {
+	LoginEmail  *bool `json:"loginemail"`
+	LoginPush   *bool `json:"loginpush"`
+	DeviceEmail *bool `json:"deviceemail"`
+	DevicePush  *bool `json:"devicepush"`
+}
+
+func UpdateNotificationPreferences(c *fiber.Ctx) error {
+	id := c.Locals("id").(uuid.UUID)
+	data := UpdateNotificationPreferencesRequest{}
+	if err := c.BodyParser(&data); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "failed to parse the request",
+		})
+	}
+
+	prefs, err := notify.Preferences(id)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "failed to update notification preferences",
+		})
+	}
+	if data.LoginEmail != nil {
+		prefs.LoginEmail = *data.LoginEmail
+	}
+	if data.LoginPush != nil {
+		prefs.LoginPush = *data.LoginPush
+	}
+	if data.DeviceEmail != nil {
+		prefs.DeviceEmail = *data.DeviceEmail
+	}
+	if data.DevicePush != nil {
+		prefs.DevicePush = *data.DevicePush
+	}
+
+	if err := config.DB.Omit(clause.Associations).Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "user_id"}},
+		DoUpdates: clause.AssignmentColumns([]string{"login_email", "login_push", "device_email", "device_push", "updated_at"}),
+	}).Create(&prefs).Error; err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "failed to update notification preferences",
+		})
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"message": "notification preferences updated succesfully",
+		"data":    prefs,
+	})
+}
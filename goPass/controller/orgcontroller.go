@@ -0,0 +1,604 @@
+package controller
+
+import (
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+	"goPass/config"
+	"goPass/models"
+	"gorm.io/gorm"
+)
+
+type CreateOrgRequest struct {
+	Name            string `json:"name"`
+	EncryptedOrgKey []byte `json:"encryptedorgkey"`
+}
+
+// CreateOrganization makes the caller the first owner. The client generates
+// the org key and sends it wrapped with the caller's own public key.
+func CreateOrganization(c *fiber.Ctx) error {
+	id := c.Locals("id").(uuid.UUID)
+	data := CreateOrgRequest{}
+	if err := c.BodyParser(&data); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "failed to parse the request",
+		})
+	}
+
+	if data.Name == "" || len(data.EncryptedOrgKey) == 0 {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "name and encryptedorgkey are required",
+		})
+	}
+
+	org := models.Organization{
+		ID:   uuid.New(),
+		Name: data.Name,
+	}
+	owner := models.Membership{
+		ID:              uuid.New(),
+		OrganizationID:  org.ID,
+		UserID:          id,
+		Role:            models.RoleOwner,
+		Status:          models.MembershipConfirmed,
+		EncryptedOrgKey: data.EncryptedOrgKey,
+	}
+
+	err := config.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&org).Error; err != nil {
+			return err
+		}
+		return tx.Create(&owner).Error
+	})
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "failed to create organization",
+		})
+	}
+
+	return c.Status(fiber.StatusCreated).JSON(fiber.Map{
+		"message": "organization created succesfully",
+		"data":    org,
+	})
+}
+
+// ListOrganizations returns the caller's memberships, pending invites
+// included, each with the organization and the caller's wrapped org key.
+func ListOrganizations(c *fiber.Ctx) error {
+	id := c.Locals("id").(uuid.UUID)
+
+	type orgRow struct {
+		OrganizationID  uuid.UUID `json:"organizationId"`
+		Name            string    `json:"name"`
+		Role            string    `json:"role"`
+		Status          string    `json:"status"`
+		EncryptedOrgKey []byte    `json:"encryptedOrgKey"`
+	}
+
+	rows := []orgRow{}
+	if err := config.DB.Model(&models.Membership{}).
+		Select("memberships.organization_id, organizations.name, memberships.role, memberships.status, memberships.encrypted_org_key").
+		Joins("JOIN organizations ON organizations.id = memberships.organization_id").
+		Where("memberships.user_id=?", id).
+		Scan(&rows).Error; err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "failed to fetch organizations",
+		})
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"message": "fetched the list of organizations",
+		"data":    rows,
+	})
+}
+
+func DeleteOrganization(c *fiber.Ctx) error {
+	id := c.Locals("id").(uuid.UUID)
+	orgId := c.Params("orgId")
+
+	membership, err := loadMembership(id, orgId)
+	if err != nil || membership.Role != models.RoleOwner {
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
+			"error": "only owners can delete an organization",
+		})
+	}
+
+	collections := config.DB.Model(&models.Collection{}).Select("id").Where("organization_id=?", membership.OrganizationID)
+	ids := collectionEntryIDs(collections)
+	audience := changeAudience(id, ids)
+
+	var attachments []models.Attachment
+	err = config.DB.Transaction(func(tx *gorm.DB) error {
+		var err error
+		if attachments, err = retireCollections(tx, collections, ids); err != nil {
+			return err
+		}
+		return tx.Delete(&models.Organization{ID: membership.OrganizationID}).Error
+	})
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "failed to delete organization",
+		})
+	}
+	for _, att := range attachments {
+		deleteAttachmentBlobs(c.UserContext(), att)
+	}
+	publishChange(c, audience, ChangeDeleted, ids)
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"message": "organization deleted succesfully",
+	})
+}
+
+type InviteMemberRequest struct {
+	Email           string `json:"email"`
+	Role            string `json:"role"`
+	EncryptedOrgKey []byte `json:"encryptedorgkey"`
+}
+
+// InviteMember adds a pending membership. The inviter wraps the org key
+// with the invitee's public key, fetched from /share/publickey.
+func InviteMember(c *fiber.Ctx) error {
+	id := c.Locals("id").(uuid.UUID)
+	orgId := c.Params("orgId")
+	data := InviteMemberRequest{}
+	if err := c.BodyParser(&data); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "failed to parse the request",
+		})
+	}
+
+	inviter, err := loadMembership(id, orgId)
+	if err != nil || !inviter.CanManage() {
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
+			"error": "only owners and admins can invite members",
+		})
+	}
+
+	if data.Role == "" {
+		data.Role = models.RoleMember
+	}
+	if data.Role != models.RoleOwner && data.Role != models.RoleAdmin && data.Role != models.RoleMember {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "role must be owner, admin or member",
+		})
+	}
+	if data.Role == models.RoleOwner && inviter.Role != models.RoleOwner {
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
+			"error": "only owners can invite owners",
+		})
+	}
+	if data.Email == "" || len(data.EncryptedOrgKey) == 0 {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "email and encryptedorgkey are required",
+		})
+	}
+
+	invitee := models.AppUser{}
+	if err := config.DB.Where("email=?", data.Email).Select("id", "public_key").First(&invitee).Error; err != nil || invitee.PublicKey == "" {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "user not found or has no public key",
+		})
+	}
+
+	membership := models.Membership{
+		ID:              uuid.New(),
+		OrganizationID:  inviter.OrganizationID,
+		UserID:          invitee.ID,
+		Role:            data.Role,
+		Status:          models.MembershipInvited,
+		EncryptedOrgKey: data.EncryptedOrgKey,
+	}
+	if err := config.DB.Create(&membership).Error; err != nil {
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{
+			"error": "user is already a member or invited",
+		})
+	}
+
+	return c.Status(fiber.StatusCreated).JSON(fiber.Map{
+		"message": "member invited succesfully",
+		"data":    membership,
+	})
+}
+
+func AcceptOrgInvite(c *fiber.Ctx) error {
+	id := c.Locals("id").(uuid.UUID)
+	orgId := c.Params("orgId")
+
+	res := config.DB.Model(&models.Membership{}).
+		Where("organization_id=? AND user_id=? AND status=?", orgId, id, models.MembershipInvited).
+		Update("status", models.MembershipConfirmed)
+	if res.Error != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "failed to accept invite",
+		})
+	}
+	if res.RowsAffected == 0 {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "invite not found",
+		})
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"message": "joined organization succesfully",
+	})
+}
+
+func ListMembers(c *fiber.Ctx) error {
+	id := c.Locals("id").(uuid.UUID)
+	orgId := c.Params("orgId")
+
+	if _, err := loadMembership(id, orgId); err != nil {
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
+			"error": "not a member of this organization",
+		})
+	}
+
+	type memberRow struct {
+		UserID    uuid.UUID `json:"userId"`
+		Email     string    `json:"email"`
+		FullName  string    `json:"fullName"`
+		Role      string    `json:"role"`
+		Status    string    `json:"status"`
+		CreatedAt time.Time `json:"createdAt"`
+	}
+
+	rows := []memberRow{}
+	if err := config.DB.Model(&models.Membership{}).
+		Select("memberships.user_id, app_users.email, app_users.full_name, memberships.role, memberships.status, memberships.created_at").
+		Joins("JOIN app_users ON app_users.id = memberships.user_id").
+		Where("memberships.organization_id=?", orgId).
+		Scan(&rows).Error; err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "failed to fetch members",
+		})
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"message": "fetched the list of members",
+		"data":    rows,
+	})
+}
+
+type ChangeRoleRequest struct {
+	UserID uuid.UUID `json:"userid"`
+	Role   string    `json:"role"`
+}
+
+// ChangeMemberRole lets owners set any role and admins move people between
+// admin and member. Owners can only be changed by owners.
+func ChangeMemberRole(c *fiber.Ctx) error {
+	id := c.Locals("id").(uuid.UUID)
+	orgId := c.Params("orgId")
+	data := ChangeRoleRequest{}
+	if err := c.BodyParser(&data); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "failed to parse the request",
+		})
+	}
+
+	actor, err := loadMembership(id, orgId)
+	if err != nil || !actor.CanManage() {
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
+			"error": "only owners and admins can change roles",
+		})
+	}
+	if data.Role != models.RoleOwner && data.Role != models.RoleAdmin && data.Role != models.RoleMember {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "role must be owner, admin or member",
+		})
+	}
+
+	target := models.Membership{}
+	if err := config.DB.Where("organization_id=? AND user_id=?", orgId, data.UserID).First(&target).Error; err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "member not found",
+		})
+	}
+	if (data.Role == models.RoleOwner || target.Role == models.RoleOwner) && actor.Role != models.RoleOwner {
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
+			"error": "only owners can change owners",
+		})
+	}
+	if target.Role == models.RoleOwner && data.Role != models.RoleOwner && countOwners(target.OrganizationID) <= 1 {
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{
+			"error": "an organization needs at least one owner",
+		})
+	}
+
+	if err := config.DB.Model(&target).Update("role", data.Role).Error; err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "failed to change role",
+		})
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"message": "role changed succesfully",
+	})
+}
+
+// RemoveMember removes someone from the organization, or lets a member
+// leave when they pass their own id. Their collection grants go with them.
+func RemoveMember(c *fiber.Ctx) error {
+	id := c.Locals("id").(uuid.UUID)
+	orgId := c.Params("orgId")
+	userId, err := uuid.Parse(c.Params("userId"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "invalid user id",
+		})
+	}
+
+	target := models.Membership{}
+	if err := config.DB.Where("organization_id=? AND user_id=?", orgId, userId).First(&target).Error; err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "member not found",
+		})
+	}
+
+	if userId != id {
+		actor, err := loadMembership(id, orgId)
+		if err != nil || !actor.CanManage() || (target.Role == models.RoleOwner && actor.Role != models.RoleOwner) {
+			return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
+				"error": "not allowed to remove this member",
+			})
+		}
+	}
+	if target.Role == models.RoleOwner && countOwners(target.OrganizationID) <= 1 {
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{
+			"error": "an organization needs at least one owner",
+		})
+	}
+
+	err = config.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("user_id=? AND collection_id IN (?)", userId,
+			tx.Model(&models.Collection{}).Select("id").Where("organization_id=?", target.OrganizationID)).
+			Delete(&models.CollectionMember{}).Error; err != nil {
+			return err
+		}
+		return tx.Delete(&target).Error
+	})
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "failed to remove member",
+		})
+	}
+	collectionAccessLost(c, userId, config.DB.Model(&models.Collection{}).Select("id").Where("organization_id=?", target.OrganizationID))
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"message": "member removed succesfully",
+	})
+}
+
+// collectionEntryIDs returns the live entries of the given collections.
+func collectionEntryIDs(collections *gorm.DB) []uuid.UUID {
+	var ids []uuid.UUID
+	config.DB.Model(&models.VaultEntry{}).
+		Where("collection_id IN (?) AND deleted=?", collections, false).
+		Pluck("id", &ids)
+	return ids
+}
+
+// retireCollections turns the entries of collections that are about to be
+// deleted into tombstones, like DeleteVaultItem does. The tombstones are
+// moved out of the collections so the delete doesn't cascade them away and
+// stay with whoever created them.
+func retireCollections(tx *gorm.DB, collections *gorm.DB, ids []uuid.UUID) ([]models.Attachment, error) {
+	attachments, err := retireEntries(tx, ids)
+	if err != nil {
+		return nil, err
+	}
+	err = tx.Model(&models.VaultEntry{}).Where("collection_id IN (?)", collections).
+		Updates(map[string]interface{}{"collection_id": nil, "deleted": true}).Error
+	return attachments, err
+}
+
+// collectionAccessLost tells a user to drop the entries of collections
+// they may no longer reach. Call it once the grant or membership is gone.
+// Owners and admins reach every collection of their organization, so losing
+// a single grant doesn't take anything away from them.
+func collectionAccessLost(c *fiber.Ctx, userId uuid.UUID, collections *gorm.DB) {
+	var ids []uuid.UUID
+	config.DB.Model(&models.VaultEntry{}).
+		Where("collection_id IN (?) AND deleted=?", collections, false).
+		Where("collection_id NOT IN (?)", collectionIDs(userId, false)).
+		Pluck("id", &ids)
+	if len(ids) > 0 {
+		publishChange(c, []uuid.UUID{userId}, ChangeDeleted, ids)
+	}
+}
+
+func countOwners(orgId uuid.UUID) int64 {
+	var count int64
+	config.DB.Model(&models.Membership{}).
+		Where("organization_id=? AND role=? AND status=?", orgId, models.RoleOwner, models.MembershipConfirmed).
+		Count(&count)
+	return count
+}
+
+type CreateCollectionRequest struct {
+	EncryptedName []byte `json:"encryptedname"`
+	IV            []byte `json:"iv"`
+}
+
+func CreateCollection(c *fiber.Ctx) error {
+	id := c.Locals("id").(uuid.UUID)
+	orgId := c.Params("orgId")
+	data := CreateCollectionRequest{}
+	if err := c.BodyParser(&data); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "failed to parse the request",
+		})
+	}
+
+	membership, err := loadMembership(id, orgId)
+	if err != nil || !membership.CanManage() {
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
+			"error": "only owners and admins can create collections",
+		})
+	}
+	if len(data.EncryptedName) == 0 || len(data.IV) == 0 {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "EncryptedName and IV cannot be empty",
+		})
+	}
+
+	collection := models.Collection{
+		ID:             uuid.New(),
+		OrganizationID: membership.OrganizationID,
+		EncryptedName:  data.EncryptedName,
+		IV:             data.IV,
+	}
+	if err := config.DB.Create(&collection).Error; err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "failed to create collection",
+		})
+	}
+
+	return c.Status(fiber.StatusCreated).JSON(fiber.Map{
+		"message": "collection created succesfully",
+		"data":    collection,
+	})
+}
+
+// ListCollections returns the collections of an organization the caller
+// can reach.
+func ListCollections(c *fiber.Ctx) error {
+	id := c.Locals("id").(uuid.UUID)
+	orgId := c.Params("orgId")
+
+	collections := []models.Collection{}
+	if err := config.DB.Where("organization_id=? AND id IN (?)", orgId, collectionIDs(id, false)).
+		Find(&collections).Error; err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "failed to fetch collections",
+		})
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"message": "fetched the list of collections",
+		"data":    collections,
+	})
+}
+
+// DeleteCollection deletes the collection. Its entries become tombstones.
+func DeleteCollection(c *fiber.Ctx) error {
+	id := c.Locals("id").(uuid.UUID)
+	orgId := c.Params("orgId")
+	collectionId := c.Params("collectionId")
+
+	membership, err := loadMembership(id, orgId)
+	if err != nil || !membership.CanManage() {
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
+			"error": "only owners and admins can delete collections",
+		})
+	}
+
+	collection := models.Collection{}
+	if err := config.DB.Where("id=? AND organization_id=?", collectionId, membership.OrganizationID).First(&collection).Error; err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "collection not found",
+		})
+	}
+
+	collections := config.DB.Model(&models.Collection{}).Select("id").Where("id=?", collection.ID)
+	ids := collectionEntryIDs(collections)
+	audience := changeAudience(id, ids)
+
+	var attachments []models.Attachment
+	err = config.DB.Transaction(func(tx *gorm.DB) error {
+		var err error
+		if attachments, err = retireCollections(tx, collections, ids); err != nil {
+			return err
+		}
+		return tx.Delete(&collection).Error
+	})
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "failed to delete collection",
+		})
+	}
+	for _, att := range attachments {
+		deleteAttachmentBlobs(c.UserContext(), att)
+	}
+	publishChange(c, audience, ChangeDeleted, ids)
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"message": "collection deleted succesfully",
+	})
+}
+
+type CollectionAccessRequest struct {
+	UserID   uuid.UUID `json:"userid"`
+	ReadOnly bool      `json:"readonly"`
+	Remove   bool      `json:"remove"`
+}
+
+// SetCollectionAccess grants, changes or removes a member's access to a
+// collection.
+func SetCollectionAccess(c *fiber.Ctx) error {
+	id := c.Locals("id").(uuid.UUID)
+	orgId := c.Params("orgId")
+	collectionId := c.Params("collectionId")
+	data := CollectionAccessRequest{}
+	if err := c.BodyParser(&data); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "failed to parse the request",
+		})
+	}
+
+	membership, err := loadMembership(id, orgId)
+	if err != nil || !membership.CanManage() {
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
+			"error": "only owners and admins can manage collection access",
+		})
+	}
+
+	collection := models.Collection{}
+	if err := config.DB.Where("id=? AND organization_id=?", collectionId, membership.OrganizationID).First(&collection).Error; err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "collection not found",
+		})
+	}
+
+	collections := config.DB.Model(&models.Collection{}).Select("id").Where("id=?", collection.ID)
+	if data.Remove {
+		if err := config.DB.Where("collection_id=? AND user_id=?", collection.ID, data.UserID).Delete(&models.CollectionMember{}).Error; err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"error": "failed to update collection access",
+			})
+		}
+		collectionAccessLost(c, data.UserID, collections)
+		return c.Status(fiber.StatusOK).JSON(fiber.Map{
+			"message": "collection access removed",
+		})
+	}
+
+	var count int64
+	config.DB.Model(&models.Membership{}).Where("organization_id=? AND user_id=?", membership.OrganizationID, data.UserID).Count(&count)
+	if count == 0 {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "member not found",
+		})
+	}
+
+	grant := models.CollectionMember{
+		CollectionID: collection.ID,
+		UserID:       data.UserID,
+		ReadOnly:     data.ReadOnly,
+	}
+	if err := config.DB.Save(&grant).Error; err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "failed to update collection access",
+		})
+	}
+	// the entries are new to the member, or what they may do with them changed
+	if ids := collectionEntryIDs(collections); len(ids) > 0 {
+		publishChange(c, []uuid.UUID{data.UserID}, ChangeUpdated, ids)
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"message": "collection access updated",
+	})
+}
@@ -0,0 +1,36 @@
+package controller
+
+import (
+	"errors"
+
+	"github.com/gofiber/fiber/v2"
+	"goPass/breach"
+	"goPass/config"
+)
+
+// BreachRange serves a k-anonymity range for the first five hex characters
+// of a SHA-1 hash. The body is plain "SUFFIX:COUNT" lines like the Pwned
+// Passwords API, padded with zero count lines the client has to ignore.
+func BreachRange(c *fiber.Ctx) error {
+	if config.Breach == nil {
+		return c.Status(fiber.StatusServiceUnavailable).JSON(fiber.Map{
+			"error": "breach checks are not available on this server",
+		})
+	}
+
+	body, err := config.Breach.Range(c.UserContext(), c.Params("prefix"))
+	if errors.Is(err, breach.ErrInvalidPrefix) {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+	if err != nil {
+		return c.Status(fiber.StatusBadGateway).JSON(fiber.Map{
+			"error": "failed to fetch breach range",
+		})
+	}
+
+	c.Set(fiber.HeaderCacheControl, "private, max-age=3600")
+	c.Set(fiber.HeaderContentType, fiber.MIMETextPlainCharsetUTF8)
+	return c.Status(fiber.StatusOK).SendString(body)
+}
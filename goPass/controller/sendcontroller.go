@@ -0,0 +1,235 @@
+package controller
+
+import (
+	"errors"
+	"log"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+	"goPass/config"
+	"goPass/models"
+	"golang.org/x/crypto/bcrypt"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+const (
+	maxSendPayloadSize = 512 * 1024
+	maxSendViews       = 100
+	maxSendLifetime    = 30 * 24 * time.Hour
+	// a send protected by a password is deleted after this many wrong
+	// guesses, on top of the per IP limit on the access route
+	maxSendPasswordAttempts = 10
+)
+
+var errSendGone = errors.New("send not found or expired")
+
+type CreateSendRequest struct {
+	EncryptedPayload []byte `json:"encryptedpayload"`
+	IV               []byte `json:"iv"`
+	ExpiresInHours   int    `json:"expiresinhours"`
+	MaxViews         int    `json:"maxviews"`
+	Password         string `json:"password"`
+}
+
+func CreateSend(c *fiber.Ctx) error {
+	id := c.Locals("id").(uuid.UUID)
+	data := CreateSendRequest{}
+	if err := c.BodyParser(&data); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "failed to parse the request",
+		})
+	}
+
+	if len(data.EncryptedPayload) == 0 || len(data.IV) == 0 {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "EncryptedPayload and IV cannot be empty",
+		})
+	}
+	if len(data.EncryptedPayload) > maxSendPayloadSize {
+		return c.Status(fiber.StatusRequestEntityTooLarge).JSON(fiber.Map{
+			"error": "payload too large",
+		})
+	}
+
+	lifetime := time.Duration(data.ExpiresInHours) * time.Hour
+	if lifetime <= 0 || lifetime > maxSendLifetime {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "expiresinhours must be between 1 and 720",
+		})
+	}
+	if data.MaxViews < 1 || data.MaxViews > maxSendViews {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "maxviews must be between 1 and 100",
+		})
+	}
+
+	send := models.Send{
+		ID:               uuid.New(),
+		UserID:           id,
+		EncryptedPayload: data.EncryptedPayload,
+		IV:               data.IV,
+		MaxViews:         data.MaxViews,
+		ExpiresAt:        time.Now().Add(lifetime),
+	}
+	if data.Password != "" {
+		hash, err := bcrypt.GenerateFromPassword([]byte(data.Password), 10)
+		if err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"error": "failed to encrypt password",
+			})
+		}
+		send.PasswordHash = string(hash)
+	}
+
+	if err := config.DB.Create(&send).Error; err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "failed to create send",
+		})
+	}
+
+	return c.Status(fiber.StatusCreated).JSON(fiber.Map{
+		"message": "send created succesfully",
+		"data": fiber.Map{
+			"id":        send.ID,
+			"expiresAt": send.ExpiresAt,
+			"maxViews":  send.MaxViews,
+		},
+	})
+}
+
+func ListSends(c *fiber.Ctx) error {
+	id := c.Locals("id").(uuid.UUID)
+
+	sends := []models.Send{}
+	if err := config.DB.Where("user_id=? AND expires_at > ?", id, time.Now()).
+		Omit("encrypted_payload").
+		Find(&sends).Error; err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "failed to fetch sends",
+		})
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"message": "fetched the list of sends",
+		"data":    sends,
+	})
+}
+
+func DeleteSend(c *fiber.Ctx) error {
+	id := c.Locals("id").(uuid.UUID)
+	sendId := c.Params("sendId")
+
+	res := config.DB.Where("id=? AND user_id=?", sendId, id).Delete(&models.Send{})
+	if res.Error != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "failed to delete send",
+		})
+	}
+	if res.RowsAffected == 0 {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "send not found",
+		})
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"message": "send deleted succesfully",
+	})
+}
+
+type AccessSendRequest struct {
+	Password string `json:"password"`
+}
+
+// AccessSend is the public endpoint behind a send link. It is a POST so link
+// previews and crawlers fetching the URL don't burn views. Each successful
+// call uses up one view, the send is deleted with its last one.
+func AccessSend(c *fiber.Ctx) error {
+	sendId, err := uuid.Parse(c.Params("sendId"))
+	if err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": errSendGone.Error(),
+		})
+	}
+
+	data := AccessSendRequest{}
+	if len(c.Body()) > 0 {
+		if err := c.BodyParser(&data); err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": "failed to parse the request",
+			})
+		}
+	}
+
+	send := models.Send{}
+	var wrongPassword bool
+	err = config.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			Where("id=? AND expires_at > ? AND view_count < max_views", sendId, time.Now()).
+			First(&send).Error; err != nil {
+			return errSendGone
+		}
+
+		if send.PasswordHash != "" {
+			if bcrypt.CompareHashAndPassword([]byte(send.PasswordHash), []byte(data.Password)) != nil {
+				wrongPassword = true
+				send.FailedAttempts++
+				if send.FailedAttempts >= maxSendPasswordAttempts {
+					return tx.Delete(&send).Error
+				}
+				return tx.Model(&send).Update("failed_attempts", send.FailedAttempts).Error
+			}
+		}
+
+		send.ViewCount++
+		if send.ViewCount >= send.MaxViews {
+			return tx.Delete(&send).Error
+		}
+		return tx.Model(&send).Update("view_count", send.ViewCount).Error
+	})
+	if errors.Is(err, errSendGone) {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": errSendGone.Error(),
+		})
+	}
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "failed to open send",
+		})
+	}
+	if wrongPassword {
+		if send.FailedAttempts >= maxSendPasswordAttempts {
+			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+				"error": "too many wrong passwords, the send was deleted",
+			})
+		}
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+			"error":            "password required",
+			"passwordRequired": true,
+			"attemptsLeft":     maxSendPasswordAttempts - send.FailedAttempts,
+		})
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"message": "send opened",
+		"data": fiber.Map{
+			"encryptedPayload": send.EncryptedPayload,
+			"iv":               send.IV,
+			"viewsLeft":        send.MaxViews - send.ViewCount,
+			"expiresAt":        send.ExpiresAt,
+		},
+	})
+}
+
+// DeleteExpiredSends is run periodically to drop sends past their expiry.
+func DeleteExpiredSends() {
+	res := config.DB.Where("expires_at <= ?", time.Now()).Delete(&models.Send{})
+	if res.Error != nil {
+		log.Println("failed to reap expired sends:", res.Error)
+		return
+	}
+	if res.RowsAffected > 0 {
+		log.Println("reaped", res.RowsAffected, "expired sends")
+	}
+}
@@ -0,0 +1,237 @@
+package controller
+
+import (
+	"errors"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+	"goPass/config"
+	"goPass/models"
+	"goPass/utils"
+	"gorm.io/gorm"
+)
+
+func GetPublicKey(c *fiber.Ctx) error {
+	email := c.Query("email")
+	if email == "" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "email is required",
+		})
+	}
+
+	user := models.AppUser{}
+	if err := config.DB.Where("email=?", email).Select("id", "public_key").First(&user).Error; err != nil || user.PublicKey == "" {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "no public key found for this user",
+		})
+	}
+
+	fingerprint, _ := utils.PublicKeyFingerprint(user.PublicKey)
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"message": "fetched public key",
+		"data": fiber.Map{
+			"id":          user.ID,
+			"publicKey":   user.PublicKey,
+			"fingerprint": fingerprint,
+		},
+	})
+}
+
+type CreateShareRequest struct {
+	VaultID          uuid.UUID `json:"vaultid"`
+	RecipientEmail   string    `json:"recipientemail"`
+	EncryptedItemKey []byte    `json:"encrypteditemkey"`
+	Permission       string    `json:"permission"`
+}
+
+// CreateShare offers an entry to another user. Sharing again with someone
+// who declined or was revoked reopens the same share as pending.
+func CreateShare(c *fiber.Ctx) error {
+	id := c.Locals("id").(uuid.UUID)
+	data := CreateShareRequest{}
+	if err := c.BodyParser(&data); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "failed to parse the request",
+		})
+	}
+
+	if data.VaultID == uuid.Nil || data.RecipientEmail == "" || len(data.EncryptedItemKey) == 0 {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "invalid data in req",
+		})
+	}
+	if data.Permission == "" {
+		data.Permission = models.SharePermissionRead
+	}
+	if data.Permission != models.SharePermissionRead && data.Permission != models.SharePermissionEdit {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "permission must be read or edit",
+		})
+	}
+
+	entry := models.VaultEntry{}
+	if err := config.DB.Scopes(personalEntries(id)).Where("id=?", data.VaultID).Select("id", "encrypted_item_key").First(&entry).Error; err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "vault not found in db",
+		})
+	}
+	if len(entry.EncryptedItemKey) == 0 {
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{
+			"error": "entry has no item key, re-encrypt it with an item key before sharing",
+		})
+	}
+
+	recipient := models.AppUser{}
+	if err := config.DB.Where("email=?", data.RecipientEmail).Select("id", "public_key").First(&recipient).Error; err != nil || recipient.PublicKey == "" {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "recipient not found or has no public key",
+		})
+	}
+	if recipient.ID == id {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "cannot share with yourself",
+		})
+	}
+
+	share := models.VaultShare{}
+	err := config.DB.Where("vault_entry_id=? AND recipient_id=?", entry.ID, recipient.ID).First(&share).Error
+	if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "failed to create share",
+		})
+	}
+	if err == nil && (share.Status == models.ShareStatusPending || share.Status == models.ShareStatusAccepted) {
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{
+			"error": "entry already shared with this user",
+		})
+	}
+
+	if share.ID == uuid.Nil {
+		share.ID = uuid.New()
+	}
+	share.VaultEntryID = entry.ID
+	share.OwnerID = id
+	share.RecipientID = recipient.ID
+	share.EncryptedItemKey = data.EncryptedItemKey
+	share.Permission = data.Permission
+	share.Status = models.ShareStatusPending
+	share.RespondedAt = nil
+
+	if err := config.DB.Save(&share).Error; err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "failed to create share",
+		})
+	}
+
+	return c.Status(fiber.StatusCreated).JSON(fiber.Map{
+		"message": "entry shared succesfully",
+		"data":    share,
+	})
+}
+
+// ListIncomingShares returns pending and accepted shares with the encrypted
+// entry attached, so the client can open it with the share's item key.
+func ListIncomingShares(c *fiber.Ctx) error {
+	id := c.Locals("id").(uuid.UUID)
+
+	shares := []models.VaultShare{}
+	if err := config.DB.Where("recipient_id=? AND status IN ?", id, []string{models.ShareStatusPending, models.ShareStatusAccepted}).
+		Preload("VaultEntry").
+		Find(&shares).Error; err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "failed to fetch shares",
+		})
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"message": "fetched incoming shares",
+		"data":    shares,
+	})
+}
+
+func ListOutgoingShares(c *fiber.Ctx) error {
+	id := c.Locals("id").(uuid.UUID)
+
+	query := config.DB.Where("owner_id=? AND status<>?", id, models.ShareStatusRevoked)
+	if vaultId := c.Query("vault"); vaultId != "" {
+		query = query.Where("vault_entry_id=?", vaultId)
+	}
+
+	shares := []models.VaultShare{}
+	if err := query.Find(&shares).Error; err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "failed to fetch shares",
+		})
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"message": "fetched outgoing shares",
+		"data":    shares,
+	})
+}
+
+func respondToShare(c *fiber.Ctx, from []string, status string) error {
+	id := c.Locals("id").(uuid.UUID)
+	shareId := c.Params("shareId")
+
+	now := time.Now()
+	res := config.DB.Model(&models.VaultShare{}).
+		Where("id=? AND recipient_id=? AND status IN ?", shareId, id, from).
+		Updates(map[string]interface{}{
+			"status":       status,
+			"responded_at": now,
+		})
+	if res.Error != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "failed to update share",
+		})
+	}
+	if res.RowsAffected == 0 {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "share not found",
+		})
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"message": "share " + status,
+	})
+}
+
+func AcceptShare(c *fiber.Ctx) error {
+	return respondToShare(c, []string{models.ShareStatusPending}, models.ShareStatusAccepted)
+}
+
+// DeclineShare also lets a recipient leave a share they accepted earlier.
+func DeclineShare(c *fiber.Ctx) error {
+	return respondToShare(c, []string{models.ShareStatusPending, models.ShareStatusAccepted}, models.ShareStatusDeclined)
+}
+
+// RevokeShare cuts the recipient off and drops the wrapped item key. A
+// recipient who already decrypted the entry may still remember it, so
+// clients should rotate the item key and the secret itself after revoking.
+func RevokeShare(c *fiber.Ctx) error {
+	id := c.Locals("id").(uuid.UUID)
+	shareId := c.Params("shareId")
+
+	res := config.DB.Model(&models.VaultShare{}).
+		Where("id=? AND owner_id=? AND status<>?", shareId, id, models.ShareStatusRevoked).
+		Updates(map[string]interface{}{
+			"status":             models.ShareStatusRevoked,
+			"encrypted_item_key": nil,
+		})
+	if res.Error != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "failed to revoke share",
+		})
+	}
+	if res.RowsAffected == 0 {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "share not found",
+		})
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"message": "share revoked succesfully",
+	})
+}
@@ -0,0 +1,78 @@
+package controller
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+	"goPass/config"
+	"goPass/realtime"
+)
+
+const streamHeartbeat = 25 * time.Second
+
+// StreamChanges keeps a Server-Sent Events stream open with every change
+// to the user's vault made by their other devices. Clients apply the IDs
+// they are sent, or sync everything on a resync event or when the stream
+// ends, since changes made while disconnected are not replayed.
+func StreamChanges(c *fiber.Ctx) error {
+	id := c.Locals("id").(uuid.UUID)
+	if config.Changes == nil {
+		return c.Status(fiber.StatusServiceUnavailable).JSON(fiber.Map{
+			"error": "change streams are not available on this server",
+		})
+	}
+
+	sub, err := config.Changes.Subscribe(id)
+	if errors.Is(err, realtime.ErrTooManySubscriptions) {
+		return c.Status(fiber.StatusTooManyRequests).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "failed to open change stream",
+		})
+	}
+	deviceId := requestDeviceID(c)
+
+	c.Set(fiber.HeaderContentType, "text/event-stream")
+	c.Set(fiber.HeaderCacheControl, "no-cache")
+	c.Set(fiber.HeaderConnection, "keep-alive")
+	c.Set("X-Accel-Buffering", "no")
+
+	c.Context().SetBodyStreamWriter(func(w *bufio.Writer) {
+		defer sub.Close()
+		heartbeat := time.NewTicker(streamHeartbeat)
+		defer heartbeat.Stop()
+
+		fmt.Fprint(w, "retry: 5000\nevent: ready\ndata: {}\n\n")
+		for {
+			// a failed flush is the only sign that the client went away
+			if err := w.Flush(); err != nil {
+				return
+			}
+			select {
+			case change, ok := <-sub.C:
+				if !ok {
+					return
+				}
+				if deviceId != nil && change.DeviceID != nil && *change.DeviceID == *deviceId {
+					continue
+				}
+				data, err := json.Marshal(change)
+				if err != nil {
+					continue
+				}
+				fmt.Fprintf(w, "event: change\ndata: %s\n\n", data)
+			case <-heartbeat.C:
+				fmt.Fprint(w, ": ping\n\n")
+			}
+		}
+	})
+	return nil
+}
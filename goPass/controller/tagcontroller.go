@@ -0,0 +1,134 @@
+package controller
+
+import (
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+	"goPass/config"
+	"goPass/models"
+	"gorm.io/gorm"
+)
+
+type CreateTagRequest struct {
+	EncryptedName []byte `json:"encryptedname"`
+	IV            []byte `json:"iv"`
+}
+
+func CreateTag(c *fiber.Ctx) error {
+	id := c.Locals("id").(uuid.UUID)
+	data := CreateTagRequest{}
+	if err := c.BodyParser(&data); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "failed to parse the request",
+		})
+	}
+
+	if len(data.EncryptedName) == 0 || len(data.IV) == 0 {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "EncryptedName and IV cannot be empty",
+		})
+	}
+
+	tag := models.Tag{
+		ID:            uuid.New(),
+		UserID:        id,
+		EncryptedName: data.EncryptedName,
+		IV:            data.IV,
+	}
+	if err := config.DB.Create(&tag).Error; err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "failed to create tag",
+		})
+	}
+
+	return c.Status(fiber.StatusCreated).JSON(fiber.Map{
+		"message": "tag created succesfully",
+		"data":    tag,
+	})
+}
+
+func ListTags(c *fiber.Ctx) error {
+	id := c.Locals("id").(uuid.UUID)
+
+	tags := []models.Tag{}
+	if err := config.DB.Where("user_id=?", id).Find(&tags).Error; err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "failed to fetch tags",
+		})
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"message": "fetched the list of tags",
+		"data":    tags,
+	})
+}
+
+type RenameTagRequest struct {
+	Id            uuid.UUID `json:"id"`
+	EncryptedName []byte    `json:"encryptedname"`
+	IV            []byte    `json:"iv"`
+}
+
+func RenameTag(c *fiber.Ctx) error {
+	id := c.Locals("id").(uuid.UUID)
+	data := RenameTagRequest{}
+	if err := c.BodyParser(&data); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "failed to parse the request",
+		})
+	}
+
+	if data.Id == uuid.Nil || len(data.EncryptedName) == 0 || len(data.IV) == 0 {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "invalid data in req",
+		})
+	}
+
+	res := config.DB.Model(&models.Tag{}).
+		Where("id=? AND user_id=?", data.Id, id).
+		Updates(map[string]interface{}{
+			"encrypted_name": data.EncryptedName,
+			"iv":             data.IV,
+		})
+	if res.Error != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "failed to rename tag",
+		})
+	}
+	if res.RowsAffected == 0 {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "tag not found",
+		})
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"message": "tag renamed succesfully",
+	})
+}
+
+func DeleteTag(c *fiber.Ctx) error {
+	tagId := c.Params("tagId")
+	id := c.Locals("id").(uuid.UUID)
+
+	tag := models.Tag{}
+	if err := config.DB.Where("id=? AND user_id=?", tagId, id).First(&tag).Error; err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "tag not found",
+		})
+	}
+
+	err := config.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Exec("DELETE FROM vault_entry_tags WHERE tag_id = ?", tag.ID).Error; err != nil {
+			return err
+		}
+		return tx.Delete(&tag).Error
+	})
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "failed to delete tag",
+		})
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"message": "tag deleted succesfully",
+	})
+}
@@ -0,0 +1,353 @@
+package controller
+
+import (
+	"errors"
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+	"goPass/config"
+	"goPass/generator"
+	"goPass/models"
+	"gorm.io/datatypes"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+const maxGenerateCount = 20
+
+type GenerateRequest struct {
+	Policy       *generator.Policy `json:"policy"`
+	PolicyID     *uuid.UUID        `json:"policyid"`
+	PlatformName string            `json:"platformname"`
+	Kind         string            `json:"kind"`
+	Count        int               `json:"count"`
+}
+
+// Generate returns fresh passwords or passphrases. The policy is the first
+// of: the one in the request, a saved policy by id, the site policy for
+// platformname, the user's default policy, the built in default for kind.
+func Generate(c *fiber.Ctx) error {
+	id := c.Locals("id").(uuid.UUID)
+	data := GenerateRequest{}
+	if err := c.BodyParser(&data); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "failed to parse the request",
+		})
+	}
+
+	if data.Count == 0 {
+		data.Count = 1
+	}
+	if data.Count < 1 || data.Count > maxGenerateCount {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "count must be between 1 and 20",
+		})
+	}
+
+	policy, source, err := resolvePolicy(id, data)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "policy not found",
+		})
+	}
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "failed to load policy",
+		})
+	}
+
+	values := make([]string, data.Count)
+	for i := range values {
+		value, err := generator.Generate(policy)
+		if err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": err.Error(),
+			})
+		}
+		values[i] = value
+	}
+
+	c.Set(fiber.HeaderCacheControl, "no-store")
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"message": "generated succesfully",
+		"data": fiber.Map{
+			"values":  values,
+			"entropy": generator.Entropy(policy),
+			"policy":  policy,
+			"source":  source,
+		},
+	})
+}
+
+func resolvePolicy(userId uuid.UUID, data GenerateRequest) (generator.Policy, string, error) {
+	if data.Policy != nil {
+		return *data.Policy, "request", nil
+	}
+	if data.PolicyID != nil {
+		saved := models.GeneratorPolicy{}
+		if err := config.DB.Where("id=? AND user_id=?", *data.PolicyID, userId).First(&saved).Error; err != nil {
+			return generator.Policy{}, "", err
+		}
+		return saved.Policy.Data(), "saved", nil
+	}
+	if data.PlatformName != "" {
+		site := models.SitePolicy{}
+		err := config.DB.Where("user_id=? AND platform_name=?", userId, sitePolicyKey(data.PlatformName)).First(&site).Error
+		if err == nil {
+			return site.Policy.Data(), "site", nil
+		}
+		if !errors.Is(err, gorm.ErrRecordNotFound) {
+			return generator.Policy{}, "", err
+		}
+	}
+
+	saved := models.GeneratorPolicy{}
+	err := config.DB.Where("user_id=? AND is_default=?", userId, true).First(&saved).Error
+	if err == nil && (data.Kind == "" || data.Kind == saved.Policy.Data().Kind) {
+		return saved.Policy.Data(), "saved", nil
+	}
+	if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+		return generator.Policy{}, "", err
+	}
+	if data.Kind == generator.KindPassphrase {
+		return generator.DefaultPassphrasePolicy(), "default", nil
+	}
+	return generator.DefaultPolicy(), "default", nil
+}
+
+func sitePolicyKey(platformName string) string {
+	return strings.ToLower(strings.TrimSpace(platformName))
+}
+
+type GeneratorPolicyRequest struct {
+	Name      string           `json:"name"`
+	Policy    generator.Policy `json:"policy"`
+	IsDefault bool             `json:"isdefault"`
+}
+
+func CreateGeneratorPolicy(c *fiber.Ctx) error {
+	id := c.Locals("id").(uuid.UUID)
+	data := GeneratorPolicyRequest{}
+	if err := c.BodyParser(&data); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "failed to parse the request",
+		})
+	}
+
+	if data.Name == "" || len(data.Name) > 128 {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "name must be 1-128 characters",
+		})
+	}
+	if err := data.Policy.Validate(); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+
+	policy := models.GeneratorPolicy{
+		ID:        uuid.New(),
+		UserID:    id,
+		Name:      data.Name,
+		Policy:    datatypes.NewJSONType(data.Policy),
+		IsDefault: data.IsDefault,
+	}
+	err := config.DB.Transaction(func(tx *gorm.DB) error {
+		if err := clearDefaultPolicy(tx, id, data.IsDefault); err != nil {
+			return err
+		}
+		return tx.Create(&policy).Error
+	})
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "failed to save policy",
+		})
+	}
+
+	return c.Status(fiber.StatusCreated).JSON(fiber.Map{
+		"message": "policy saved succesfully",
+		"data":    policy,
+	})
+}
+
+func ListGeneratorPolicies(c *fiber.Ctx) error {
+	id := c.Locals("id").(uuid.UUID)
+
+	policies := []models.GeneratorPolicy{}
+	if err := config.DB.Where("user_id=?", id).Order("created_at").Find(&policies).Error; err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "failed to fetch policies",
+		})
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"message": "fetched generator policies",
+		"data":    policies,
+	})
+}
+
+func UpdateGeneratorPolicy(c *fiber.Ctx) error {
+	id := c.Locals("id").(uuid.UUID)
+	policyId := c.Params("policyId")
+	data := GeneratorPolicyRequest{}
+	if err := c.BodyParser(&data); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "failed to parse the request",
+		})
+	}
+
+	if data.Name == "" || len(data.Name) > 128 {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "name must be 1-128 characters",
+		})
+	}
+	if err := data.Policy.Validate(); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+
+	policy := models.GeneratorPolicy{}
+	if err := config.DB.Where("id=? AND user_id=?", policyId, id).First(&policy).Error; err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "policy not found",
+		})
+	}
+	policy.Name = data.Name
+	policy.Policy = datatypes.NewJSONType(data.Policy)
+	policy.IsDefault = data.IsDefault
+
+	err := config.DB.Transaction(func(tx *gorm.DB) error {
+		if err := clearDefaultPolicy(tx, id, data.IsDefault); err != nil {
+			return err
+		}
+		return tx.Save(&policy).Error
+	})
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "failed to update policy",
+		})
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"message": "policy updated succesfully",
+		"data":    policy,
+	})
+}
+
+// clearDefaultPolicy unmarks the current default when another policy is
+// about to become it.
+func clearDefaultPolicy(tx *gorm.DB, userId uuid.UUID, isDefault bool) error {
+	if !isDefault {
+		return nil
+	}
+	return tx.Model(&models.GeneratorPolicy{}).
+		Where("user_id=? AND is_default=?", userId, true).
+		Update("is_default", false).Error
+}
+
+func DeleteGeneratorPolicy(c *fiber.Ctx) error {
+	id := c.Locals("id").(uuid.UUID)
+	policyId := c.Params("policyId")
+
+	res := config.DB.Where("id=? AND user_id=?", policyId, id).Delete(&models.GeneratorPolicy{})
+	if res.Error != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "failed to delete policy",
+		})
+	}
+	if res.RowsAffected == 0 {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "policy not found",
+		})
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"message": "policy deleted succesfully",
+	})
+}
+
+type SitePolicyRequest struct {
+	PlatformName string           `json:"platformname"`
+	Policy       generator.Policy `json:"policy"`
+}
+
+// SetSitePolicy creates or replaces the policy hint for a site.
+func SetSitePolicy(c *fiber.Ctx) error {
+	id := c.Locals("id").(uuid.UUID)
+	data := SitePolicyRequest{}
+	if err := c.BodyParser(&data); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "failed to parse the request",
+		})
+	}
+
+	platformName := sitePolicyKey(data.PlatformName)
+	if platformName == "" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "PlatformName is required",
+		})
+	}
+	if err := data.Policy.Validate(); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+
+	site := models.SitePolicy{
+		ID:           uuid.New(),
+		UserID:       id,
+		PlatformName: platformName,
+		Policy:       datatypes.NewJSONType(data.Policy),
+	}
+	if err := config.DB.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "user_id"}, {Name: "platform_name"}},
+		DoUpdates: clause.AssignmentColumns([]string{"policy", "updated_at"}),
+	}).Create(&site).Error; err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "failed to save site policy",
+		})
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"message": "site policy saved succesfully",
+	})
+}
+
+func ListSitePolicies(c *fiber.Ctx) error {
+	id := c.Locals("id").(uuid.UUID)
+
+	sites := []models.SitePolicy{}
+	if err := config.DB.Where("user_id=?", id).Order("platform_name").Find(&sites).Error; err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "failed to fetch site policies",
+		})
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"message": "fetched site policies",
+		"data":    sites,
+	})
+}
+
+func DeleteSitePolicy(c *fiber.Ctx) error {
+	id := c.Locals("id").(uuid.UUID)
+	siteId := c.Params("siteId")
+
+	res := config.DB.Where("id=? AND user_id=?", siteId, id).Delete(&models.SitePolicy{})
+	if res.Error != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "failed to delete site policy",
+		})
+	}
+	if res.RowsAffected == 0 {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "site policy not found",
+		})
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"message": "site policy deleted succesfully",
+	})
+}
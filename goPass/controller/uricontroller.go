@@ -0,0 +1,145 @@
+package controller
+
+import (
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+	"goPass/config"
+	"goPass/models"
+	"gorm.io/datatypes"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+const maxLookupResults = 50
+
+// indexEntryURIs replaces the domain index rows of the entries with the
+// buckets of their current URIs.
+func indexEntryURIs(tx *gorm.DB, entries ...models.VaultEntry) error {
+	if len(entries) == 0 {
+		return nil
+	}
+	ids := make([]uuid.UUID, len(entries))
+	rows := []models.VaultEntryDomain{}
+	for i, entry := range entries {
+		ids[i] = entry.ID
+		for _, uri := range entry.URIs {
+			rows = append(rows, models.VaultEntryDomain{VaultEntryID: entry.ID, Bucket: uri.IndexKey()})
+		}
+	}
+	if err := tx.Where("vault_entry_id IN ?", ids).Delete(&models.VaultEntryDomain{}).Error; err != nil {
+		return err
+	}
+	if len(rows) == 0 {
+		return nil
+	}
+	// several URIs of one entry usually share a bucket
+	return tx.Omit(clause.Associations).Clauses(clause.OnConflict{DoNothing: true}).
+		CreateInBatches(&rows, importBatchSize).Error
+}
+
+type SetVaultURIsRequest struct {
+	Id   uuid.UUID         `json:"id"`
+	URIs []models.EntryURI `json:"uris"`
+}
+
+func SetVaultURIs(c *fiber.Ctx) error {
+	userId := c.Locals("id").(uuid.UUID)
+	data := SetVaultURIsRequest{}
+	if err := c.BodyParser(&data); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "failed to parse the request",
+		})
+	}
+
+	if data.Id == uuid.Nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "invalid data in req",
+		})
+	}
+	if data.URIs == nil {
+		data.URIs = []models.EntryURI{}
+	}
+	if err := models.ValidateURIs(data.URIs); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+
+	entry, err := loadWritableEntry(userId, data.Id)
+	if err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "vault not found in db",
+		})
+	}
+
+	entry.URIs = datatypes.NewJSONSlice(data.URIs)
+	err = config.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&entry).Update("uris", entry.URIs).Error; err != nil {
+			return err
+		}
+		return indexEntryURIs(tx, entry)
+	})
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "failed to update uris",
+		})
+	}
+
+	vaultChanged(c, userId, ChangeUpdated, entry.ID)
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"message": "uris updated succesfully",
+		"data":    entry.URIs,
+	})
+}
+
+// LookupVaultURI returns the entries that autofill should offer for a page
+// or app, e.g. /vault/lookup?uri=https://login.example.com/signin or
+// ?uri=androidapp://com.example.app. The domain index narrows the
+// vault down to candidates, which are then checked against each URI's
+// match mode.
+func LookupVaultURI(c *fiber.Ctx) error {
+	id := c.Locals("id").(uuid.UUID)
+	target := c.Query("uri")
+	if target == "" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "uri is required",
+		})
+	}
+
+	keys, err := models.LookupKeys(target)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+
+	candidates := []models.VaultEntry{}
+	err = config.DB.Scopes(readableEntries(id)).
+		Where("vault_entries.deleted=?", false).
+		Where("vault_entries.id IN (?)", config.DB.Model(&models.VaultEntryDomain{}).Select("vault_entry_id").Where("hash IN ?", keys)).
+		Order("vault_entries.use_count DESC").
+		Find(&candidates).Error
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "failed to look up vault",
+		})
+	}
+
+	matches := []fiber.Map{}
+	for _, entry := range candidates {
+		for _, uri := range entry.URIs {
+			if uri.Matches(target) {
+				matches = append(matches, fiber.Map{"match": uri.Match, "entry": entry})
+				break
+			}
+		}
+		if len(matches) == maxLookupResults {
+			break
+		}
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"message": "fetched matching entries",
+		"data":    matches,
+	})
+}
@@ -2,22 +2,67 @@ package controller
 
 //
 import (
+	"errors"
+	"time"
+
 	// 	"log"
 	//
 	"github.com/gofiber/fiber/v2"
 
 	"github.com/google/uuid"
+	"goPass/audit"
 	"goPass/config"
 	"goPass/models"
 	"gorm.io/datatypes"
+	"gorm.io/gorm"
 )
 
+type TOTPRequest struct {
+	EncryptedSeed []byte `json:"encryptedseed"`
+	SeedIV        []byte `json:"seediv"`
+	Algorithm     string `json:"algorithm"`
+	Digits        int    `json:"digits"`
+	Period        int    `json:"period"`
+}
+
+// toModel fills in the usual authenticator defaults for anything the client
+// left out before validating.
+func (t *TOTPRequest) toModel() (*models.TOTP, error) {
+	totp := models.TOTP{
+		EncryptedSeed: t.EncryptedSeed,
+		SeedIV:        t.SeedIV,
+		Algorithm:     t.Algorithm,
+		Digits:        t.Digits,
+		Period:        t.Period,
+	}
+	if totp.Algorithm == "" {
+		totp.Algorithm = models.TOTPAlgorithmSHA1
+	}
+	if totp.Digits == 0 {
+		totp.Digits = 6
+	}
+	if totp.Period == 0 {
+		totp.Period = 30
+	}
+	if err := models.ValidateTOTP(totp); err != nil {
+		return nil, err
+	}
+	return &totp, nil
+}
+
 type CreateVaultRequest struct {
-	PlatformName      string         `json:"platformname"`
-	EntryKey          string         `json:"entrykey"`
-	EncryptedPassword []byte         `json:"encyptedpassword"`
-	IV                []byte         `json:"iv"`
-	MetaData          datatypes.JSON `json:"metadata"`
+	ItemType          string               `json:"itemtype"`
+	PlatformName      string               `json:"platformname"`
+	EntryKey          string               `json:"entrykey"`
+	EncryptedPassword []byte               `json:"encyptedpassword"`
+	IV                []byte               `json:"iv"`
+	Envelope          datatypes.JSON       `json:"envelope"`
+	CustomFields      []models.CustomField `json:"customfields"`
+	URIs              []models.EntryURI    `json:"uris"`
+	MetaData          datatypes.JSON       `json:"metadata"` // deprecated, use CustomFields
+	TOTP              *TOTPRequest         `json:"totp"`
+	EncryptedItemKey  []byte               `json:"encrypteditemkey"`
+	CollectionID      *uuid.UUID           `json:"collectionid"`
 }
 
 func CreateVault(c *fiber.Ctx) error {
@@ -29,39 +74,103 @@ func CreateVault(c *fiber.Ctx) error {
 		})
 	}
 
-	if data.PlatformName == "" || data.EntryKey == "" {
-		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
-			"error": "PlatformName and EntryKey are required",
+	if data.CollectionID != nil && !canWriteCollection(id, *data.CollectionID) {
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
+			"error": "no write access to this collection",
 		})
 	}
 
-	if len(data.EncryptedPassword) == 0 || len(data.IV) == 0 {
+	VaultEntry, err := newVaultEntry(id, data)
+	if err != nil {
 		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
-			"error": "EncryptedPassword and IV cannot be empty",
+			"error": err.Error(),
 		})
 	}
 
-	VaultEntry := models.VaultEntry{
-		ID:                uuid.New(),
-		UserID:            id,
-		PlatformName:      data.PlatformName,
-		EntryKey:          data.EntryKey,
-		MetaData:          data.MetaData,
-		EncryptedPassword: data.EncryptedPassword,
-	}
-
-	if err := config.DB.Create(&VaultEntry).Error; err != nil {
+	err = config.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&VaultEntry).Error; err != nil {
+			return err
+		}
+		return indexEntryURIs(tx, VaultEntry)
+	})
+	if err != nil {
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
 			"error": "failed to sync vault added",
 		})
 	}
 
+	recordEvent(c, models.AuditEvent{UserID: &id, Event: audit.EventEntryCreate, TargetID: &VaultEntry.ID})
+	vaultChanged(c, id, ChangeCreated, VaultEntry.ID)
+
 	return c.Status(fiber.StatusCreated).JSON(fiber.Map{
 		"message": "add in the vault succesfully",
 		"data":    VaultEntry,
 	})
 }
 
+// newVaultEntry validates a create request and builds the entry for it. It
+// is shared by single creates and imports, access to the collection is up
+// to the caller.
+func newVaultEntry(userId uuid.UUID, data CreateVaultRequest) (models.VaultEntry, error) {
+	if data.PlatformName == "" || data.EntryKey == "" {
+		return models.VaultEntry{}, errors.New("PlatformName and EntryKey are required")
+	}
+	if len(data.EncryptedPassword) == 0 || len(data.IV) == 0 {
+		return models.VaultEntry{}, errors.New("EncryptedPassword and IV cannot be empty")
+	}
+
+	if data.ItemType == "" {
+		data.ItemType = models.ItemTypeLogin
+	}
+	if err := models.ValidateEnvelope(data.ItemType, data.Envelope); err != nil {
+		return models.VaultEntry{}, err
+	}
+
+	if data.CustomFields == nil {
+		fields, err := models.CustomFieldsFromMetaData(data.MetaData)
+		if err != nil {
+			return models.VaultEntry{}, err
+		}
+		data.CustomFields = fields
+	}
+	if err := models.ValidateCustomFields(data.CustomFields); err != nil {
+		return models.VaultEntry{}, err
+	}
+
+	if data.URIs == nil {
+		data.URIs = []models.EntryURI{}
+	}
+	if err := models.ValidateURIs(data.URIs); err != nil {
+		return models.VaultEntry{}, err
+	}
+
+	var totp *models.TOTP
+	if data.TOTP != nil {
+		t, err := data.TOTP.toModel()
+		if err != nil {
+			return models.VaultEntry{}, err
+		}
+		totp = t
+	}
+
+	return models.VaultEntry{
+		ID:                uuid.New(),
+		UserID:            userId,
+		CollectionID:      data.CollectionID,
+		ItemType:          data.ItemType,
+		PlatformName:      data.PlatformName,
+		EntryKey:          data.EntryKey,
+		Envelope:          data.Envelope,
+		CustomFields:      datatypes.NewJSONSlice(data.CustomFields),
+		URIs:              datatypes.NewJSONSlice(data.URIs),
+		EncryptedPassword: data.EncryptedPassword,
+		IV:                data.IV,
+		EncryptedItemKey:  data.EncryptedItemKey,
+		TOTP:              totp,
+		HasTOTP:           totp != nil,
+	}, nil
+}
+
 type YourVaultResponse struct{}
 
 func GetYourVault(c *fiber.Ctx) error {
@@ -73,10 +182,17 @@ func GetYourVault(c *fiber.Ctx) error {
 		})
 	}
 
+	query, err := filterVaultQuery(c, config.DB.Scopes(readableEntries(id)))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+
 	vaults := []models.VaultEntry{}
-	if err := config.DB.Where("id=?", id).First(&vaults).Error; err != nil {
-		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
-			"error": "no vault entry found in db",
+	if err := query.Preload("Tags").Find(&vaults).Error; err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "failed to fetch vault from db",
 		})
 	}
 
@@ -86,10 +202,86 @@ func GetYourVault(c *fiber.Ctx) error {
 	})
 }
 
+// filterVaultQuery applies the listing filters and sort order from the query
+// string. Passing since turns the listing into a delta sync: only entries
+// changed after that time are returned, deleted ones included.
+func filterVaultQuery(c *fiber.Ctx, query *gorm.DB) (*gorm.DB, error) {
+	if since := c.Query("since"); since != "" {
+		sinceTime, err := time.Parse(time.RFC3339, since)
+		if err != nil {
+			return nil, errors.New("since must be an RFC3339 timestamp")
+		}
+		query = query.Where("updated_at > ?", sinceTime)
+	} else {
+		query = query.Where("deleted=?", false)
+	}
+
+	if itemType := c.Query("type"); itemType != "" {
+		if !models.IsValidItemType(itemType) {
+			return nil, errors.New("unknown item type")
+		}
+		query = query.Where("item_type=?", itemType)
+	}
+	if folder := c.Query("folder"); folder != "" {
+		if folder == "root" {
+			query = query.Where("folder_id IS NULL")
+		} else {
+			folderId, err := uuid.Parse(folder)
+			if err != nil {
+				return nil, errors.New("invalid folder id")
+			}
+			query = query.Where("folder_id=?", folderId)
+		}
+	}
+	if collection := c.Query("collection"); collection != "" {
+		if collection == "personal" {
+			query = query.Where("collection_id IS NULL")
+		} else {
+			collectionId, err := uuid.Parse(collection)
+			if err != nil {
+				return nil, errors.New("invalid collection id")
+			}
+			query = query.Where("collection_id=?", collectionId)
+		}
+	}
+	if tag := c.Query("tag"); tag != "" {
+		tagId, err := uuid.Parse(tag)
+		if err != nil {
+			return nil, errors.New("invalid tag id")
+		}
+		query = query.Where("id IN (?)", config.DB.Table("vault_entry_tags").Select("vault_entry_id").Where("tag_id=?", tagId))
+	}
+	if totp := c.Query("totp"); totp != "" {
+		query = query.Where("has_totp=?", c.QueryBool("totp"))
+	}
+	if c.QueryBool("favorite") {
+		query = query.Where("favorite=?", true)
+	}
+
+	switch c.Query("sort") {
+	case "":
+	case "recent":
+		query = query.Order("last_used_at DESC NULLS LAST")
+	case "frequent":
+		query = query.Order("use_count DESC").Order("last_used_at DESC NULLS LAST")
+	default:
+		return nil, errors.New("sort must be recent or frequent")
+	}
+	return query, nil
+}
+
 type UpdateVaultRequest struct {
-	Id           uuid.UUID `json:"id"`
-	EntryKey     string    `json:"entrykey"`
-	PlatformName string    `json:"platformname"`
+	Id                uuid.UUID            `json:"id"`
+	EntryKey          string               `json:"entrykey"`
+	PlatformName      string               `json:"platformname"`
+	Envelope          datatypes.JSON       `json:"envelope"`
+	CustomFields      []models.CustomField `json:"customfields"`
+	EncryptedPassword []byte               `json:"encyptedpassword"`
+	IV                []byte               `json:"iv"`
+	EncryptedItemKey  []byte               `json:"encrypteditemkey"`
+	// health data for the new password, see UpdateVaultHealth
+	Fingerprint string `json:"fingerprint"`
+	Strength    *int   `json:"strength"`
 }
 
 func UpdateItem(c *fiber.Ctx) error {
@@ -108,21 +300,90 @@ func UpdateItem(c *fiber.Ctx) error {
 		})
 	}
 
-	vaultData := models.VaultEntry{}
-	if err := config.DB.Where("user_id=?", userId).First(&vaultData).Error; err != nil {
-		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+	vaultData, err := loadWritableEntry(userId, data.Id)
+	if err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
 			"error": "vault not found in db",
 		})
 	}
 	vaultData.PlatformName = data.PlatformName
 	vaultData.EntryKey = data.EntryKey
 
-	if err := config.DB.Save(&vaultData); err != nil {
+	// re-encrypting the secret always comes with a fresh IV. Only the owner
+	// can rewrap a personal item key since recipients don't have the vault
+	// key, collection item keys are wrapped by the org key that every writer
+	// of the collection holds
+	if len(data.EncryptedPassword) > 0 || len(data.IV) > 0 {
+		if len(data.EncryptedPassword) == 0 || len(data.IV) == 0 {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": "EncryptedPassword and IV must be updated together",
+			})
+		}
+		vaultData.EncryptedPassword = data.EncryptedPassword
+		vaultData.IV = data.IV
+
+		// without a fingerprint for the new secret the old one would keep
+		// grouping the entry with its old password in the health report.
+		// Fingerprints are only comparable within one vault, so collection
+		// entries never keep one.
+		now := time.Now()
+		if data.Fingerprint != "" && vaultData.CollectionID == nil {
+			if err := validateHealthScore(data.Fingerprint, data.Strength); err != nil {
+				return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+					"error": err.Error(),
+				})
+			}
+			if vaultData.Fingerprint != data.Fingerprint {
+				vaultData.PasswordChangedAt = &now
+			}
+			vaultData.Fingerprint = data.Fingerprint
+			vaultData.StrengthScore = data.Strength
+		} else {
+			vaultData.Fingerprint = ""
+			vaultData.StrengthScore = nil
+			vaultData.PasswordChangedAt = &now
+		}
+	}
+	if len(data.EncryptedItemKey) > 0 {
+		canRewrap := vaultData.UserID == userId
+		if vaultData.CollectionID != nil {
+			canRewrap = canWriteCollection(userId, *vaultData.CollectionID)
+		}
+		if !canRewrap {
+			return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
+				"error": "not allowed to change the item key",
+			})
+		}
+		vaultData.EncryptedItemKey = data.EncryptedItemKey
+	}
+
+	if data.Envelope != nil {
+		if err := models.ValidateEnvelope(vaultData.ItemType, data.Envelope); err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": err.Error(),
+			})
+		}
+		vaultData.Envelope = data.Envelope
+	}
+
+	if data.CustomFields != nil {
+		if err := models.ValidateCustomFields(data.CustomFields); err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": err.Error(),
+			})
+		}
+		vaultData.CustomFields = datatypes.NewJSONSlice(data.CustomFields)
+	}
+
+	if err := config.DB.Save(&vaultData).Error; err != nil {
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
 			"error": "failed to update vault in db",
 		})
 	}
 
+	recordEvent(c, models.AuditEvent{UserID: &userId, Event: audit.EventEntryUpdate, TargetID: &vaultData.ID})
+	vaultChanged(c, userId, ChangeUpdated, vaultData.ID)
+
 	return c.Status(fiber.StatusOK).JSON(fiber.Map{
 		"message": "succesfully update vaul",
 		"data":    vaultData,
@@ -139,12 +400,311 @@ func DeleteVaultItem(c *fiber.Ctx) error {
 		})
 	}
 	vaultmodel := models.VaultEntry{}
-	if err := config.DB.Where("id=?", vaultId).Where("user_id=?", id).Delete(&vaultmodel).Error; err != nil {
+	if err := config.DB.Scopes(manageableEntries(id)).Where("id=? AND deleted=?", vaultId, false).Select("id").First(&vaultmodel).Error; err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "vault not found in db",
+		})
+	}
+
+	audience := changeAudience(id, []uuid.UUID{vaultmodel.ID})
+	var attachments []models.Attachment
+	err := config.DB.Transaction(func(tx *gorm.DB) error {
+		var err error
+		attachments, err = retireEntries(tx, []uuid.UUID{vaultmodel.ID})
+		return err
+	})
+	if err != nil {
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
 			"error": "failed to terminated vault data",
 		})
 	}
+	for _, att := range attachments {
+		deleteAttachmentBlobs(c.UserContext(), att)
+	}
+	recordEvent(c, models.AuditEvent{UserID: &id, Event: audit.EventEntryDelete, TargetID: &vaultmodel.ID})
+	publishChange(c, audience, ChangeDeleted, []uuid.UUID{vaultmodel.ID})
 	return c.Status(fiber.StatusOK).JSON(fiber.Map{
 		"message": "vualt item terminated succesfully",
 	})
 }
+
+// retireEntries leaves the rows behind as tombstones so delta syncs see the
+// deletion. Everything hanging off them goes, shares included. The caller
+// removes the blobs of the returned attachments once tx has committed.
+func retireEntries(tx *gorm.DB, ids []uuid.UUID) ([]models.Attachment, error) {
+	attachments := []models.Attachment{}
+	if len(ids) == 0 {
+		return attachments, nil
+	}
+	if err := tx.Where("vault_entry_id IN ?", ids).Find(&attachments).Error; err != nil {
+		return nil, err
+	}
+	for _, related := range []interface{}{&models.Attachment{}, &models.VaultShare{}, &models.VaultEntryDomain{}} {
+		if err := tx.Where("vault_entry_id IN ?", ids).Delete(related).Error; err != nil {
+			return nil, err
+		}
+	}
+	if err := tx.Model(&models.VaultEntry{}).Where("id IN ?", ids).Update("deleted", true).Error; err != nil {
+		return nil, err
+	}
+	return attachments, nil
+}
+
+type MoveVaultRequest struct {
+	Id       uuid.UUID  `json:"id"`
+	FolderID *uuid.UUID `json:"folderid"`
+}
+
+func MoveVaultItem(c *fiber.Ctx) error {
+	userId := c.Locals("id").(uuid.UUID)
+	data := MoveVaultRequest{}
+	if err := c.BodyParser(&data); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "failed to parse the request",
+		})
+	}
+
+	if data.Id == uuid.Nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "invalid data in req",
+		})
+	}
+
+	if data.FolderID != nil {
+		if err := config.DB.Where("id=? AND user_id=?", *data.FolderID, userId).First(&models.Folder{}).Error; err != nil {
+			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+				"error": "folder not found",
+			})
+		}
+	}
+
+	res := config.DB.Model(&models.VaultEntry{}).
+		Scopes(personalEntries(userId)).
+		Where("id=?", data.Id).
+		Update("folder_id", data.FolderID)
+	if res.Error != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "failed to move vault item",
+		})
+	}
+	if res.RowsAffected == 0 {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "vault not found in db",
+		})
+	}
+
+	vaultChanged(c, userId, ChangeUpdated, data.Id)
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"message": "vault item moved succesfully",
+	})
+}
+
+type SetVaultTagsRequest struct {
+	Id     uuid.UUID   `json:"id"`
+	TagIDs []uuid.UUID `json:"tagids"`
+}
+
+// SetVaultItemTags replaces the full set of tags on an entry, an empty list
+// clears them.
+func SetVaultItemTags(c *fiber.Ctx) error {
+	userId := c.Locals("id").(uuid.UUID)
+	data := SetVaultTagsRequest{}
+	if err := c.BodyParser(&data); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "failed to parse the request",
+		})
+	}
+
+	if data.Id == uuid.Nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "invalid data in req",
+		})
+	}
+
+	vaultData := models.VaultEntry{}
+	if err := config.DB.Scopes(personalEntries(userId)).Where("id=?", data.Id).First(&vaultData).Error; err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "vault not found in db",
+		})
+	}
+
+	tags := []models.Tag{}
+	if len(data.TagIDs) > 0 {
+		if err := config.DB.Where("id IN ? AND user_id=?", data.TagIDs, userId).Find(&tags).Error; err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"error": "failed to fetch tags",
+			})
+		}
+		if len(tags) != len(data.TagIDs) {
+			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+				"error": "tag not found",
+			})
+		}
+	}
+
+	// the association alone leaves updated_at alone, bump it so delta syncs
+	// pick up the new tags
+	err := config.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&vaultData).Association("Tags").Replace(tags); err != nil {
+			return err
+		}
+		return tx.Model(&vaultData).Update("updated_at", time.Now()).Error
+	})
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "failed to tag vault item",
+		})
+	}
+
+	vaultChanged(c, userId, ChangeUpdated, vaultData.ID)
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"message": "vault item tagged succesfully",
+		"data":    tags,
+	})
+}
+
+type FavoriteVaultRequest struct {
+	Id       uuid.UUID `json:"id"`
+	Favorite bool      `json:"favorite"`
+}
+
+func SetVaultFavorite(c *fiber.Ctx) error {
+	userId := c.Locals("id").(uuid.UUID)
+	data := FavoriteVaultRequest{}
+	if err := c.BodyParser(&data); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "failed to parse the request",
+		})
+	}
+
+	if data.Id == uuid.Nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "invalid data in req",
+		})
+	}
+
+	res := config.DB.Model(&models.VaultEntry{}).
+		Scopes(personalEntries(userId)).
+		Where("id=?", data.Id).
+		Update("favorite", data.Favorite)
+	if res.Error != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "failed to update favorite",
+		})
+	}
+	if res.RowsAffected == 0 {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "vault not found in db",
+		})
+	}
+
+	vaultChanged(c, userId, ChangeUpdated, data.Id)
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"message": "favorite updated succesfully",
+	})
+}
+
+// MarkVaultUsed is called by clients whenever an entry is copied or filled.
+// The counter is bumped in the database so concurrent devices don't race.
+// Usage lives on the entry, so only those who can write it may bump it.
+func MarkVaultUsed(c *fiber.Ctx) error {
+	userId := c.Locals("id").(uuid.UUID)
+	vaultId, err := uuid.Parse(c.Params("vaultId"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "invalid vault id",
+		})
+	}
+
+	now := time.Now()
+	res := config.DB.Model(&models.VaultEntry{}).
+		Scopes(writableEntries(userId)).
+		Where("id=? AND deleted=?", vaultId, false).
+		// UpdateColumns leaves updated_at alone, a use is no reason for every
+		// device to sync the entry again
+		UpdateColumns(map[string]interface{}{
+			"use_count":    gorm.Expr("use_count + 1"),
+			"last_used_at": now,
+		})
+	if res.Error != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "failed to mark vault item used",
+		})
+	}
+	if res.RowsAffected == 0 {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "vault not found in db",
+		})
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"message":    "vault item marked used",
+		"lastUsedAt": now,
+	})
+}
+
+type SetVaultTOTPRequest struct {
+	Id   uuid.UUID    `json:"id"`
+	TOTP *TOTPRequest `json:"totp"`
+}
+
+// SetVaultTOTP adds, replaces or, when totp is null, removes the TOTP
+// secret of an entry.
+func SetVaultTOTP(c *fiber.Ctx) error {
+	userId := c.Locals("id").(uuid.UUID)
+	data := SetVaultTOTPRequest{}
+	if err := c.BodyParser(&data); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "failed to parse the request",
+		})
+	}
+
+	if data.Id == uuid.Nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "invalid data in req",
+		})
+	}
+
+	updates := map[string]interface{}{
+		"has_totp":            false,
+		"totp_encrypted_seed": nil,
+		"totp_seed_iv":        nil,
+		"totp_algorithm":      nil,
+		"totp_digits":         nil,
+		"totp_period":         nil,
+	}
+	if data.TOTP != nil {
+		totp, err := data.TOTP.toModel()
+		if err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": err.Error(),
+			})
+		}
+		updates = map[string]interface{}{
+			"has_totp":            true,
+			"totp_encrypted_seed": totp.EncryptedSeed,
+			"totp_seed_iv":        totp.SeedIV,
+			"totp_algorithm":      totp.Algorithm,
+			"totp_digits":         totp.Digits,
+			"totp_period":         totp.Period,
+		}
+	}
+
+	entry, err := loadWritableEntry(userId, data.Id)
+	if err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "vault not found in db",
+		})
+	}
+
+	if err := config.DB.Model(&entry).Updates(updates).Error; err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "failed to update totp",
+		})
+	}
+
+	vaultChanged(c, userId, ChangeUpdated, entry.ID)
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"message": "totp updated succesfully",
+	})
+}
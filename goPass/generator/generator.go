@@ -0,0 +1,272 @@
+// Package generator creates random passwords and diceware passphrases from a
+// Policy. All randomness comes from crypto/rand.
+package generator
+
+import (
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"math"
+	"math/big"
+	"strings"
+	"unicode"
+)
+
+const (
+	KindPassword   = "password"
+	KindPassphrase = "passphrase"
+)
+
+const (
+	lowerChars     = "abcdefghijklmnopqrstuvwxyz"
+	upperChars     = "ABCDEFGHIJKLMNOPQRSTUVWXYZ"
+	digitChars     = "0123456789"
+	symbolChars    = "!@#$%^&*()-_=+[]{};:,.<>/?~"
+	ambiguousChars = "Il1O0o|`'\""
+
+	MinLength       = 4
+	MaxLength       = 128
+	MinWords        = 3
+	MaxWords        = 20
+	maxSeparatorLen = 3
+)
+
+// Policy describes what to generate. Password fields apply to KindPassword,
+// word fields to KindPassphrase.
+type Policy struct {
+	Kind string `json:"kind"`
+
+	Length         int    `json:"length,omitempty"`
+	Lower          bool   `json:"lower,omitempty"`
+	Upper          bool   `json:"upper,omitempty"`
+	Digits         bool   `json:"digits,omitempty"`
+	Symbols        bool   `json:"symbols,omitempty"`
+	MinDigits      int    `json:"minDigits,omitempty"`
+	MinSymbols     int    `json:"minSymbols,omitempty"`
+	Exclude        string `json:"exclude,omitempty"`
+	AvoidAmbiguous bool   `json:"avoidAmbiguous,omitempty"`
+
+	Words         int    `json:"words,omitempty"`
+	WordList      string `json:"wordList,omitempty"`
+	Separator     string `json:"separator,omitempty"`
+	Capitalize    bool   `json:"capitalize,omitempty"`
+	IncludeNumber bool   `json:"includeNumber,omitempty"`
+}
+
+// DefaultPolicy is a 20 character password from all four classes, about
+// 128 bits.
+func DefaultPolicy() Policy {
+	return Policy{
+		Kind:    KindPassword,
+		Length:  20,
+		Lower:   true,
+		Upper:   true,
+		Digits:  true,
+		Symbols: true,
+	}
+}
+
+// DefaultPassphrasePolicy is six words from the EFF large list, about 77
+// bits.
+func DefaultPassphrasePolicy() Policy {
+	return Policy{
+		Kind:      KindPassphrase,
+		Words:     6,
+		WordList:  WordListEFFLarge,
+		Separator: "-",
+	}
+}
+
+func (p Policy) Validate() error {
+	switch p.Kind {
+	case KindPassword:
+		if p.Length < MinLength || p.Length > MaxLength {
+			return fmt.Errorf("length must be between %d and %d", MinLength, MaxLength)
+		}
+		if p.MinDigits < 0 || p.MinSymbols < 0 {
+			return errors.New("minimums cannot be negative")
+		}
+		if (p.MinDigits > 0 && !p.Digits) || (p.MinSymbols > 0 && !p.Symbols) {
+			return errors.New("minimums need their character class enabled")
+		}
+		if len(p.Exclude) > 256 {
+			return errors.New("exclude list too long")
+		}
+		required := p.MinDigits + p.MinSymbols
+		for _, class := range p.classes() {
+			if class.chars == "" {
+				return fmt.Errorf("every %s character is excluded", class.name)
+			}
+			if class.min == 0 {
+				required++
+			}
+		}
+		if len(p.classes()) == 0 {
+			return errors.New("enable at least one character class")
+		}
+		if required > p.Length {
+			return errors.New("length too short for the required characters")
+		}
+	case KindPassphrase:
+		if p.Words < MinWords || p.Words > MaxWords {
+			return fmt.Errorf("words must be between %d and %d", MinWords, MaxWords)
+		}
+		if wordlist(p.WordList) == nil {
+			return fmt.Errorf("unknown word list %q", p.WordList)
+		}
+		if len(p.Separator) > maxSeparatorLen {
+			return errors.New("separator too long")
+		}
+		for _, r := range p.Separator {
+			if unicode.IsLetter(r) {
+				return errors.New("separator cannot contain letters")
+			}
+		}
+	default:
+		return errors.New("kind must be password or passphrase")
+	}
+	return nil
+}
+
+type charClass struct {
+	name  string
+	chars string
+	min   int
+}
+
+// classes returns the enabled character classes with exclusions applied.
+func (p Policy) classes() []charClass {
+	classes := []charClass{}
+	add := func(enabled bool, name, chars string, min int) {
+		if !enabled {
+			return
+		}
+		chars = strings.Map(func(r rune) rune {
+			if strings.ContainsRune(p.Exclude, r) || (p.AvoidAmbiguous && strings.ContainsRune(ambiguousChars, r)) {
+				return -1
+			}
+			return r
+		}, chars)
+		classes = append(classes, charClass{name: name, chars: chars, min: min})
+	}
+	add(p.Lower, "lowercase", lowerChars, 0)
+	add(p.Upper, "uppercase", upperChars, 0)
+	add(p.Digits, "digit", digitChars, p.MinDigits)
+	add(p.Symbols, "symbol", symbolChars, p.MinSymbols)
+	return classes
+}
+
+// Generate returns a new password or passphrase for p.
+func Generate(p Policy) (string, error) {
+	if err := p.Validate(); err != nil {
+		return "", err
+	}
+	if p.Kind == KindPassphrase {
+		return passphrase(p)
+	}
+	return password(p)
+}
+
+// password takes the required characters of every enabled class first,
+// fills up from all classes and shuffles, so the position of the required
+// ones gives nothing away.
+func password(p Policy) (string, error) {
+	out := make([]byte, 0, p.Length)
+	all := ""
+	for _, class := range p.classes() {
+		all += class.chars
+		for i := 0; i < max(class.min, 1); i++ {
+			c, err := pick(class.chars)
+			if err != nil {
+				return "", err
+			}
+			out = append(out, c)
+		}
+	}
+	for len(out) < p.Length {
+		c, err := pick(all)
+		if err != nil {
+			return "", err
+		}
+		out = append(out, c)
+	}
+
+	for i := len(out) - 1; i > 0; i-- {
+		j, err := randIndex(i + 1)
+		if err != nil {
+			return "", err
+		}
+		out[i], out[j] = out[j], out[i]
+	}
+	return string(out), nil
+}
+
+func passphrase(p Policy) (string, error) {
+	list := wordlist(p.WordList)
+	words := make([]string, p.Words)
+	for i := range words {
+		n, err := randIndex(len(list))
+		if err != nil {
+			return "", err
+		}
+		words[i] = list[n]
+		if p.Capitalize {
+			words[i] = strings.ToUpper(words[i][:1]) + words[i][1:]
+		}
+	}
+	if p.IncludeNumber {
+		i, err := randIndex(len(words))
+		if err != nil {
+			return "", err
+		}
+		d, err := randIndex(10)
+		if err != nil {
+			return "", err
+		}
+		words[i] += string(digitChars[d])
+	}
+	return strings.Join(words, p.Separator), nil
+}
+
+// Entropy estimates the strength of what p generates in bits, ignoring the
+// small loss from the per class minimums.
+func Entropy(p Policy) float64 {
+	switch p.Kind {
+	case KindPassword:
+		size := 0
+		for _, class := range p.classes() {
+			size += len(class.chars)
+		}
+		if size == 0 {
+			return 0
+		}
+		return float64(p.Length) * math.Log2(float64(size))
+	case KindPassphrase:
+		list := wordlist(p.WordList)
+		if len(list) == 0 {
+			return 0
+		}
+		bits := float64(p.Words) * math.Log2(float64(len(list)))
+		if p.IncludeNumber {
+			bits += math.Log2(float64(p.Words) * 10)
+		}
+		return bits
+	}
+	return 0
+}
+
+func pick(chars string) (byte, error) {
+	i, err := randIndex(len(chars))
+	if err != nil {
+		return 0, err
+	}
+	return chars[i], nil
+}
+
+func randIndex(n int) (int, error) {
+	i, err := rand.Int(rand.Reader, big.NewInt(int64(n)))
+	if err != nil {
+		return 0, err
+	}
+	return int(i.Int64()), nil
+}
@@ -0,0 +1,51 @@
+package generator
+
+import (
+	"bufio"
+	"embed"
+	"strings"
+	"sync"
+)
+
+//go:embed wordlists/*.txt
+var wordlistFiles embed.FS
+
+const (
+	WordListEFFLarge = "eff-large"
+	WordListEFFShort = "eff-short"
+)
+
+var wordlistPaths = map[string]string{
+	WordListEFFLarge: "wordlists/eff_large.txt",
+	WordListEFFShort: "wordlists/eff_short.txt",
+}
+
+var (
+	wordlistsOnce sync.Once
+	wordlists     map[string][]string
+)
+
+// wordlist returns the words of a built in list, parsed from the dice roll
+// and word columns of the EFF files on first use.
+func wordlist(name string) []string {
+	wordlistsOnce.Do(func() {
+		wordlists = map[string][]string{}
+		for listName, path := range wordlistPaths {
+			f, err := wordlistFiles.Open(path)
+			if err != nil {
+				panic(err)
+			}
+			words := []string{}
+			scanner := bufio.NewScanner(f)
+			for scanner.Scan() {
+				fields := strings.Fields(scanner.Text())
+				if len(fields) == 2 {
+					words = append(words, fields[1])
+				}
+			}
+			f.Close()
+			wordlists[listName] = words
+		}
+	})
+	return wordlists[name]
+}
@@ -0,0 +1,198 @@
+package icons
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"image"
+	"image/color"
+	_ "image/gif"
+	_ "image/jpeg"
+	"image/png"
+
+	_ "golang.org/x/image/bmp"
+	"golang.org/x/image/draw"
+	_ "golang.org/x/image/webp"
+)
+
+// maxDimension guards against images that are tiny on the wire but huge
+// once decoded.
+const maxDimension = 2048
+
+var errUnsupported = errors.New("unsupported icon format")
+
+// decode reads an icon in any of the formats sites serve favicons in: ICO,
+// PNG, GIF, JPEG, BMP or WebP. SVG icons are not supported.
+func decode(data []byte) (image.Image, error) {
+	if len(data) >= 4 && bytes.Equal(data[:4], []byte{0, 0, 1, 0}) {
+		return decodeICO(data)
+	}
+	return decodeImage(data)
+}
+
+func decodeImage(data []byte) (image.Image, error) {
+	cfg, _, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return nil, errUnsupported
+	}
+	if cfg.Width <= 0 || cfg.Height <= 0 || cfg.Width > maxDimension || cfg.Height > maxDimension {
+		return nil, errUnsupported
+	}
+	img, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, errUnsupported
+	}
+	return img, nil
+}
+
+// decodeICO picks the largest image in an ICO file, by size and then by
+// colour depth. Entries are either PNG files or headerless BMPs.
+func decodeICO(data []byte) (image.Image, error) {
+	le := binary.LittleEndian
+	if len(data) < 6 {
+		return nil, errUnsupported
+	}
+	count := int(le.Uint16(data[4:6]))
+	if count == 0 || len(data) < 6+16*count {
+		return nil, errUnsupported
+	}
+
+	best, bestSize, bestDepth := -1, 0, 0
+	for i := 0; i < count; i++ {
+		entry := data[6+16*i:]
+		size := int(entry[0])
+		if size == 0 {
+			size = 256
+		}
+		depth := int(le.Uint16(entry[6:8]))
+		if size > bestSize || (size == bestSize && depth > bestDepth) {
+			best, bestSize, bestDepth = i, size, depth
+		}
+	}
+
+	entry := data[6+16*best:]
+	length := int(le.Uint32(entry[8:12]))
+	offset := int(le.Uint32(entry[12:16]))
+	if length <= 0 || offset < 0 || offset+length > len(data) || offset+length < offset {
+		return nil, errUnsupported
+	}
+	payload := data[offset : offset+length]
+	if bytes.HasPrefix(payload, []byte("\x89PNG\r\n\x1a\n")) {
+		return decodeImage(payload)
+	}
+	return decodeDIB(payload)
+}
+
+// decodeDIB decodes the BMP flavour used inside ICO files: no file header,
+// a doubled height covering the colour data and the 1 bit transparency mask
+// after it, bottom row first.
+func decodeDIB(b []byte) (image.Image, error) {
+	le := binary.LittleEndian
+	if len(b) < 40 {
+		return nil, errUnsupported
+	}
+	headerSize := int(le.Uint32(b[0:4]))
+	width := int(int32(le.Uint32(b[4:8])))
+	height := int(int32(le.Uint32(b[8:12]))) / 2
+	depth := int(le.Uint16(b[14:16]))
+	compression := le.Uint32(b[16:20])
+	if headerSize < 40 || width <= 0 || height <= 0 || width > 256 || height > 256 {
+		return nil, errUnsupported
+	}
+	// 3 is BI_BITFIELDS, which in icons is always the plain BGRA layout
+	if compression != 0 && !(compression == 3 && depth == 32) {
+		return nil, errUnsupported
+	}
+
+	var palette []color.NRGBA
+	switch depth {
+	case 1, 4, 8:
+		colors := int(le.Uint32(b[32:36]))
+		if colors == 0 || colors > 1<<depth {
+			colors = 1 << depth
+		}
+		if len(b) < headerSize+4*colors {
+			return nil, errUnsupported
+		}
+		palette = make([]color.NRGBA, colors)
+		for i := range palette {
+			p := b[headerSize+4*i:]
+			palette[i] = color.NRGBA{R: p[2], G: p[1], B: p[0], A: 0xff}
+		}
+	case 24, 32:
+	default:
+		return nil, errUnsupported
+	}
+
+	pixels := headerSize + 4*len(palette)
+	stride := (width*depth + 31) / 32 * 4
+	maskStride := (width + 31) / 32 * 4
+	if len(b) < pixels+stride*height {
+		return nil, errUnsupported
+	}
+	mask := pixels + stride*height
+	hasMask := len(b) >= mask+maskStride*height
+
+	img := image.NewNRGBA(image.Rect(0, 0, width, height))
+	hasAlpha := false
+	for y := 0; y < height; y++ {
+		row := b[pixels+(height-1-y)*stride:]
+		for x := 0; x < width; x++ {
+			var c color.NRGBA
+			switch depth {
+			case 32:
+				c = color.NRGBA{R: row[4*x+2], G: row[4*x+1], B: row[4*x], A: row[4*x+3]}
+				hasAlpha = hasAlpha || c.A != 0
+			case 24:
+				c = color.NRGBA{R: row[3*x+2], G: row[3*x+1], B: row[3*x], A: 0xff}
+			default:
+				perByte := 8 / depth
+				shift := uint(8 - depth*(x%perByte+1))
+				index := int(row[x/perByte]>>shift) & (1<<depth - 1)
+				if index < len(palette) {
+					c = palette[index]
+				}
+			}
+			img.SetNRGBA(x, y, c)
+		}
+	}
+
+	// without an alpha channel the mask decides what is transparent
+	if !hasAlpha && hasMask {
+		for y := 0; y < height; y++ {
+			row := b[mask+(height-1-y)*maskStride:]
+			for x := 0; x < width; x++ {
+				c := img.NRGBAAt(x, y)
+				c.A = 0xff
+				if row[x/8]&(0x80>>uint(x%8)) != 0 {
+					c.A = 0
+				}
+				img.SetNRGBA(x, y, c)
+			}
+		}
+	}
+	return img, nil
+}
+
+// render scales img into a square PNG of the given size, keeping its aspect
+// ratio and centring it on a transparent background.
+func render(img image.Image, size int) ([]byte, error) {
+	bounds := img.Bounds()
+	w, h := size, size
+	if bounds.Dx() > bounds.Dy() {
+		h = max(1, size*bounds.Dy()/bounds.Dx())
+	} else if bounds.Dy() > bounds.Dx() {
+		w = max(1, size*bounds.Dx()/bounds.Dy())
+	}
+	x, y := (size-w)/2, (size-h)/2
+
+	dst := image.NewNRGBA(image.Rect(0, 0, size, size))
+	draw.CatmullRom.Scale(dst, image.Rect(x, y, x+w, y+h), img, bounds, draw.Over, nil)
+
+	buf := bytes.Buffer{}
+	encoder := png.Encoder{CompressionLevel: png.BestCompression}
+	if err := encoder.Encode(&buf, dst); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
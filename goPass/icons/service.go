@@ -0,0 +1,245 @@
+package icons
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"net"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/net/idna"
+	"golang.org/x/net/publicsuffix"
+)
+
+var (
+	ErrInvalidDomain = errors.New("not a valid domain")
+	ErrInvalidSize   = errors.New("size must be 16, 32 or 64")
+	labelPattern     = regexp.MustCompile(`^[a-z0-9]([a-z0-9-]{0,61}[a-z0-9])?$`)
+)
+
+// Sizes are the square PNG sizes icons are rendered at.
+var Sizes = []int{16, 32, 64}
+
+const (
+	DefaultSize  = 32
+	fetchTimeout = 20 * time.Second
+	// a domain without an icon is asked again after at most a day
+	maxMissTTL = 24 * time.Hour
+	// misses are only remembered in memory, so made up domains can't fill
+	// the disk. Beyond this many the oldest are forgotten.
+	maxMisses = 10000
+)
+
+type call struct {
+	done chan struct{}
+	err  error
+}
+
+// Service resolves icons from a Source and keeps the rendered PNGs on disk.
+// Files are named by a hash of the domain, so the cache isn't a readable
+// list of the sites people have saved, and nothing about who asked is kept.
+type Service struct {
+	source Source
+	dir    string
+	ttl    time.Duration
+
+	mu       sync.Mutex
+	inflight map[string]*call
+	misses   map[string]time.Time // cache key to when the miss expires
+}
+
+func NewService(source Source, dir string, ttl time.Duration) (*Service, error) {
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return nil, err
+	}
+	return &Service{source: source, dir: dir, ttl: ttl, inflight: map[string]*call{}, misses: map[string]time.Time{}}, nil
+}
+
+// NormalizeDomain lower cases domain, converts it to its ASCII form and
+// reduces it to its registrable domain, so mail.example.com and
+// www.example.com share the icon of example.com and made up hosts under a
+// domain don't each cost a fetch. IP addresses and bare public suffixes are
+// refused.
+func NormalizeDomain(domain string) (string, error) {
+	domain = strings.TrimSuffix(strings.ToLower(strings.TrimSpace(domain)), ".")
+	ascii, err := idna.Lookup.ToASCII(domain)
+	if err != nil || len(ascii) > 253 || net.ParseIP(ascii) != nil {
+		return "", ErrInvalidDomain
+	}
+	for _, label := range strings.Split(ascii, ".") {
+		if !labelPattern.MatchString(label) {
+			return "", ErrInvalidDomain
+		}
+	}
+	base, err := publicsuffix.EffectiveTLDPlusOne(ascii)
+	if err != nil {
+		return "", ErrInvalidDomain
+	}
+	return base, nil
+}
+
+// Icon returns the PNG icon of domain at size pixels, fetching it when the
+// cached copy is missing or older than the TTL. A stale copy is served when
+// the refresh fails for any reason other than the site having no icon.
+func (s *Service) Icon(ctx context.Context, domain string, size int) ([]byte, error) {
+	domain, err := NormalizeDomain(domain)
+	if err != nil {
+		return nil, err
+	}
+	if !validSize(size) {
+		return nil, ErrInvalidSize
+	}
+
+	key := cacheKey(domain)
+	path := s.path(key, strconv.Itoa(size)+".png")
+	if s.fresh(path, s.ttl) {
+		return os.ReadFile(path)
+	}
+	if s.missed(key) {
+		return nil, ErrNotFound
+	}
+
+	if err := s.refresh(ctx, domain, key); err != nil {
+		if !errors.Is(err, ErrNotFound) {
+			if data, readErr := os.ReadFile(path); readErr == nil {
+				return data, nil
+			}
+		}
+		return nil, err
+	}
+	return os.ReadFile(path)
+}
+
+// refresh fetches and renders a domain once, however many requests for it
+// arrive meanwhile. The fetch isn't cancelled with the request that started
+// it, since others may be waiting on it.
+func (s *Service) refresh(ctx context.Context, domain, key string) error {
+	s.mu.Lock()
+	if c, ok := s.inflight[key]; ok {
+		s.mu.Unlock()
+		select {
+		case <-c.done:
+			return c.err
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+	c := &call{done: make(chan struct{})}
+	s.inflight[key] = c
+	s.mu.Unlock()
+
+	fetchCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), fetchTimeout)
+	c.err = s.fetch(fetchCtx, domain, key)
+	cancel()
+
+	s.mu.Lock()
+	delete(s.inflight, key)
+	s.mu.Unlock()
+	close(c.done)
+	return c.err
+}
+
+func (s *Service) fetch(ctx context.Context, domain, key string) error {
+	data, err := s.source.Fetch(ctx, domain)
+	if errors.Is(err, ErrNotFound) {
+		s.miss(key)
+		return err
+	}
+	if err != nil {
+		return err
+	}
+
+	img, err := decode(data)
+	if err != nil {
+		s.miss(key)
+		return ErrNotFound
+	}
+	for _, size := range Sizes {
+		png, err := render(img, size)
+		if err != nil {
+			return err
+		}
+		if err := s.write(s.path(key, strconv.Itoa(size)+".png"), png); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *Service) missed(key string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	expires, ok := s.misses[key]
+	return ok && time.Now().Before(expires)
+}
+
+func (s *Service) miss(key string) {
+	now := time.Now()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if len(s.misses) >= maxMisses {
+		oldest, oldestKey := time.Time{}, ""
+		for k, expires := range s.misses {
+			if now.After(expires) {
+				delete(s.misses, k)
+			} else if oldestKey == "" || expires.Before(oldest) {
+				oldest, oldestKey = expires, k
+			}
+		}
+		if len(s.misses) >= maxMisses {
+			delete(s.misses, oldestKey)
+		}
+	}
+	s.misses[key] = now.Add(min(s.ttl, maxMissTTL))
+}
+
+func (s *Service) fresh(path string, ttl time.Duration) bool {
+	info, err := os.Stat(path)
+	return err == nil && time.Since(info.ModTime()) < ttl
+}
+
+// write replaces a cache file atomically, so readers never see half of it.
+func (s *Service) write(path string, data []byte) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".tmp-*")
+	if err != nil {
+		return err
+	}
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+func (s *Service) path(key, name string) string {
+	return filepath.Join(s.dir, key[:2], key+"-"+name)
+}
+
+func cacheKey(domain string) string {
+	sum := sha256.Sum256([]byte(domain))
+	return hex.EncodeToString(sum[:])
+}
+
+func validSize(size int) bool {
+	for _, s := range Sizes {
+		if s == size {
+			return true
+		}
+	}
+	return false
+}
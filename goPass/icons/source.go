@@ -0,0 +1,270 @@
+package icons
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/netip"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"golang.org/x/net/html"
+)
+
+var ErrNotFound = errors.New("icon not found")
+
+// Source finds the raw favicon of a domain.
+type Source interface {
+	Fetch(ctx context.Context, domain string) ([]byte, error)
+}
+
+// DirSource serves icons from a directory of <domain>.<ext> files, for
+// offline servers and tests.
+type DirSource struct {
+	Dir string
+}
+
+var fixtureExtensions = []string{".png", ".ico", ".gif", ".jpg", ".jpeg", ".webp", ".bmp"}
+
+func (s DirSource) Fetch(ctx context.Context, domain string) ([]byte, error) {
+	for _, ext := range fixtureExtensions {
+		data, err := os.ReadFile(filepath.Join(s.Dir, domain+ext))
+		if err == nil {
+			return data, nil
+		}
+		if !errors.Is(err, os.ErrNotExist) {
+			return nil, err
+		}
+	}
+	return nil, ErrNotFound
+}
+
+const (
+	maxPageSize = 1 << 20
+	maxIconSize = 512 << 10
+	userAgent   = "Mozilla/5.0 (compatible; goPass-icons/1.0)"
+)
+
+// RemoteSource fetches icons from the sites themselves. Requests carry no
+// cookies, referrer or anything from the client that asked for the icon,
+// and only go to public addresses so the server can't be pointed at its own
+// network.
+type RemoteSource struct {
+	Client *http.Client
+}
+
+func NewRemoteSource() *RemoteSource {
+	dialer := &net.Dialer{
+		Timeout: 5 * time.Second,
+		Control: func(network, address string, _ syscall.RawConn) error {
+			host, _, err := net.SplitHostPort(address)
+			if err != nil {
+				return err
+			}
+			if ip := net.ParseIP(host); ip == nil || !isPublic(ip) {
+				return fmt.Errorf("refusing to fetch icons from %s", host)
+			}
+			return nil
+		},
+	}
+	return &RemoteSource{
+		Client: &http.Client{
+			Timeout: 10 * time.Second,
+			Transport: &http.Transport{
+				DialContext:         dialer.DialContext,
+				TLSHandshakeTimeout: 5 * time.Second,
+				MaxIdleConns:        16,
+			},
+			CheckRedirect: func(req *http.Request, via []*http.Request) error {
+				if len(via) >= 3 {
+					return errors.New("too many redirects")
+				}
+				return nil
+			},
+		},
+	}
+}
+
+// nonGlobal lists the special purpose ranges from the IANA registries that
+// aren't reachable on the public internet, or lead back into private ones
+// like NAT64 and 6to4 do.
+var nonGlobal = []netip.Prefix{
+	netip.MustParsePrefix("0.0.0.0/8"),
+	netip.MustParsePrefix("10.0.0.0/8"),
+	netip.MustParsePrefix("100.64.0.0/10"),
+	netip.MustParsePrefix("127.0.0.0/8"),
+	netip.MustParsePrefix("169.254.0.0/16"),
+	netip.MustParsePrefix("172.16.0.0/12"),
+	netip.MustParsePrefix("192.0.0.0/24"),
+	netip.MustParsePrefix("192.0.2.0/24"),
+	netip.MustParsePrefix("192.88.99.0/24"),
+	netip.MustParsePrefix("192.168.0.0/16"),
+	netip.MustParsePrefix("198.18.0.0/15"),
+	netip.MustParsePrefix("198.51.100.0/24"),
+	netip.MustParsePrefix("203.0.113.0/24"),
+	netip.MustParsePrefix("224.0.0.0/4"),
+	netip.MustParsePrefix("240.0.0.0/4"),
+	netip.MustParsePrefix("::/128"),
+	netip.MustParsePrefix("::1/128"),
+	netip.MustParsePrefix("::ffff:0:0/96"),
+	netip.MustParsePrefix("64:ff9b::/96"),
+	netip.MustParsePrefix("64:ff9b:1::/48"),
+	netip.MustParsePrefix("100::/64"),
+	netip.MustParsePrefix("2001::/23"),
+	netip.MustParsePrefix("2001:db8::/32"),
+	netip.MustParsePrefix("2002::/16"),
+	netip.MustParsePrefix("fc00::/7"),
+	netip.MustParsePrefix("fe80::/10"),
+	netip.MustParsePrefix("fec0::/10"),
+	netip.MustParsePrefix("ff00::/8"),
+}
+
+func isPublic(ip net.IP) bool {
+	addr, ok := netip.AddrFromSlice(ip)
+	if !ok {
+		return false
+	}
+	addr = addr.Unmap()
+	for _, prefix := range nonGlobal {
+		if prefix.Contains(addr) {
+			return false
+		}
+	}
+	return true
+}
+
+// Fetch tries the icons the home page links to, largest first, and then
+// /favicon.ico. The first one that decodes wins.
+func (s *RemoteSource) Fetch(ctx context.Context, domain string) ([]byte, error) {
+	home := &url.URL{Scheme: "https", Host: domain, Path: "/"}
+	candidates := []string{}
+	if body, base, err := s.get(ctx, home.String(), maxPageSize); err == nil {
+		candidates = iconLinks(body, base)
+	}
+	candidates = append(candidates, home.ResolveReference(&url.URL{Path: "/favicon.ico"}).String())
+
+	for _, candidate := range candidates {
+		data, _, err := s.get(ctx, candidate, maxIconSize)
+		if err != nil {
+			continue
+		}
+		if _, err := decode(data); err == nil {
+			return data, nil
+		}
+	}
+	return nil, ErrNotFound
+}
+
+// get returns the body and the final URL after redirects.
+func (s *RemoteSource) get(ctx context.Context, target string, limit int64) ([]byte, *url.URL, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, target, nil)
+	if err != nil {
+		return nil, nil, err
+	}
+	req.Header.Set("User-Agent", userAgent)
+
+	res, err := s.Client.Do(req)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		return nil, nil, fmt.Errorf("%s returned %s", target, res.Status)
+	}
+	body, err := io.ReadAll(io.LimitReader(res.Body, limit+1))
+	if err != nil {
+		return nil, nil, err
+	}
+	if int64(len(body)) > limit {
+		return nil, nil, fmt.Errorf("%s is larger than %d bytes", target, limit)
+	}
+	return body, res.Request.URL, nil
+}
+
+// iconLinks returns the http(s) icons linked from a page, largest declared
+// size first.
+func iconLinks(page []byte, base *url.URL) []string {
+	type link struct {
+		href string
+		size int
+	}
+	links := []link{}
+
+	tokens := html.NewTokenizer(strings.NewReader(string(page)))
+scan:
+	for {
+		switch tokens.Next() {
+		case html.ErrorToken:
+			break scan
+		case html.StartTagToken, html.SelfClosingTagToken:
+			name, hasAttr := tokens.TagName()
+			if string(name) == "body" {
+				// icons belong in the head, don't scan the whole page
+				break scan
+			}
+			if string(name) != "link" || !hasAttr {
+				continue
+			}
+			attrs := map[string]string{}
+			for more := true; more; {
+				var key, value []byte
+				key, value, more = tokens.TagAttr()
+				attrs[string(key)] = string(value)
+			}
+			if !isIconRel(attrs["rel"]) || attrs["href"] == "" {
+				continue
+			}
+			ref, err := url.Parse(strings.TrimSpace(attrs["href"]))
+			if err != nil {
+				continue
+			}
+			resolved := base.ResolveReference(ref)
+			if resolved.Scheme != "https" && resolved.Scheme != "http" {
+				continue
+			}
+			links = append(links, link{href: resolved.String(), size: declaredSize(attrs["sizes"], attrs["rel"])})
+		}
+	}
+
+	sort.SliceStable(links, func(i, j int) bool { return links[i].size > links[j].size })
+	hrefs := make([]string, len(links))
+	for i, l := range links {
+		hrefs[i] = l.href
+	}
+	return hrefs
+}
+
+func isIconRel(rel string) bool {
+	for _, r := range strings.Fields(strings.ToLower(rel)) {
+		if r == "icon" || r == "apple-touch-icon" || r == "apple-touch-icon-precomposed" {
+			return true
+		}
+	}
+	return false
+}
+
+// declaredSize reads the largest width from a sizes attribute such as
+// "16x16 32x32". Touch icons are 180 pixels when nothing says otherwise.
+func declaredSize(sizes, rel string) int {
+	size := 0
+	for _, s := range strings.Fields(strings.ToLower(sizes)) {
+		if w, _, ok := strings.Cut(s, "x"); ok {
+			if n, err := strconv.Atoi(w); err == nil && n > size {
+				size = n
+			}
+		}
+	}
+	if size == 0 && strings.Contains(strings.ToLower(rel), "apple-touch-icon") {
+		size = 180
+	}
+	return size
+}
@@ -0,0 +1,179 @@
+package importer
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+
+	"goPass/models"
+)
+
+type bitwardenExport struct {
+	Encrypted bool `json:"encrypted"`
+	Folders   []struct {
+		ID   string `json:"id"`
+		Name string `json:"name"`
+	} `json:"folders"`
+	Items []bitwardenItem `json:"items"`
+}
+
+type bitwardenItem struct {
+	Type     int     `json:"type"`
+	Name     string  `json:"name"`
+	Notes    *string `json:"notes"`
+	Favorite bool    `json:"favorite"`
+	FolderID *string `json:"folderId"`
+	Login    *struct {
+		Username *string `json:"username"`
+		Password *string `json:"password"`
+		TOTP     *string `json:"totp"`
+		URIs     []struct {
+			URI *string `json:"uri"`
+		} `json:"uris"`
+	} `json:"login"`
+	Card *struct {
+		CardholderName *string `json:"cardholderName"`
+		Brand          *string `json:"brand"`
+		Number         *string `json:"number"`
+		ExpMonth       *string `json:"expMonth"`
+		ExpYear        *string `json:"expYear"`
+		Code           *string `json:"code"`
+	} `json:"card"`
+	Identity map[string]*string `json:"identity"`
+	SSHKey   *struct {
+		PrivateKey     *string `json:"privateKey"`
+		PublicKey      *string `json:"publicKey"`
+		KeyFingerprint *string `json:"keyFingerprint"`
+	} `json:"sshKey"`
+	Fields []struct {
+		Name  *string `json:"name"`
+		Value *string `json:"value"`
+		Type  int     `json:"type"`
+	} `json:"fields"`
+}
+
+// Bitwarden item and custom field type numbers.
+const (
+	bitwardenLogin      = 1
+	bitwardenSecureNote = 2
+	bitwardenCard       = 3
+	bitwardenIdentity   = 4
+	bitwardenSSHKey     = 5
+
+	bitwardenFieldHidden = 1
+	bitwardenFieldLinked = 3
+)
+
+// identity keys Bitwarden uses that map onto models.IdentityPayload
+var bitwardenIdentityKeys = map[string]string{
+	"title":          "title",
+	"firstName":      "firstName",
+	"middleName":     "middleName",
+	"lastName":       "lastName",
+	"email":          "email",
+	"phone":          "phone",
+	"address1":       "address1",
+	"address2":       "address2",
+	"city":           "city",
+	"state":          "state",
+	"postalCode":     "postalCode",
+	"country":        "country",
+	"passportNumber": "passport",
+	"licenseNumber":  "license",
+}
+
+// ParseBitwarden reads an unencrypted Bitwarden JSON export. Password
+// protected and account restricted exports can't be opened without
+// Bitwarden's keys and are refused.
+func ParseBitwarden(data []byte) (*Result, error) {
+	export := bitwardenExport{}
+	if err := json.Unmarshal(data, &export); err != nil {
+		return nil, fmt.Errorf("not a bitwarden json export: %w", err)
+	}
+	if export.Encrypted {
+		return nil, errors.New("encrypted bitwarden exports are not supported, export as unencrypted json")
+	}
+
+	folders := map[string]string{}
+	for _, f := range export.Folders {
+		folders[f.ID] = f.Name
+	}
+
+	res := &Result{Items: []Item{}, Errors: []RowError{}}
+	for i, bw := range export.Items {
+		item := Item{
+			Row:      i + 1,
+			Name:     bw.Name,
+			Notes:    str(bw.Notes),
+			Favorite: bw.Favorite,
+		}
+		if bw.FolderID != nil {
+			item.Folder = folders[*bw.FolderID]
+		}
+
+		switch bw.Type {
+		case bitwardenLogin:
+			item.Type = models.ItemTypeLogin
+			if bw.Login != nil {
+				item.Username = str(bw.Login.Username)
+				item.Password = str(bw.Login.Password)
+				item.TOTP = str(bw.Login.TOTP)
+				for _, u := range bw.Login.URIs {
+					if uri := str(u.URI); uri != "" {
+						item.URIs = append(item.URIs, uri)
+					}
+				}
+			}
+		case bitwardenSecureNote:
+			item.Type = models.ItemTypeSecureNote
+		case bitwardenCard:
+			item.Type = models.ItemTypeCard
+			if bw.Card != nil {
+				item.Data = setData(item.Data, "cardholderName", str(bw.Card.CardholderName))
+				item.Data = setData(item.Data, "brand", str(bw.Card.Brand))
+				item.Data = setData(item.Data, "number", str(bw.Card.Number))
+				item.Data = setData(item.Data, "expMonth", str(bw.Card.ExpMonth))
+				item.Data = setData(item.Data, "expYear", str(bw.Card.ExpYear))
+				item.Data = setData(item.Data, "code", str(bw.Card.Code))
+			}
+		case bitwardenIdentity:
+			item.Type = models.ItemTypeIdentity
+			for from, to := range bitwardenIdentityKeys {
+				item.Data = setData(item.Data, to, str(bw.Identity[from]))
+			}
+		case bitwardenSSHKey:
+			item.Type = models.ItemTypeSSHKey
+			if bw.SSHKey != nil {
+				item.Data = setData(item.Data, "privateKey", str(bw.SSHKey.PrivateKey))
+				item.Data = setData(item.Data, "publicKey", str(bw.SSHKey.PublicKey))
+				item.Data = setData(item.Data, "fingerprint", str(bw.SSHKey.KeyFingerprint))
+			}
+		default:
+			res.fail(item.Row, errors.New("unknown bitwarden item type "+strconv.Itoa(bw.Type)))
+			continue
+		}
+
+		for _, f := range bw.Fields {
+			// linked fields point at Bitwarden's own field ids, which mean
+			// nothing here
+			if f.Type == bitwardenFieldLinked {
+				continue
+			}
+			item.Fields = append(item.Fields, Field{
+				Name:   str(f.Name),
+				Value:  str(f.Value),
+				Hidden: f.Type == bitwardenFieldHidden,
+			})
+		}
+		res.add(item)
+	}
+	return res, nil
+}
+
+func str(s *string) string {
+	if s == nil {
+		return ""
+	}
+	return *s
+}
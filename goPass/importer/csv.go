@@ -0,0 +1,109 @@
+package importer
+
+import (
+	"bytes"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// csvColumns maps the header names used by Chrome, Edge, Firefox, Safari,
+// Bitwarden and LastPass CSV exports onto item fields. Columns not listed
+// here, like Firefox's guid or timestamps, are ignored.
+var csvColumns = map[string]string{
+	"name":           "name",
+	"title":          "name",
+	"url":            "url",
+	"uri":            "url",
+	"website":        "url",
+	"login_uri":      "url",
+	"username":       "username",
+	"user name":      "username",
+	"login":          "username",
+	"login_username": "username",
+	"email":          "username",
+	"password":       "password",
+	"login_password": "password",
+	"note":           "notes",
+	"notes":          "notes",
+	"extra":          "notes",
+	"otpauth":        "totp",
+	"totp":           "totp",
+	"login_totp":     "totp",
+	"folder":         "folder",
+	"grouping":       "folder",
+	"favorite":       "favorite",
+	"fav":            "favorite",
+}
+
+// ParseCSV reads a browser or generic password CSV with a header row. Only
+// logins can be expressed in CSV. Rows are counted as file lines, the
+// header being line 1.
+func ParseCSV(data []byte) (*Result, error) {
+	data = bytes.TrimPrefix(data, []byte("\xef\xbb\xbf"))
+	reader := csv.NewReader(bytes.NewReader(data))
+	reader.FieldsPerRecord = -1
+
+	header, err := reader.Read()
+	if err != nil {
+		return nil, fmt.Errorf("not a csv file: %w", err)
+	}
+	columns := make([]string, len(header))
+	found := false
+	for i, name := range header {
+		columns[i] = csvColumns[strings.ToLower(strings.TrimSpace(name))]
+		if columns[i] == "password" {
+			found = true
+		}
+	}
+	if !found {
+		return nil, errors.New("csv header has no password column")
+	}
+
+	res := &Result{Items: []Item{}, Errors: []RowError{}}
+	for {
+		record, err := reader.Read()
+		if err != nil {
+			var parseErr *csv.ParseError
+			if errors.As(err, &parseErr) {
+				res.fail(parseErr.StartLine, parseErr.Err)
+				continue
+			}
+			break
+		}
+		line, _ := reader.FieldPos(0)
+		if len(record) != len(columns) {
+			res.fail(line, fmt.Errorf("expected %d columns, got %d", len(columns), len(record)))
+			continue
+		}
+
+		item := Item{Row: line}
+		for i, value := range record {
+			switch columns[i] {
+			case "name":
+				item.Name = value
+			case "url":
+				if value != "" {
+					item.URIs = append(item.URIs, value)
+				}
+			case "username":
+				if item.Username == "" {
+					item.Username = value
+				}
+			case "password":
+				item.Password = value
+			case "notes":
+				item.Notes = value
+			case "totp":
+				item.TOTP = value
+			case "folder":
+				item.Folder = value
+			case "favorite":
+				item.Favorite = value == "1" || strings.EqualFold(value, "true")
+			}
+		}
+		res.add(item)
+	}
+	return res, nil
+}
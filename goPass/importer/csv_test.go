@@ -0,0 +1,71 @@
+package importer
+
+import (
+	"testing"
+
+	"goPass/models"
+)
+
+func TestParseCSV(t *testing.T) {
+	res, err := ParseCSV(readFixture(t, "passwords.csv"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// rows are file lines: the header is line 1 and the quoted note of
+	// Bank spans lines 3 and 4
+	checkResult(t, res, []Item{
+		{Row: 2, Type: models.ItemTypeLogin, Name: "GitHub", Username: "octocat", Password: "hunter2", URIs: []string{"https://github.com"}},
+		{Row: 3, Type: models.ItemTypeLogin, Name: "Bank", Username: "jane", Password: "pa55", URIs: []string{"https://bank.example"}, Notes: "first line\nsecond line"},
+		{Row: 6, Type: models.ItemTypeLogin, Name: "example.org", Username: "bob", Password: "pw", URIs: []string{"https://www.example.org/login"}},
+		{Row: 9, Type: models.ItemTypeLogin, Name: "Last", Username: "carol", Password: "pw", URIs: []string{"https://last.example"}},
+	}, []RowError{
+		{Row: 5, Error: "expected 5 columns, got 3"},
+		{Row: 7, Error: "login has no username, password or totp"},
+		{Row: 8, Error: "bare \" in non-quoted-field"},
+	})
+}
+
+func TestParseCSVHeaders(t *testing.T) {
+	tests := []struct {
+		name string
+		data string
+		want Item
+		err  bool
+	}{
+		{
+			name: "firefox",
+			data: "url,username,password,httpRealm,formActionOrigin,guid,timeCreated\nhttps://example.com,jane,pw,,,{1},1\n",
+			want: Item{Row: 2, Type: models.ItemTypeLogin, Name: "example.com", Username: "jane", Password: "pw", URIs: []string{"https://example.com"}},
+		},
+		{
+			name: "bitwarden",
+			data: "folder,favorite,type,name,notes,fields,reprompt,login_uri,login_username,login_password,login_totp\nWork,1,login,Mail,,,0,https://mail.example,jane,pw,JBSWY3DP\n",
+			want: Item{Row: 2, Type: models.ItemTypeLogin, Name: "Mail", Username: "jane", Password: "pw", URIs: []string{"https://mail.example"}, TOTP: "JBSWY3DP", Folder: "Work", Favorite: true},
+		},
+		{
+			name: "lastpass keeps the first username column",
+			data: "url,username,password,totp,extra,name,grouping,fav,email\nhttps://a.example,jane,pw,,notes,A,Home,0,jane@example.com\n",
+			want: Item{Row: 2, Type: models.ItemTypeLogin, Name: "A", Username: "jane", Password: "pw", URIs: []string{"https://a.example"}, Notes: "notes", Folder: "Home"},
+		},
+		{
+			name: "no password column",
+			data: "name,url\nA,https://a.example\n",
+			err:  true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			res, err := ParseCSV([]byte(tt.data))
+			if tt.err {
+				if err == nil {
+					t.Fatal("header accepted")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			checkResult(t, res, []Item{tt.want}, nil)
+		})
+	}
+}
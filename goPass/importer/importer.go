@@ -0,0 +1,161 @@
+// Package importer turns exports of other password managers into plaintext
+// items the goPass client can encrypt and upload. It never touches the
+// database and never keeps what it parsed, callers should hand the items
+// back to the client and drop them.
+package importer
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+
+	"goPass/models"
+)
+
+const (
+	FormatBitwarden   = "bitwarden"
+	Format1Password   = "1pux"
+	FormatKeePassXML  = "keepass"
+	FormatCSV         = "csv"
+	MaxItems          = 5000
+	maxFieldValueSize = 64 * 1024
+)
+
+var Formats = []string{FormatBitwarden, Format1Password, FormatKeePassXML, FormatCSV}
+
+var ErrTooManyItems = fmt.Errorf("import is limited to %d items", MaxItems)
+
+// Item is one entry in goPass terms. Name and Username become PlatformName
+// and EntryKey, Password is the login password and Data carries the type
+// payload keyed like the models.*Payload structs, so the client can encrypt
+// it without knowing where the item came from.
+type Item struct {
+	Row       int               `json:"row"`
+	Type      string            `json:"type"`
+	Name      string            `json:"name"`
+	Username  string            `json:"username,omitempty"`
+	Password  string            `json:"password,omitempty"`
+	URIs      []string          `json:"uris,omitempty"`
+	Notes     string            `json:"notes,omitempty"`
+	TOTP      string            `json:"totp,omitempty"`
+	Folder    string            `json:"folder,omitempty"`
+	Favorite  bool              `json:"favorite"`
+	Data      map[string]string `json:"data,omitempty"`
+	Fields    []Field           `json:"fields,omitempty"`
+	Duplicate bool              `json:"duplicate"`
+}
+
+type Field struct {
+	Name   string `json:"name"`
+	Value  string `json:"value"`
+	Hidden bool   `json:"hidden"`
+}
+
+// RowError points at an entry of the source file that could not be
+// imported. Row is 1 based and counts entries, or lines for CSV.
+type RowError struct {
+	Row   int    `json:"row"`
+	Error string `json:"error"`
+}
+
+type Result struct {
+	Items  []Item     `json:"items"`
+	Errors []RowError `json:"errors"`
+}
+
+// Parse dispatches to the parser for format. A broken file fails as a
+// whole, a broken entry only adds a RowError.
+func Parse(format string, data []byte) (*Result, error) {
+	var res *Result
+	var err error
+	switch format {
+	case FormatBitwarden:
+		res, err = ParseBitwarden(data)
+	case Format1Password:
+		res, err = Parse1PUX(data)
+	case FormatKeePassXML:
+		res, err = ParseKeePassXML(data)
+	case FormatCSV:
+		res, err = ParseCSV(data)
+	default:
+		return nil, fmt.Errorf("unknown import format %q", format)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if len(res.Items) > MaxItems {
+		return nil, ErrTooManyItems
+	}
+	return res, nil
+}
+
+func (r *Result) add(item Item) {
+	if err := item.normalize(); err != nil {
+		r.fail(item.Row, err)
+		return
+	}
+	r.Items = append(r.Items, item)
+}
+
+func (r *Result) fail(row int, err error) {
+	r.Errors = append(r.Errors, RowError{Row: row, Error: err.Error()})
+}
+
+// normalize fills in what other managers leave optional but goPass needs,
+// and rejects items that would not fit an entry.
+func (i *Item) normalize() error {
+	i.Name = strings.TrimSpace(i.Name)
+	i.Username = strings.TrimSpace(i.Username)
+	if i.Type == "" {
+		i.Type = models.ItemTypeLogin
+	}
+	if i.Name == "" {
+		for _, uri := range i.URIs {
+			if host := hostOf(uri); host != "" {
+				i.Name = host
+				break
+			}
+		}
+	}
+	if i.Name == "" {
+		return errors.New("entry has no name or url")
+	}
+	if i.Type == models.ItemTypeLogin && i.Username == "" && i.Password == "" && i.TOTP == "" {
+		return errors.New("login has no username, password or totp")
+	}
+
+	size := len(i.Password) + len(i.Notes)
+	for _, v := range i.Data {
+		size += len(v)
+	}
+	for _, f := range i.Fields {
+		size += len(f.Name) + len(f.Value)
+	}
+	if size > maxFieldValueSize {
+		return errors.New("entry too large")
+	}
+	return nil
+}
+
+func hostOf(uri string) string {
+	if !strings.Contains(uri, "://") {
+		uri = "https://" + uri
+	}
+	u, err := url.Parse(uri)
+	if err != nil {
+		return ""
+	}
+	return strings.TrimPrefix(u.Hostname(), "www.")
+}
+
+func setData(data map[string]string, key, value string) map[string]string {
+	if value == "" {
+		return data
+	}
+	if data == nil {
+		data = map[string]string{}
+	}
+	data[key] = value
+	return data
+}
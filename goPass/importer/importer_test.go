@@ -0,0 +1,122 @@
+package importer
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"goPass/models"
+)
+
+func readFixture(t *testing.T, name string) []byte {
+	t.Helper()
+	data, err := os.ReadFile(filepath.Join("testdata", name))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return data
+}
+
+// checkResult compares what a parser produced with the expected items and
+// row errors. Errors are matched on their row and a part of the message.
+func checkResult(t *testing.T, res *Result, items []Item, errs []RowError) {
+	t.Helper()
+	if len(res.Items) != len(items) {
+		t.Fatalf("got %d items, want %d: %+v", len(res.Items), len(items), res.Items)
+	}
+	for i := range items {
+		if !reflect.DeepEqual(res.Items[i], items[i]) {
+			t.Errorf("item %d\n got %+v\nwant %+v", i, res.Items[i], items[i])
+		}
+	}
+	if len(res.Errors) != len(errs) {
+		t.Fatalf("got errors %+v, want %+v", res.Errors, errs)
+	}
+	for i := range errs {
+		if res.Errors[i].Row != errs[i].Row || !strings.Contains(res.Errors[i].Error, errs[i].Error) {
+			t.Errorf("error %d: got %+v, want %+v", i, res.Errors[i], errs[i])
+		}
+	}
+}
+
+func TestNormalize(t *testing.T) {
+	tests := []struct {
+		name string
+		item Item
+		want Item
+		err  string
+	}{
+		{
+			name: "defaults to login and trims",
+			item: Item{Name: "  GitHub ", Username: " octocat ", Password: "pw"},
+			want: Item{Type: models.ItemTypeLogin, Name: "GitHub", Username: "octocat", Password: "pw"},
+		},
+		{
+			name: "name from the first usable uri",
+			item: Item{Password: "pw", URIs: []string{"", "www.example.com/login", "https://other.example"}},
+			want: Item{Type: models.ItemTypeLogin, Name: "example.com", Password: "pw", URIs: []string{"", "www.example.com/login", "https://other.example"}},
+		},
+		{
+			name: "no name and no uri",
+			item: Item{Password: "pw"},
+			err:  "entry has no name or url",
+		},
+		{
+			name: "login without credentials",
+			item: Item{Name: "Empty", Notes: "only notes"},
+			err:  "login has no username, password or totp",
+		},
+		{
+			name: "login with only a totp",
+			item: Item{Name: "2FA", TOTP: "otpauth://totp/x?secret=A"},
+			want: Item{Type: models.ItemTypeLogin, Name: "2FA", TOTP: "otpauth://totp/x?secret=A"},
+		},
+		{
+			name: "notes don't need credentials",
+			item: Item{Type: models.ItemTypeSecureNote, Name: "Note"},
+			want: Item{Type: models.ItemTypeSecureNote, Name: "Note"},
+		},
+		{
+			name: "too large",
+			item: Item{Name: "Big", Password: "pw", Fields: []Field{{Name: "blob", Value: strings.Repeat("x", maxFieldValueSize)}}},
+			err:  "entry too large",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			item := tt.item
+			err := item.normalize()
+			if tt.err != "" {
+				if err == nil || err.Error() != tt.err {
+					t.Fatalf("err = %v, want %q", err, tt.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(item, tt.want) {
+				t.Fatalf("\n got %+v\nwant %+v", item, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseRefusesUnknownFormats(t *testing.T) {
+	if _, err := Parse("lastpass", []byte("{}")); err == nil {
+		t.Fatal("unknown format accepted")
+	}
+}
+
+func TestParseLimitsItems(t *testing.T) {
+	var csv strings.Builder
+	csv.WriteString("name,password\n")
+	for i := 0; i <= MaxItems; i++ {
+		csv.WriteString("x,pw\n")
+	}
+	if _, err := Parse(FormatCSV, []byte(csv.String())); err != ErrTooManyItems {
+		t.Fatalf("err = %v, want ErrTooManyItems", err)
+	}
+}
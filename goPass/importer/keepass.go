@@ -0,0 +1,108 @@
+package importer
+
+import (
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"strings"
+
+	"goPass/models"
+)
+
+type keePassFile struct {
+	Meta struct {
+		RecycleBinUUID string `xml:"RecycleBinUUID"`
+	} `xml:"Meta"`
+	Root struct {
+		Groups []keePassGroup `xml:"Group"`
+	} `xml:"Root"`
+}
+
+type keePassGroup struct {
+	UUID    string         `xml:"UUID"`
+	Name    string         `xml:"Name"`
+	Entries []keePassEntry `xml:"Entry"`
+	Groups  []keePassGroup `xml:"Group"`
+}
+
+// keePassEntry skips <History>, older versions of an entry are not imported.
+type keePassEntry struct {
+	Strings []struct {
+		Key   string `xml:"Key"`
+		Value struct {
+			Text      string `xml:",chardata"`
+			Protected string `xml:"Protected,attr"`
+		} `xml:"Value"`
+	} `xml:"String"`
+}
+
+// ParseKeePassXML reads the unencrypted XML export of KeePass 2 and KeePassXC.
+// Groups below the root become folder paths like "Work/Email" and the
+// recycle bin is skipped.
+func ParseKeePassXML(data []byte) (*Result, error) {
+	file := keePassFile{}
+	dec := xml.NewDecoder(bytes.NewReader(data))
+	if err := dec.Decode(&file); err != nil {
+		return nil, fmt.Errorf("not a keepass xml export: %w", err)
+	}
+
+	res := &Result{Items: []Item{}, Errors: []RowError{}}
+	row := 0
+	var walk func(group keePassGroup, path string)
+	walk = func(group keePassGroup, path string) {
+		if file.Meta.RecycleBinUUID != "" && group.UUID == file.Meta.RecycleBinUUID {
+			return
+		}
+		for _, entry := range group.Entries {
+			row++
+			item := Item{Row: row, Type: models.ItemTypeLogin, Folder: path}
+			for _, s := range entry.Strings {
+				value := s.Value.Text
+				switch s.Key {
+				case "Title":
+					item.Name = value
+				case "UserName":
+					item.Username = value
+				case "Password":
+					item.Password = value
+				case "URL":
+					if value != "" {
+						item.URIs = append(item.URIs, value)
+					}
+				case "Notes":
+					item.Notes = value
+				case "otp", "TOTP Seed":
+					item.TOTP = value
+				default:
+					if value == "" {
+						continue
+					}
+					item.Fields = append(item.Fields, Field{
+						Name:   s.Key,
+						Value:  value,
+						Hidden: strings.EqualFold(s.Value.Protected, "true"),
+					})
+				}
+			}
+			// KeePass has no note type, an entry with nothing but notes is
+			// what its users write secure notes as
+			if item.Username == "" && item.Password == "" && item.TOTP == "" && len(item.URIs) == 0 && item.Notes != "" {
+				item.Type = models.ItemTypeSecureNote
+			}
+			res.add(item)
+		}
+		for _, child := range group.Groups {
+			childPath := child.Name
+			if path != "" {
+				childPath = path + "/" + child.Name
+			}
+			walk(child, childPath)
+		}
+	}
+
+	// the single top level group is the database itself, not a folder
+	for _, root := range file.Root.Groups {
+		walk(root, "")
+	}
+	return res, nil
+}
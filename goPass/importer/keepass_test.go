@@ -0,0 +1,32 @@
+package importer
+
+import (
+	"testing"
+
+	"goPass/models"
+)
+
+func TestParseKeePassXML(t *testing.T) {
+	res, err := ParseKeePassXML(readFixture(t, "keepass.xml"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// a group's entries come before its subgroups. The recycle bin and the
+	// history of Mail are skipped, the root group is the database and not a
+	// folder.
+	checkResult(t, res, []Item{
+		{Row: 1, Type: models.ItemTypeLogin, Name: "Router", Username: "admin", Password: "changeme", URIs: []string{"http://192.168.1.1"}},
+		{Row: 2, Type: models.ItemTypeSecureNote, Name: "Door code", Notes: "4711", Folder: "Work"},
+		{
+			Row: 3, Type: models.ItemTypeLogin, Name: "Mail", Username: "jane@example.com", Password: "s3cret",
+			TOTP: "otpauth://totp/Mail?secret=JBSWY3DPEHPK3PXP", Folder: "Work/Email",
+			Fields: []Field{{Name: "Recovery", Value: "abcd-efgh", Hidden: true}},
+		},
+	}, nil)
+}
+
+func TestParseKeePassXMLRefusesOtherFiles(t *testing.T) {
+	if _, err := ParseKeePassXML([]byte(`{"items": []}`)); err == nil {
+		t.Fatal("json accepted as keepass xml")
+	}
+}
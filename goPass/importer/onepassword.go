@@ -0,0 +1,266 @@
+package importer
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	"goPass/models"
+)
+
+const max1PUXDataSize = 64 << 20
+
+type onePUXExport struct {
+	Accounts []struct {
+		Vaults []struct {
+			Attrs struct {
+				Name string `json:"name"`
+			} `json:"attrs"`
+			Items []onePUXItem `json:"items"`
+		} `json:"vaults"`
+	} `json:"accounts"`
+}
+
+type onePUXItem struct {
+	FavIndex     int    `json:"favIndex"`
+	State        string `json:"state"`
+	CategoryUUID string `json:"categoryUuid"`
+	Overview     struct {
+		Title string `json:"title"`
+		URL   string `json:"url"`
+		URLs  []struct {
+			URL string `json:"url"`
+		} `json:"urls"`
+	} `json:"overview"`
+	Details struct {
+		LoginFields []struct {
+			Value       string `json:"value"`
+			Name        string `json:"name"`
+			Designation string `json:"designation"`
+			FieldType   string `json:"fieldType"`
+		} `json:"loginFields"`
+		NotesPlain string `json:"notesPlain"`
+		Password   string `json:"password"`
+		Sections   []struct {
+			Title  string `json:"title"`
+			Fields []struct {
+				Title string                     `json:"title"`
+				ID    string                     `json:"id"`
+				Value map[string]json.RawMessage `json:"value"`
+			} `json:"fields"`
+		} `json:"sections"`
+	} `json:"details"`
+}
+
+// 1Password category ids
+const (
+	onePUXLogin         = "001"
+	onePUXCard          = "002"
+	onePUXSecureNote    = "003"
+	onePUXIdentity      = "004"
+	onePUXPassword      = "005"
+	onePUXAPICredential = "112"
+	onePUXSSHKey        = "114"
+	onePUXStateActive   = "active"
+)
+
+// section field ids 1Password uses for the typed parts of cards, identities,
+// API credentials and SSH keys, and where they go in our payloads
+var onePUXFieldKeys = map[string]map[string]string{
+	models.ItemTypeCard: {
+		"cardholder": "cardholderName",
+		"type":       "brand",
+		"ccnum":      "number",
+		"cvv":        "code",
+		"expiry":     "expiry",
+	},
+	models.ItemTypeIdentity: {
+		"firstname": "firstName",
+		"initial":   "middleName",
+		"lastname":  "lastName",
+		"email":     "email",
+		"defphone":  "phone",
+		"address":   "address1",
+	},
+	models.ItemTypeAPIToken: {
+		"credential": "token",
+		"hostname":   "service",
+	},
+	models.ItemTypeSSHKey: {
+		"private_key": "privateKey",
+		"public_key":  "publicKey",
+		"fingerprint": "fingerprint",
+	},
+}
+
+// Parse1PUX reads a 1Password .1pux archive, a zip whose export.data file
+// holds every account and vault as JSON. Each vault becomes a folder and
+// archived items are skipped.
+func Parse1PUX(data []byte) (*Result, error) {
+	archive, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		return nil, fmt.Errorf("not a 1pux archive: %w", err)
+	}
+
+	var raw []byte
+	for _, f := range archive.File {
+		if f.Name != "export.data" {
+			continue
+		}
+		rc, err := f.Open()
+		if err != nil {
+			return nil, err
+		}
+		raw, err = io.ReadAll(io.LimitReader(rc, max1PUXDataSize+1))
+		rc.Close()
+		if err != nil {
+			return nil, err
+		}
+		break
+	}
+	if raw == nil {
+		return nil, errors.New("1pux archive has no export.data")
+	}
+	if len(raw) > max1PUXDataSize {
+		return nil, errors.New("1pux export too large")
+	}
+
+	export := onePUXExport{}
+	if err := json.Unmarshal(raw, &export); err != nil {
+		return nil, fmt.Errorf("invalid 1pux export.data: %w", err)
+	}
+
+	res := &Result{Items: []Item{}, Errors: []RowError{}}
+	row := 0
+	for _, account := range export.Accounts {
+		for _, vault := range account.Vaults {
+			for _, op := range vault.Items {
+				row++
+				if op.State != "" && op.State != onePUXStateActive {
+					continue
+				}
+				item, err := convert1PUXItem(op)
+				if err != nil {
+					res.fail(row, err)
+					continue
+				}
+				item.Row = row
+				item.Folder = vault.Attrs.Name
+				res.add(item)
+			}
+		}
+	}
+	return res, nil
+}
+
+func convert1PUXItem(op onePUXItem) (Item, error) {
+	item := Item{
+		Name:     op.Overview.Title,
+		Notes:    op.Details.NotesPlain,
+		Favorite: op.FavIndex > 0,
+	}
+	switch op.CategoryUUID {
+	case onePUXLogin, onePUXPassword:
+		item.Type = models.ItemTypeLogin
+	case onePUXCard:
+		item.Type = models.ItemTypeCard
+	case onePUXSecureNote:
+		item.Type = models.ItemTypeSecureNote
+	case onePUXIdentity:
+		item.Type = models.ItemTypeIdentity
+	case onePUXAPICredential:
+		item.Type = models.ItemTypeAPIToken
+	case onePUXSSHKey:
+		item.Type = models.ItemTypeSSHKey
+	default:
+		return item, fmt.Errorf("unsupported 1password category %q", op.CategoryUUID)
+	}
+
+	if op.Overview.URL != "" {
+		item.URIs = append(item.URIs, op.Overview.URL)
+	}
+	for _, u := range op.Overview.URLs {
+		if u.URL != "" && u.URL != op.Overview.URL {
+			item.URIs = append(item.URIs, u.URL)
+		}
+	}
+
+	item.Password = op.Details.Password
+	for _, f := range op.Details.LoginFields {
+		switch f.Designation {
+		case "username":
+			item.Username = f.Value
+		case "password":
+			item.Password = f.Value
+		}
+	}
+
+	keys := onePUXFieldKeys[item.Type]
+	for _, section := range op.Details.Sections {
+		for _, f := range section.Fields {
+			value, kind := onePUXValue(f.Value)
+			if value == "" {
+				continue
+			}
+			if kind == "totp" {
+				item.TOTP = value
+				continue
+			}
+			if key, ok := keys[f.ID]; ok {
+				if key == "expiry" {
+					item.Data = setExpiry(item.Data, value)
+				} else {
+					item.Data = setData(item.Data, key, value)
+				}
+				continue
+			}
+			name := f.Title
+			if name == "" {
+				name = f.ID
+			}
+			if section.Title != "" {
+				name = section.Title + " / " + name
+			}
+			item.Fields = append(item.Fields, Field{Name: name, Value: value, Hidden: kind == "concealed"})
+		}
+	}
+	return item, nil
+}
+
+// onePUXValue flattens a section field value, which is an object with a
+// single key naming its kind, e.g. {"concealed": "..."}.
+func onePUXValue(value map[string]json.RawMessage) (string, string) {
+	for kind, raw := range value {
+		var s string
+		if err := json.Unmarshal(raw, &s); err == nil {
+			return s, kind
+		}
+		var n json.Number
+		if err := json.Unmarshal(raw, &n); err == nil {
+			return n.String(), kind
+		}
+		if string(raw) == "null" {
+			return "", kind
+		}
+		return string(raw), kind
+	}
+	return "", ""
+}
+
+// setExpiry splits 1Password's monthYear value (YYYYMM) into expMonth and
+// expYear.
+func setExpiry(data map[string]string, value string) map[string]string {
+	if len(value) != 6 {
+		return data
+	}
+	if _, err := strconv.Atoi(value); err != nil {
+		return data
+	}
+	data = setData(data, "expYear", value[:4])
+	return setData(data, "expMonth", strings.TrimPrefix(value[4:], "0"))
+}
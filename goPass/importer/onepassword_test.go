@@ -0,0 +1,87 @@
+package importer
+
+import (
+	"archive/zip"
+	"bytes"
+	"reflect"
+	"testing"
+
+	"goPass/models"
+)
+
+// build1PUX packs files into a .1pux archive.
+func build1PUX(t *testing.T, files map[string][]byte) []byte {
+	t.Helper()
+	buf := bytes.Buffer{}
+	w := zip.NewWriter(&buf)
+	for name, data := range files {
+		f, err := w.Create(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := f.Write(data); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestParse1PUX(t *testing.T) {
+	archive := build1PUX(t, map[string][]byte{
+		"export.attributes": []byte(`{"version": 3}`),
+		"export.data":       readFixture(t, "1pux/export.data"),
+	})
+	res, err := Parse1PUX(archive)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the archived item still counts as a row, it is just not imported.
+	// Amex's expiry isn't YYYYMM and is dropped rather than guessed.
+	checkResult(t, res, []Item{
+		{
+			Row: 1, Type: models.ItemTypeLogin, Name: "GitHub", Username: "octocat", Password: "hunter2",
+			URIs: []string{"https://github.com", "https://gist.github.com"},
+			TOTP: "otpauth://totp/GitHub?secret=JBSWY3DPEHPK3PXP", Folder: "Private", Favorite: true,
+			Fields: []Field{{Name: "Security / recovery", Value: "abcd-efgh", Hidden: true}, {Name: "Security / pin", Value: "0000"}},
+		},
+		{
+			Row: 2, Type: models.ItemTypeCard, Name: "Visa", Folder: "Private",
+			Data: map[string]string{"cardholderName": "Jane Doe", "number": "4111111111111111", "code": "123", "expYear": "2030", "expMonth": "4"},
+		},
+		{
+			Row: 5, Type: models.ItemTypeCard, Name: "Amex", Folder: "Shared",
+			Data: map[string]string{"number": "378282246310005"},
+		},
+	}, []RowError{
+		{Row: 4, Error: `unsupported 1password category "006"`},
+	})
+}
+
+func TestSetExpiry(t *testing.T) {
+	tests := []struct {
+		value string
+		want  map[string]string
+	}{
+		{"203004", map[string]string{"expYear": "2030", "expMonth": "4"}},
+		{"202712", map[string]string{"expYear": "2027", "expMonth": "12"}},
+		{"2031", nil},
+		{"20x004", nil},
+	}
+	for _, tt := range tests {
+		if got := setExpiry(nil, tt.value); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("setExpiry(%q) = %v, want %v", tt.value, got, tt.want)
+		}
+	}
+}
+
+func TestParse1PUXNeedsExportData(t *testing.T) {
+	if _, err := Parse1PUX(build1PUX(t, map[string][]byte{"export.attributes": []byte(`{}`)})); err == nil {
+		t.Fatal("archive without export.data accepted")
+	}
+	if _, err := Parse1PUX([]byte("not a zip")); err == nil {
+		t.Fatal("non zip accepted")
+	}
+}
@@ -0,0 +1,26 @@
+package jobs
+
+import (
+	"log"
+	"time"
+)
+
+// Every runs fn once right away and then on every tick of interval, in its
+// own goroutine. A panic in fn is logged and the schedule keeps going.
+func Every(name string, interval time.Duration, fn func()) {
+	go func() {
+		run(name, fn)
+		for range time.Tick(interval) {
+			run(name, fn)
+		}
+	}()
+}
+
+func run(name string, fn func()) {
+	defer func() {
+		if r := recover(); r != nil {
+			log.Println("job", name, "panicked:", r)
+		}
+	}()
+	fn()
+}
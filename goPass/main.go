@@ -3,13 +3,20 @@ package main
 import (
 	"log"
 	"os"
+	"strings"
+	"time"
 
 	"github.com/gofiber/fiber/v2"
 	"github.com/gofiber/fiber/v2/middleware/cors"
 	"github.com/gofiber/fiber/v2/middleware/logger"
 	"github.com/joho/godotenv"
+	"goPass/audit"
+	"goPass/backup"
 	"goPass/config"
+	"goPass/controller"
+	"goPass/jobs"
 	"goPass/models"
+	"goPass/notify"
 	"goPass/routes"
 )
 
@@ -18,29 +25,36 @@ func main() {
 	if err != nil {
 		log.Println("No .env file found, using system environment variables")
 	}
-	app := fiber.New()
+	if len(os.Args) > 1 {
+		runCommand(os.Args[1:])
+		return
+	}
+	app := fiber.New(serverConfig())
 	app.Use(cors.New(cors.Config{
 		AllowOrigins: "*",
-		AllowHeaders: "Origin, Content-Type, Accept, Authorization",
+		AllowHeaders: "Origin, Content-Type, Accept, Authorization, X-Device-ID",
 		AllowMethods: "GET,POST,PUT,DELETE,OPTIONS",
 	}))
 	app.Get("/robots.txt", func(c *fiber.Ctx) error {
 		return c.SendFile("./robots.txt")
 	})
 
-	app.Use(logger.New())
+	app.Use(logger.New(logger.Config{
+		// which icons are asked for says which sites someone has accounts on
+		Next: func(c *fiber.Ctx) bool {
+			return strings.HasPrefix(c.Path(), "/icons/")
+		},
+	}))
 	config.ConnectDB()
-	// Auto-create table
-	// config.DB.Migrator().DropTable(&models.Post{}, &models.User{})
-	config.DB.AutoMigrate(&models.User{}, &models.Post{})
-
-	error := config.DB.AutoMigrate(
-		&models.AppUser{},
-		&models.Device{},
-		&models.VaultEntry{})
-	if error != nil {
-		log.Fatal("Migration failed:", err)
-	}
+	config.ConnectBlobStore()
+	config.ConnectBackupStore()
+	config.ConnectBreachSource()
+	config.ConnectIconService()
+	config.ConnectAuditSigner()
+	config.ConnectRealtime()
+	config.ConnectRateLimiter()
+	notify.Setup()
+	migrate()
 
 	// Setup routes
 	router.UserRoute(app)
@@ -48,6 +62,30 @@ func main() {
 	router.DeviceRoute(app)
 	router.VaultRoute(app)
 	router.AuthRoute(app)
+	router.FolderRoute(app)
+	router.TagRoute(app)
+	router.AttachmentRoute(app)
+	router.ShareRoute(app)
+	router.OrgRoute(app)
+	router.EmergencyRoute(app)
+	router.SendRoute(app)
+	router.ImportRoute(app)
+	router.SecurityRoute(app)
+	router.ToolsRoute(app)
+	router.IconRoute(app)
+	router.AccountRoute(app)
+	router.SyncRoute(app)
+
+	jobs.Every("emergency-access", 15*time.Minute, controller.ApproveExpiredEmergencyAccess)
+	jobs.Every("send-reaper", 10*time.Minute, controller.DeleteExpiredSends)
+	jobs.Every("attachment-reaper", time.Hour, controller.DeleteStaleAttachments)
+	jobs.Every("rate-limit-prune", 10*time.Minute, config.Limiter.PruneJob())
+	if config.Backups != nil {
+		jobs.Every("backup", config.BackupInterval, backup.Job(config.DB, config.Backups, config.BackupKey))
+	}
+	if config.AuditSigningKey != nil {
+		jobs.Every("audit-checkpoint", config.AuditCheckpointInterval, audit.CheckpointJob(config.DB, config.AuditCheckpoints, config.AuditSigningKey))
+	}
 
 	port := os.Getenv("PORT")
 	if port == "" {
@@ -55,3 +93,62 @@ func main() {
 	}
 	log.Fatal(app.Listen("0.0.0.0:" + port))
 }
+
+// serverConfig trusts the client address a reverse proxy passes on, but
+// only from the proxies in TRUSTED_PROXIES (IPs or CIDRs, comma separated).
+// The proxy must set PROXY_HEADER, X-Forwarded-For by default, to the
+// address it saw instead of appending to what the client sent. Rate limits,
+// the audit log and sign-in notifications all go by this address.
+func serverConfig() fiber.Config {
+	cfg := fiber.Config{}
+	trusted := os.Getenv("TRUSTED_PROXIES")
+	if trusted == "" {
+		return cfg
+	}
+	for _, proxy := range strings.Split(trusted, ",") {
+		if proxy = strings.TrimSpace(proxy); proxy != "" {
+			cfg.TrustedProxies = append(cfg.TrustedProxies, proxy)
+		}
+	}
+	cfg.ProxyHeader = os.Getenv("PROXY_HEADER")
+	if cfg.ProxyHeader == "" {
+		cfg.ProxyHeader = fiber.HeaderXForwardedFor
+	}
+	cfg.EnableTrustedProxyCheck = true
+	cfg.EnableIPValidation = true
+	return cfg
+}
+
+func migrate() {
+	// Auto-create table
+	// config.DB.Migrator().DropTable(&models.Post{}, &models.User{})
+	config.DB.AutoMigrate(&models.User{}, &models.Post{})
+
+	error := config.DB.AutoMigrate(
+		&models.AppUser{},
+		&models.Device{},
+		&models.VaultEntry{},
+		&models.Folder{},
+		&models.Tag{},
+		&models.Attachment{},
+		&models.AttachmentChunk{},
+		&models.VaultShare{},
+		&models.VaultEntryDomain{},
+		&models.AuditEvent{},
+		&models.AuditCheckpoint{},
+		&models.KnownLogin{},
+		&models.NotificationPreference{},
+		&models.RateLimitEvent{},
+		&models.Organization{},
+		&models.Membership{},
+		&models.Collection{},
+		&models.CollectionMember{},
+		&models.EmergencyAccess{},
+		&models.Send{},
+		&models.GeneratorPolicy{},
+		&models.SitePolicy{})
+	if error != nil {
+		log.Fatal("Migration failed:", error)
+	}
+	config.RunMigrations()
+}
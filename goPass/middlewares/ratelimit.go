@@ -0,0 +1,37 @@
+package middleware
+
+import (
+	"math"
+	"strconv"
+
+	"github.com/gofiber/fiber/v2"
+	"goPass/config"
+	"goPass/ratelimit"
+)
+
+// LimitIP refuses requests once the client IP has used up rule, telling it
+// in Retry-After when to come back.
+func LimitIP(rule ratelimit.Rule) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		decision, err := config.Limiter.Allow(c.UserContext(), rule, c.IP())
+		if err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"error": "failed to check rate limit",
+			})
+		}
+		if !decision.Allowed {
+			return TooManyRequests(c, decision)
+		}
+		return c.Next()
+	}
+}
+
+// TooManyRequests answers a refused attempt with 429 and Retry-After.
+func TooManyRequests(c *fiber.Ctx, decision ratelimit.Decision) error {
+	seconds := int(math.Ceil(decision.RetryAfter.Seconds()))
+	c.Set(fiber.HeaderRetryAfter, strconv.Itoa(seconds))
+	return c.Status(fiber.StatusTooManyRequests).JSON(fiber.Map{
+		"error":      "too many attempts, try again later",
+		"retryAfter": seconds,
+	})
+}
@@ -4,6 +4,7 @@ import (
 	"time"
 
 	"github.com/google/uuid"
+	"goPass/generator"
 	"gorm.io/datatypes"
 	"gorm.io/gorm"
 )
@@ -24,6 +25,10 @@ type AppUser struct {
 	MasterSalt         *string
 	AesHashKeyRecovery datatypes.JSON `gorm:"type:jsonb;default:'{}'::jsonb"`
 	RecoverySalt       *string
+	PublicKey          string         // base64 DER (PKIX) public key used by others to share with this user
+	WrappedPrivateKey  datatypes.JSON `gorm:"type:jsonb;default:'{}'::jsonb"` // private key wrapped by the vault key
+	LockedUntil        *time.Time     // set after too many failed logins
+	UnlockTokenHash    string         `json:"-"` // SHA-256 of the token mailed to lift the lock early
 }
 
 type Device struct {
@@ -31,21 +36,321 @@ type Device struct {
 	UserID          uuid.UUID `gorm:"type:uuid;not null;index"`
 	DeviceName      string
 	DevicePublicKey string `gorm:"not null"`
+	PushToken       string `gorm:"not null;default:'';index"` // Expo push token, empty when the device can't get pushes
 	LastSyncAt      time.Time
 	CreatedAt       time.Time
 	User            AppUser `gorm:"foreignKey:UserID"`
 }
 
 type VaultEntry struct {
-	ID                uuid.UUID      `gorm:"type:uuid;primaryKey"`
-	UserID            uuid.UUID      `gorm:"type:uuid;not null;index"`
-	PlatformName      string         `gorm:"not null"`
-	EntryKey          string         `gorm:"not null"`
-	EncryptedPassword []byte         `gorm:"not null"`
-	IV                []byte         `gorm:"not null"`
-	MetaData          datatypes.JSON `gorm:"type:jsonb;default:'{}'::jsonb"`
+	ID                uuid.UUID                        `gorm:"type:uuid;primaryKey"`
+	UserID            uuid.UUID                        `gorm:"type:uuid;not null;index"`
+	ItemType          string                           `gorm:"not null;default:'login';index"`
+	PlatformName      string                           `gorm:"not null"`
+	EntryKey          string                           `gorm:"not null"`
+	EncryptedPassword []byte                           `gorm:"not null"` // password for logins, encrypted type payload otherwise
+	IV                []byte                           `gorm:"not null"`
+	EncryptedItemKey  []byte                           // per item key wrapped by the key derived from the vault key, IV first (see vaultexport/FORMAT.md), needed before an entry can be shared
+	Envelope          datatypes.JSON                   `gorm:"type:jsonb;default:'{}'::jsonb"`
+	CustomFields      datatypes.JSONSlice[CustomField] `gorm:"type:jsonb;default:'[]'::jsonb"`
+	URIs              datatypes.JSONSlice[EntryURI]    `gorm:"type:jsonb;default:'[]'::jsonb"`
+	MetaData          datatypes.JSON                   `gorm:"type:jsonb;default:'{}'::jsonb"` // deprecated, converted into CustomFields
 	CreatedAt         time.Time
 	UpdatedAt         time.Time
-	Deleted           bool    `gorm:"default:false"`
-	User              AppUser `gorm:"foreignKey:UserID"`
+	CollectionID      *uuid.UUID `gorm:"type:uuid;index"` // set for entries owned by an organization collection
+	FolderID          *uuid.UUID `gorm:"type:uuid;index"`
+	Tags              []Tag      `gorm:"many2many:vault_entry_tags;constraint:OnDelete:CASCADE"`
+	Favorite          bool       `gorm:"default:false;index"`
+	UseCount          int64      `gorm:"not null;default:0"`
+	LastUsedAt        *time.Time
+	Fingerprint       string `gorm:"index"` // keyed hash of the password from the client, only comparable within one vault
+	StrengthScore     *int   // 0 (weakest) to 4, scored on the client
+	PasswordChangedAt *time.Time
+	Attachments       []Attachment `gorm:"foreignKey:VaultEntryID;constraint:OnDelete:CASCADE"`
+	TOTP              *TOTP        `gorm:"embedded;embeddedPrefix:totp_"`
+	HasTOTP           bool         `gorm:"default:false;index"`
+	Deleted           bool         `gorm:"default:false"`
+	User              AppUser      `gorm:"foreignKey:UserID"`
+}
+
+// VaultEntryDomain files an entry under the domain index buckets of its
+// URIs, see EntryURI.IndexKey. The column is still called hash from when
+// buckets were stored hashed.
+type VaultEntryDomain struct {
+	VaultEntryID uuid.UUID  `gorm:"type:uuid;primaryKey"`
+	Bucket       string     `gorm:"column:hash;primaryKey;index"`
+	VaultEntry   VaultEntry `gorm:"foreignKey:VaultEntryID;constraint:OnDelete:CASCADE"`
+}
+
+// AuditEvent is an append-only record of something security relevant
+// happening to an account. Rows are never updated or deleted, and each one
+// carries the hash of the one before it for the same user, see audit.Hash.
+type AuditEvent struct {
+	ID        uuid.UUID  `gorm:"type:uuid;primaryKey"`
+	UserID    *uuid.UUID `gorm:"type:uuid;index:idx_audit_user_created;index:idx_audit_chain"` // unset for failed logins to unknown emails
+	Event     string     `gorm:"not null;index"`
+	Outcome   string     `gorm:"not null"`
+	TargetID  *uuid.UUID `gorm:"type:uuid"` // the device or entry the event is about
+	DeviceID  *uuid.UUID `gorm:"type:uuid"` // as reported by the client in X-Device-ID
+	IP        string
+	UserAgent string
+	Detail    string
+	CreatedAt time.Time `gorm:"index:idx_audit_user_created"`
+	Seq       int64     `gorm:"not null;default:0;index:idx_audit_chain"` // position in the user's chain, from 1
+	PrevHash  string    // Hash of the previous event in the chain, empty for the first
+	Hash      string    `gorm:"not null;default:''"`
+}
+
+// AuditCheckpoint is a signed audit.Checkpoint, also exported outside the
+// database when a checkpoint store is configured.
+type AuditCheckpoint struct {
+	ID        uuid.UUID      `gorm:"type:uuid;primaryKey"`
+	CreatedAt time.Time      `gorm:"index"`
+	Document  datatypes.JSON `gorm:"type:jsonb;not null"`
+}
+
+// KnownLogin is a device and network a user has signed in from before, so
+// a login from anywhere else can be reported to them.
+type KnownLogin struct {
+	ID          uuid.UUID `gorm:"type:uuid;primaryKey"`
+	UserID      uuid.UUID `gorm:"type:uuid;not null;uniqueIndex:idx_known_login"`
+	DeviceKey   string    `gorm:"not null;uniqueIndex:idx_known_login"` // device ID from X-Device-ID, empty when the client sent none
+	Network     string    `gorm:"not null;uniqueIndex:idx_known_login"` // /24 for IPv4, /48 for IPv6
+	FirstSeenAt time.Time
+	LastSeenAt  time.Time
+	User        AppUser `gorm:"foreignKey:UserID;constraint:OnDelete:CASCADE"`
+}
+
+// NotificationPreference says how a user wants to hear about account
+// activity. Users without a row get every notification, see
+// notify.Preferences.
+type NotificationPreference struct {
+	UserID      uuid.UUID `gorm:"type:uuid;primaryKey"`
+	LoginEmail  bool      `gorm:"not null"`
+	LoginPush   bool      `gorm:"not null"`
+	DeviceEmail bool      `gorm:"not null"`
+	DevicePush  bool      `gorm:"not null"`
+	UpdatedAt   time.Time
+	User        AppUser `gorm:"foreignKey:UserID;constraint:OnDelete:CASCADE"`
+}
+
+// RateLimitEvent is one attempt counted by ratelimit.PostgresStore.
+type RateLimitEvent struct {
+	ID  uint64    `gorm:"primaryKey"`
+	Key string    `gorm:"not null;index:idx_rate_limit_key_at"`
+	At  time.Time `gorm:"not null;index:idx_rate_limit_key_at;index"`
+}
+
+// Folder and Tag names are encrypted on the client like everything else in
+// the vault, the server only knows how they relate to each other.
+type Folder struct {
+	ID            uuid.UUID  `gorm:"type:uuid;primaryKey"`
+	UserID        uuid.UUID  `gorm:"type:uuid;not null;index"`
+	ParentID      *uuid.UUID `gorm:"type:uuid;index"`
+	EncryptedName []byte     `gorm:"not null"`
+	IV            []byte     `gorm:"not null"`
+	CreatedAt     time.Time
+	UpdatedAt     time.Time
+	User          AppUser `gorm:"foreignKey:UserID;constraint:OnDelete:CASCADE"`
+}
+
+type Tag struct {
+	ID            uuid.UUID `gorm:"type:uuid;primaryKey"`
+	UserID        uuid.UUID `gorm:"type:uuid;not null;index"`
+	EncryptedName []byte    `gorm:"not null"`
+	IV            []byte    `gorm:"not null"`
+	CreatedAt     time.Time
+	UpdatedAt     time.Time
+	User          AppUser `gorm:"foreignKey:UserID;constraint:OnDelete:CASCADE"`
+}
+
+// Attachment is a client encrypted file uploaded in chunks. The bytes live in
+// the blob store, one blob per chunk, and only the bookkeeping lives here.
+type Attachment struct {
+	ID            uuid.UUID `gorm:"type:uuid;primaryKey"`
+	UserID        uuid.UUID `gorm:"type:uuid;not null;index"`
+	VaultEntryID  uuid.UUID `gorm:"type:uuid;not null;index"`
+	EncryptedName []byte    `gorm:"not null"`
+	EncryptedKey  []byte    `gorm:"not null"`
+	IV            []byte    `gorm:"not null"`
+	Size          int64     `gorm:"not null"`
+	ChunkCount    int       `gorm:"not null"`
+	Complete      bool      `gorm:"default:false"`
+	CreatedAt     time.Time
+	UpdatedAt     time.Time
+	Chunks        []AttachmentChunk `gorm:"foreignKey:AttachmentID;constraint:OnDelete:CASCADE"`
+}
+
+type AttachmentChunk struct {
+	AttachmentID uuid.UUID `gorm:"type:uuid;primaryKey"`
+	ChunkIndex   int       `gorm:"primaryKey"`
+	Size         int64     `gorm:"not null"`
+	Stored       bool      `gorm:"not null;default:false"` // set once the blob is in the store
+	CreatedAt    time.Time
+}
+
+// SchemaMigration records the data migrations that already ran, so they are
+// only applied once per database.
+type SchemaMigration struct {
+	ID        string `gorm:"primaryKey"`
+	AppliedAt time.Time
+}
+
+const (
+	SharePermissionRead = "read"
+	SharePermissionEdit = "edit"
+
+	ShareStatusPending  = "pending"
+	ShareStatusAccepted = "accepted"
+	ShareStatusDeclined = "declined"
+	ShareStatusRevoked  = "revoked"
+)
+
+// VaultShare gives another user access to a single entry. The owner wraps
+// the entry's item key with the recipient's public key, so the server only
+// ever relays key material it can't open.
+type VaultShare struct {
+	ID               uuid.UUID `gorm:"type:uuid;primaryKey"`
+	VaultEntryID     uuid.UUID `gorm:"type:uuid;not null;uniqueIndex:idx_share_entry_recipient"`
+	OwnerID          uuid.UUID `gorm:"type:uuid;not null;index"`
+	RecipientID      uuid.UUID `gorm:"type:uuid;not null;index;uniqueIndex:idx_share_entry_recipient"`
+	EncryptedItemKey []byte
+	Permission       string `gorm:"not null;default:'read'"`
+	Status           string `gorm:"not null;default:'pending';index"`
+	RespondedAt      *time.Time
+	CreatedAt        time.Time
+	UpdatedAt        time.Time
+	VaultEntry       VaultEntry `gorm:"foreignKey:VaultEntryID;constraint:OnDelete:CASCADE"`
+}
+
+const (
+	RoleOwner  = "owner"
+	RoleAdmin  = "admin"
+	RoleMember = "member"
+
+	MembershipInvited   = "invited"
+	MembershipConfirmed = "confirmed"
+)
+
+// Organization is a shared company vault. Every member holds the org key
+// wrapped with their own public key, entries are then encrypted with keys
+// wrapped by the org key and live in collections.
+type Organization struct {
+	ID          uuid.UUID `gorm:"type:uuid;primaryKey"`
+	Name        string    `gorm:"not null"`
+	CreatedAt   time.Time
+	UpdatedAt   time.Time
+	Memberships []Membership `gorm:"foreignKey:OrganizationID;constraint:OnDelete:CASCADE"`
+	Collections []Collection `gorm:"foreignKey:OrganizationID;constraint:OnDelete:CASCADE"`
+}
+
+type Membership struct {
+	ID              uuid.UUID `gorm:"type:uuid;primaryKey"`
+	OrganizationID  uuid.UUID `gorm:"type:uuid;not null;uniqueIndex:idx_membership_org_user"`
+	UserID          uuid.UUID `gorm:"type:uuid;not null;index;uniqueIndex:idx_membership_org_user"`
+	Role            string    `gorm:"not null;default:'member'"`
+	Status          string    `gorm:"not null;default:'invited'"`
+	EncryptedOrgKey []byte    `gorm:"not null"` // org key wrapped with the member's public key
+	CreatedAt       time.Time
+	UpdatedAt       time.Time
+	User            AppUser `gorm:"foreignKey:UserID;constraint:OnDelete:CASCADE"`
+}
+
+// CanManage reports whether the member may administer the organization.
+func (m Membership) CanManage() bool {
+	return m.Status == MembershipConfirmed && (m.Role == RoleOwner || m.Role == RoleAdmin)
+}
+
+type Collection struct {
+	ID             uuid.UUID `gorm:"type:uuid;primaryKey"`
+	OrganizationID uuid.UUID `gorm:"type:uuid;not null;index"`
+	EncryptedName  []byte    `gorm:"not null"`
+	IV             []byte    `gorm:"not null"`
+	CreatedAt      time.Time
+	UpdatedAt      time.Time
+	Members        []CollectionMember `gorm:"foreignKey:CollectionID;constraint:OnDelete:CASCADE"`
+	Entries        []VaultEntry       `gorm:"foreignKey:CollectionID;constraint:OnDelete:CASCADE"`
+}
+
+// CollectionMember grants a plain member access to a collection. Owners and
+// admins can reach every collection of their organization without one.
+type CollectionMember struct {
+	CollectionID uuid.UUID `gorm:"type:uuid;primaryKey"`
+	UserID       uuid.UUID `gorm:"type:uuid;primaryKey;index"`
+	ReadOnly     bool      `gorm:"default:false"`
+	CreatedAt    time.Time
+}
+
+const (
+	EmergencyInvited   = "invited"
+	EmergencyAccepted  = "accepted"
+	EmergencyConfirmed = "confirmed"
+	EmergencyRequested = "recovery_requested"
+	EmergencyApproved  = "recovery_approved"
+)
+
+// EmergencyAccess lets a trusted contact (grantee) take over a vault after
+// asking for it and waiting WaitDays without the owner (grantor) rejecting.
+// The vault key is wrapped with the grantee's public key up front, so the
+// server can hand it over without ever being able to read it.
+type EmergencyAccess struct {
+	ID              uuid.UUID `gorm:"type:uuid;primaryKey"`
+	GrantorID       uuid.UUID `gorm:"type:uuid;not null;index;uniqueIndex:idx_emergency_grantor_grantee"`
+	GranteeID       uuid.UUID `gorm:"type:uuid;not null;index;uniqueIndex:idx_emergency_grantor_grantee"`
+	Status          string    `gorm:"not null;default:'invited';index"`
+	WaitDays        int       `gorm:"not null"`
+	WrappedVaultKey []byte
+	RequestedAt     *time.Time
+	CreatedAt       time.Time
+	UpdatedAt       time.Time
+	Grantor         AppUser `gorm:"foreignKey:GrantorID;constraint:OnDelete:CASCADE"`
+	Grantee         AppUser `gorm:"foreignKey:GranteeID;constraint:OnDelete:CASCADE"`
+}
+
+// WaitOver reports whether a pending recovery request has sat through the
+// waiting period.
+func (e EmergencyAccess) WaitOver(now time.Time) bool {
+	return e.Status == EmergencyRequested && e.RequestedAt != nil &&
+		now.After(e.RequestedAt.Add(time.Duration(e.WaitDays)*24*time.Hour))
+}
+
+// Send is a one-off encrypted message for someone without an account. The
+// key to open it travels in the link fragment and never reaches the server.
+type Send struct {
+	ID               uuid.UUID `gorm:"type:uuid;primaryKey"`
+	UserID           uuid.UUID `gorm:"type:uuid;not null;index"`
+	EncryptedPayload []byte    `gorm:"not null"`
+	IV               []byte    `gorm:"not null"`
+	PasswordHash     string    `json:"-"`
+	MaxViews         int       `gorm:"not null"`
+	ViewCount        int       `gorm:"not null;default:0"`
+	FailedAttempts   int       `gorm:"not null;default:0"` // wrong passwords, the send is burned at maxSendPasswordAttempts
+	ExpiresAt        time.Time `gorm:"not null;index"`
+	CreatedAt        time.Time
+	User             AppUser `gorm:"foreignKey:UserID;constraint:OnDelete:CASCADE"`
+}
+
+// GeneratorPolicy is a saved set of generator settings. The one marked
+// IsDefault is used when a generate request names no policy.
+type GeneratorPolicy struct {
+	ID        uuid.UUID                            `gorm:"type:uuid;primaryKey"`
+	UserID    uuid.UUID                            `gorm:"type:uuid;not null;index"`
+	Name      string                               `gorm:"not null"`
+	Policy    datatypes.JSONType[generator.Policy] `gorm:"type:jsonb"`
+	IsDefault bool                                 `gorm:"default:false"`
+	CreatedAt time.Time
+	UpdatedAt time.Time
+	User      AppUser `gorm:"foreignKey:UserID;constraint:OnDelete:CASCADE"`
+}
+
+// SitePolicy remembers what a site accepts, like a bank that allows 16
+// characters and no symbols, keyed by the lower cased PlatformName.
+type SitePolicy struct {
+	ID           uuid.UUID                            `gorm:"type:uuid;primaryKey"`
+	UserID       uuid.UUID                            `gorm:"type:uuid;not null;uniqueIndex:idx_site_policy_user_platform"`
+	PlatformName string                               `gorm:"not null;uniqueIndex:idx_site_policy_user_platform"`
+	Policy       datatypes.JSONType[generator.Policy] `gorm:"type:jsonb"`
+	CreatedAt    time.Time
+	UpdatedAt    time.Time
+	User         AppUser `gorm:"foreignKey:UserID;constraint:OnDelete:CASCADE"`
 }
@@ -0,0 +1,135 @@
+package models
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+)
+
+const (
+	CustomFieldText    = "text"
+	CustomFieldHidden  = "hidden"
+	CustomFieldBoolean = "boolean"
+	CustomFieldLinked  = "linked"
+)
+
+// Linked fields point at one of the built-in parts of a login instead of
+// carrying a value of their own.
+const (
+	LinkedEntryKey = "entrykey"
+	LinkedPassword = "password"
+)
+
+const (
+	maxCustomFields         = 64
+	maxCustomFieldNameSize  = 256
+	maxCustomFieldValueSize = 8 * 1024
+	maxCustomFieldsSize     = 64 * 1024
+)
+
+// CustomField is a user defined field on a vault entry. When Encrypted is
+// set, Value holds base64 ciphertext under IV and the server can only check
+// its size. Hidden fields must always be encrypted.
+type CustomField struct {
+	Name      string `json:"name"`
+	Type      string `json:"type"`
+	Value     string `json:"value,omitempty"`
+	Encrypted bool   `json:"encrypted"`
+	IV        string `json:"iv,omitempty"`
+	LinkedTo  string `json:"linkedTo,omitempty"`
+}
+
+func ValidateCustomFields(fields []CustomField) error {
+	if len(fields) > maxCustomFields {
+		return fmt.Errorf("at most %d custom fields are allowed", maxCustomFields)
+	}
+
+	total := 0
+	for i, field := range fields {
+		if field.Name == "" || len(field.Name) > maxCustomFieldNameSize {
+			return fmt.Errorf("custom field %d: name must be 1-%d bytes", i, maxCustomFieldNameSize)
+		}
+		if len(field.Value) > maxCustomFieldValueSize {
+			return fmt.Errorf("custom field %d: value too large", i)
+		}
+		if field.Encrypted && field.IV == "" {
+			return fmt.Errorf("custom field %d: encrypted value needs an iv", i)
+		}
+		if !field.Encrypted && field.IV != "" {
+			return fmt.Errorf("custom field %d: iv set on a plaintext value", i)
+		}
+
+		switch field.Type {
+		case CustomFieldText:
+		case CustomFieldHidden:
+			if !field.Encrypted {
+				return fmt.Errorf("custom field %d: hidden fields must be encrypted", i)
+			}
+		case CustomFieldBoolean:
+			if !field.Encrypted && field.Value != "true" && field.Value != "false" {
+				return fmt.Errorf("custom field %d: boolean value must be true or false", i)
+			}
+		case CustomFieldLinked:
+			if field.Value != "" || field.Encrypted {
+				return fmt.Errorf("custom field %d: linked fields carry no value", i)
+			}
+			if field.LinkedTo != LinkedEntryKey && field.LinkedTo != LinkedPassword {
+				return fmt.Errorf("custom field %d: linkedTo must be entrykey or password", i)
+			}
+		default:
+			return fmt.Errorf("custom field %d: unknown type %q", i, field.Type)
+		}
+		if field.Type != CustomFieldLinked && field.LinkedTo != "" {
+			return fmt.Errorf("custom field %d: linkedTo is only valid on linked fields", i)
+		}
+
+		total += len(field.Name) + len(field.Value) + len(field.IV)
+	}
+	if total > maxCustomFieldsSize {
+		return errors.New("custom fields too large")
+	}
+	return nil
+}
+
+// CustomFieldsFromMetaData converts the free-form MetaData object older
+// clients sent into plaintext custom fields, one per key in key order.
+func CustomFieldsFromMetaData(metaData []byte) ([]CustomField, error) {
+	values := map[string]any{}
+	if len(metaData) == 0 || string(metaData) == "null" {
+		return []CustomField{}, nil
+	}
+	if err := json.Unmarshal(metaData, &values); err != nil {
+		return nil, fmt.Errorf("metadata is not a json object: %w", err)
+	}
+
+	keys := make([]string, 0, len(values))
+	for key := range values {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	fields := make([]CustomField, 0, len(keys))
+	for _, key := range keys {
+		field := CustomField{Name: key, Type: CustomFieldText}
+		switch v := values[key].(type) {
+		case nil:
+		case string:
+			field.Value = v
+		case bool:
+			field.Type = CustomFieldBoolean
+			field.Value = strconv.FormatBool(v)
+		case float64:
+			field.Value = strconv.FormatFloat(v, 'f', -1, 64)
+		default:
+			raw, err := json.Marshal(v)
+			if err != nil {
+				return nil, err
+			}
+			field.Value = string(raw)
+		}
+		fields = append(fields, field)
+	}
+	return fields, nil
+}
@@ -0,0 +1,201 @@
+package models
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"regexp"
+	"time"
+
+	"gorm.io/datatypes"
+)
+
+// Item types stored in VaultEntry.ItemType. The server only ever sees the
+// non-secret envelope of an item, the payload itself is encrypted on the client.
+const (
+	ItemTypeLogin      = "login"
+	ItemTypeSecureNote = "secure_note"
+	ItemTypeCard       = "card"
+	ItemTypeIdentity   = "identity"
+	ItemTypeSSHKey     = "ssh_key"
+	ItemTypeAPIToken   = "api_token"
+)
+
+var ItemTypes = []string{
+	ItemTypeLogin,
+	ItemTypeSecureNote,
+	ItemTypeCard,
+	ItemTypeIdentity,
+	ItemTypeSSHKey,
+	ItemTypeAPIToken,
+}
+
+func IsValidItemType(itemType string) bool {
+	return contains(ItemTypes, itemType)
+}
+
+// Envelopes are the plaintext, non-secret part of an item that the server can
+// validate and index. Anything sensitive belongs in the encrypted payload.
+
+type LoginEnvelope struct{}
+
+type SecureNoteEnvelope struct {
+	Format string `json:"format,omitempty"` // "text" or "markdown"
+}
+
+type CardEnvelope struct {
+	Brand string `json:"brand,omitempty"`
+	Last4 string `json:"last4,omitempty"`
+}
+
+type IdentityEnvelope struct {
+	Label string `json:"label,omitempty"`
+}
+
+type SSHKeyEnvelope struct {
+	KeyType     string `json:"keyType"`
+	Fingerprint string `json:"fingerprint,omitempty"`
+	PublicKey   string `json:"publicKey,omitempty"`
+}
+
+type APITokenEnvelope struct {
+	Service   string     `json:"service,omitempty"`
+	ExpiresAt *time.Time `json:"expiresAt,omitempty"`
+}
+
+// Payloads describe the JSON the client encrypts into EncryptedPassword for
+// each item type. For logins the ciphertext is still the bare password so
+// entries created before item types existed keep decrypting as before.
+
+type SecureNotePayload struct {
+	Text string `json:"text"`
+}
+
+type CardPayload struct {
+	CardholderName string `json:"cardholderName"`
+	Number         string `json:"number"`
+	ExpMonth       int    `json:"expMonth"`
+	ExpYear        int    `json:"expYear"`
+	Code           string `json:"code"`
+}
+
+type IdentityPayload struct {
+	Title      string `json:"title,omitempty"`
+	FirstName  string `json:"firstName,omitempty"`
+	MiddleName string `json:"middleName,omitempty"`
+	LastName   string `json:"lastName,omitempty"`
+	Email      string `json:"email,omitempty"`
+	Phone      string `json:"phone,omitempty"`
+	Address1   string `json:"address1,omitempty"`
+	Address2   string `json:"address2,omitempty"`
+	City       string `json:"city,omitempty"`
+	State      string `json:"state,omitempty"`
+	PostalCode string `json:"postalCode,omitempty"`
+	Country    string `json:"country,omitempty"`
+	Passport   string `json:"passport,omitempty"`
+	License    string `json:"license,omitempty"`
+}
+
+type SSHKeyPayload struct {
+	PrivateKey string `json:"privateKey"`
+	Passphrase string `json:"passphrase,omitempty"`
+}
+
+type APITokenPayload struct {
+	Token  string `json:"token"`
+	Secret string `json:"secret,omitempty"`
+}
+
+const maxEnvelopeSize = 4 * 1024
+
+var (
+	last4Pattern       = regexp.MustCompile(`^[0-9]{4}$`)
+	fingerprintPattern = regexp.MustCompile(`^SHA256:[A-Za-z0-9+/]{43}=?$`)
+	cardBrands         = []string{"visa", "mastercard", "amex", "discover", "jcb", "unionpay", "diners", "other"}
+	sshKeyTypes        = []string{"ed25519", "rsa", "ecdsa", "dsa"}
+)
+
+// ValidateEnvelope checks that the envelope of an item matches the schema of
+// its type. Unknown fields are rejected so secrets can't be smuggled into the
+// plaintext part of an item by a careless client.
+func ValidateEnvelope(itemType string, envelope datatypes.JSON) error {
+	if len(envelope) > maxEnvelopeSize {
+		return errors.New("envelope too large")
+	}
+
+	switch itemType {
+	case ItemTypeLogin:
+		return decodeEnvelope(envelope, &LoginEnvelope{})
+	case ItemTypeSecureNote:
+		env := SecureNoteEnvelope{}
+		if err := decodeEnvelope(envelope, &env); err != nil {
+			return err
+		}
+		if env.Format != "" && env.Format != "text" && env.Format != "markdown" {
+			return errors.New("format must be text or markdown")
+		}
+	case ItemTypeCard:
+		env := CardEnvelope{}
+		if err := decodeEnvelope(envelope, &env); err != nil {
+			return err
+		}
+		if env.Brand != "" && !contains(cardBrands, env.Brand) {
+			return fmt.Errorf("unknown card brand %q", env.Brand)
+		}
+		if env.Last4 != "" && !last4Pattern.MatchString(env.Last4) {
+			return errors.New("last4 must be exactly 4 digits")
+		}
+	case ItemTypeIdentity:
+		env := IdentityEnvelope{}
+		if err := decodeEnvelope(envelope, &env); err != nil {
+			return err
+		}
+		if len(env.Label) > 128 {
+			return errors.New("label too long")
+		}
+	case ItemTypeSSHKey:
+		env := SSHKeyEnvelope{}
+		if err := decodeEnvelope(envelope, &env); err != nil {
+			return err
+		}
+		if !contains(sshKeyTypes, env.KeyType) {
+			return errors.New("keyType must be one of ed25519, rsa, ecdsa, dsa")
+		}
+		if env.Fingerprint != "" && !fingerprintPattern.MatchString(env.Fingerprint) {
+			return errors.New("fingerprint must be an OpenSSH SHA256 fingerprint")
+		}
+	case ItemTypeAPIToken:
+		env := APITokenEnvelope{}
+		if err := decodeEnvelope(envelope, &env); err != nil {
+			return err
+		}
+		if len(env.Service) > 128 {
+			return errors.New("service too long")
+		}
+	default:
+		return fmt.Errorf("unknown item type %q", itemType)
+	}
+	return nil
+}
+
+func decodeEnvelope(envelope datatypes.JSON, dst any) error {
+	if len(envelope) == 0 {
+		envelope = datatypes.JSON("{}")
+	}
+	dec := json.NewDecoder(bytes.NewReader(envelope))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(dst); err != nil {
+		return fmt.Errorf("invalid envelope: %w", err)
+	}
+	return nil
+}
+
+func contains(list []string, value string) bool {
+	for _, v := range list {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
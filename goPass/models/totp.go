@@ -0,0 +1,47 @@
+package models
+
+import (
+	"errors"
+	"fmt"
+)
+
+const (
+	TOTPAlgorithmSHA1   = "SHA1"
+	TOTPAlgorithmSHA256 = "SHA256"
+	TOTPAlgorithmSHA512 = "SHA512"
+
+	maxTOTPSeedSize = 1024
+)
+
+// TOTP holds the parameters an authenticator needs to generate codes for an
+// entry. The seed is encrypted on the client with the vault key, the server
+// never sees it and never generates codes itself.
+type TOTP struct {
+	EncryptedSeed []byte
+	SeedIV        []byte
+	Algorithm     string
+	Digits        int
+	Period        int
+}
+
+func ValidateTOTP(totp TOTP) error {
+	if len(totp.EncryptedSeed) == 0 || len(totp.SeedIV) == 0 {
+		return errors.New("totp seed and iv cannot be empty")
+	}
+	if len(totp.EncryptedSeed) > maxTOTPSeedSize {
+		return errors.New("totp seed too large")
+	}
+
+	switch totp.Algorithm {
+	case TOTPAlgorithmSHA1, TOTPAlgorithmSHA256, TOTPAlgorithmSHA512:
+	default:
+		return fmt.Errorf("unsupported totp algorithm %q", totp.Algorithm)
+	}
+	if totp.Digits < 6 || totp.Digits > 8 {
+		return errors.New("totp digits must be between 6 and 8")
+	}
+	if totp.Period < 15 || totp.Period > 300 {
+		return errors.New("totp period must be between 15 and 300 seconds")
+	}
+	return nil
+}
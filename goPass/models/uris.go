@@ -0,0 +1,168 @@
+package models
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"regexp"
+	"strings"
+
+	"golang.org/x/net/publicsuffix"
+)
+
+// Match modes of an EntryURI, from loosest to strictest.
+const (
+	MatchDomain  = "domain"  // same registrable domain, e.g. any host under example.co.uk
+	MatchHost    = "host"    // same host, and port when the URI has one
+	MatchExact   = "exact"   // the whole URI
+	MatchRegex   = "regex"   // a Go regular expression over the whole URI
+	MatchAndroid = "android" // androidapp://<package name>
+)
+
+const (
+	maxEntryURIs    = 32
+	maxEntryURISize = 2048
+	androidScheme   = "androidapp://"
+	indexKeyRegex   = "regex"
+)
+
+var androidPackagePattern = regexp.MustCompile(`^[A-Za-z][A-Za-z0-9_]*(\.[A-Za-z][A-Za-z0-9_]*)+$`)
+
+// EntryURI tells autofill where an entry belongs.
+type EntryURI struct {
+	URI   string `json:"uri"`
+	Match string `json:"match"`
+}
+
+func ValidateURIs(uris []EntryURI) error {
+	if len(uris) > maxEntryURIs {
+		return fmt.Errorf("at most %d uris are allowed", maxEntryURIs)
+	}
+	for i, u := range uris {
+		if u.URI == "" || len(u.URI) > maxEntryURISize {
+			return fmt.Errorf("uri %d: must be 1-%d bytes", i, maxEntryURISize)
+		}
+		switch u.Match {
+		case MatchDomain, MatchHost, MatchExact:
+			if uriHost(u.URI) == "" {
+				return fmt.Errorf("uri %d: no host in %q", i, u.URI)
+			}
+		case MatchRegex:
+			if _, err := regexp.Compile(u.URI); err != nil {
+				return fmt.Errorf("uri %d: invalid regex: %w", i, err)
+			}
+		case MatchAndroid:
+			if !androidPackagePattern.MatchString(androidPackage(u.URI)) {
+				return fmt.Errorf("uri %d: not an android package name", i)
+			}
+		default:
+			return fmt.Errorf("uri %d: match must be domain, host, exact, regex or android", i)
+		}
+	}
+	return nil
+}
+
+// Matches reports whether the entry URI applies to target, the address of
+// a page or an androidapp:// URI.
+func (u EntryURI) Matches(target string) bool {
+	target = strings.TrimSpace(target)
+	switch u.Match {
+	case MatchDomain:
+		host := uriHost(target)
+		return host != "" && baseDomain(host) == baseDomain(uriHost(u.URI))
+	case MatchHost:
+		want := uriHostPort(u.URI)
+		if !strings.Contains(want, ":") {
+			return uriHost(target) == want
+		}
+		return uriHostPort(target) == want
+	case MatchExact:
+		return target == strings.TrimSpace(u.URI)
+	case MatchRegex:
+		re, err := regexp.Compile(u.URI)
+		return err == nil && re.MatchString(target)
+	case MatchAndroid:
+		return strings.HasPrefix(target, androidScheme) && androidPackage(target) == androidPackage(u.URI)
+	}
+	return false
+}
+
+// IndexKey is the domain index bucket an entry URI is filed under. Every
+// target a URI can match falls in the same bucket, except for regexes,
+// which could match anything and share one bucket that is always searched.
+func (u EntryURI) IndexKey() string {
+	switch u.Match {
+	case MatchRegex:
+		return indexKeyRegex
+	case MatchAndroid:
+		return "android:" + androidPackage(u.URI)
+	default:
+		return "domain:" + baseDomain(uriHost(u.URI))
+	}
+}
+
+// LookupKeys returns the index buckets to search for target.
+func LookupKeys(target string) ([]string, error) {
+	target = strings.TrimSpace(target)
+	if strings.HasPrefix(target, androidScheme) {
+		if !androidPackagePattern.MatchString(androidPackage(target)) {
+			return nil, errors.New("not an android package name")
+		}
+		return []string{"android:" + androidPackage(target), indexKeyRegex}, nil
+	}
+	host := uriHost(target)
+	if host == "" {
+		return nil, errors.New("uri has no host")
+	}
+	return []string{"domain:" + baseDomain(host), indexKeyRegex}, nil
+}
+
+func parseURI(raw string) *url.URL {
+	raw = strings.TrimSpace(raw)
+	if !strings.Contains(raw, "://") {
+		raw = "https://" + raw
+	}
+	u, err := url.Parse(raw)
+	if err != nil {
+		return nil
+	}
+	return u
+}
+
+func uriHost(raw string) string {
+	u := parseURI(raw)
+	if u == nil {
+		return ""
+	}
+	return strings.TrimSuffix(strings.ToLower(u.Hostname()), ".")
+}
+
+func uriHostPort(raw string) string {
+	u := parseURI(raw)
+	if u == nil {
+		return ""
+	}
+	if port := u.Port(); port != "" {
+		return uriHost(raw) + ":" + port
+	}
+	return uriHost(raw)
+}
+
+// baseDomain returns the registrable domain of host using the public
+// suffix list, e.g. example.co.uk for login.example.co.uk. IP addresses and
+// single label hosts are returned as they are.
+func baseDomain(host string) string {
+	if net.ParseIP(host) != nil {
+		return host
+	}
+	domain, err := publicsuffix.EffectiveTLDPlusOne(host)
+	if err != nil {
+		return host
+	}
+	return domain
+}
+
+func androidPackage(raw string) string {
+	return strings.TrimSuffix(strings.TrimPrefix(strings.TrimSpace(raw), androidScheme), "/")
+}
@@ -0,0 +1,153 @@
+package notify
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"goPass/config"
+	"goPass/models"
+)
+
+const (
+	expoPushURL = "https://exp.host/--/api/v2/push/send"
+	// Expo takes at most 100 messages per request
+	expoBatchSize = 100
+)
+
+// ExpoSender pushes through the Expo push service to the tokens the
+// devices registered, and forgets tokens Expo says are no longer valid.
+type ExpoSender struct {
+	URL         string
+	AccessToken string // only needed when enhanced push security is on for the project
+	Client      *http.Client
+}
+
+func NewExpoSender(accessToken string) *ExpoSender {
+	return &ExpoSender{
+		URL:         expoPushURL,
+		AccessToken: accessToken,
+		Client:      &http.Client{Timeout: 15 * time.Second},
+	}
+}
+
+type expoMessage struct {
+	To               string            `json:"to"`
+	Title            string            `json:"title,omitempty"`
+	Body             string            `json:"body,omitempty"`
+	Data             map[string]string `json:"data,omitempty"`
+	Sound            string            `json:"sound,omitempty"`
+	ContentAvailable bool              `json:"_contentAvailable,omitempty"`
+}
+
+type expoTicket struct {
+	Status  string `json:"status"`
+	Message string `json:"message"`
+	Details struct {
+		Error string `json:"error"`
+	} `json:"details"`
+}
+
+func (s *ExpoSender) Push(ctx context.Context, userId uuid.UUID, except *uuid.UUID, msg PushMessage) error {
+	tokens, err := deviceTokens(userId, except)
+	if err != nil || len(tokens) == 0 {
+		return err
+	}
+
+	messages := make([]expoMessage, len(tokens))
+	for i, token := range tokens {
+		messages[i] = expoMessage{To: token, Title: msg.Title, Body: msg.Body, Data: msg.Data}
+		if msg.Title == "" && msg.Body == "" {
+			// data only, wakes the app up to sync without showing anything
+			messages[i].ContentAvailable = true
+		} else {
+			messages[i].Sound = "default"
+		}
+	}
+
+	// a failed batch doesn't hold up the others, and the dead tokens found
+	// so far are pruned either way
+	invalid := []string{}
+	var sendErr error
+	for start := 0; start < len(messages); start += expoBatchSize {
+		batch := messages[start:min(start+expoBatchSize, len(messages))]
+		tickets, err := s.send(ctx, batch)
+		if err != nil {
+			if sendErr == nil {
+				sendErr = err
+			}
+			continue
+		}
+		for i, ticket := range tickets {
+			if i < len(batch) && ticket.Status == "error" && ticket.Details.Error == "DeviceNotRegistered" {
+				invalid = append(invalid, batch[i].To)
+			}
+		}
+	}
+	return errors.Join(sendErr, pruneTokens(invalid))
+}
+
+func (s *ExpoSender) send(ctx context.Context, messages []expoMessage) ([]expoTicket, error) {
+	body, err := json.Marshal(messages)
+	if err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, s.URL, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Accept", "application/json")
+	if s.AccessToken != "" {
+		req.Header.Set("Authorization", "Bearer "+s.AccessToken)
+	}
+
+	res, err := s.Client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("expo push returned %s", res.Status)
+	}
+
+	out := struct {
+		Data []expoTicket `json:"data"`
+	}{}
+	if err := json.NewDecoder(res.Body).Decode(&out); err != nil {
+		return nil, err
+	}
+	return out.Data, nil
+}
+
+// deviceTokens returns the push tokens of a user's devices, except one.
+func deviceTokens(userId uuid.UUID, except *uuid.UUID) ([]string, error) {
+	query := config.DB.Model(&models.Device{}).Where("user_id=? AND push_token<>''", userId)
+	if except != nil {
+		query = query.Where("id<>?", *except)
+	}
+	tokens := []string{}
+	err := query.Distinct().Pluck("push_token", &tokens).Error
+	return tokens, err
+}
+
+// pruneTokens drops tokens the provider reported as no longer registered,
+// so they aren't tried again.
+func pruneTokens(tokens []string) error {
+	if len(tokens) == 0 {
+		return nil
+	}
+	return config.DB.Model(&models.Device{}).Where("push_token IN ?", tokens).Update("push_token", "").Error
+}
+
+// ValidExpoToken reports whether token looks like an Expo push token.
+func ValidExpoToken(token string) bool {
+	return (strings.HasPrefix(token, "ExponentPushToken[") || strings.HasPrefix(token, "ExpoPushToken[")) &&
+		strings.HasSuffix(token, "]") && len(token) <= 256
+}
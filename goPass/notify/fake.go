@@ -0,0 +1,42 @@
+package notify
+
+import (
+	"context"
+	"sync"
+
+	"github.com/google/uuid"
+)
+
+// FakePush is one notification a FakePushSender was asked to deliver.
+type FakePush struct {
+	UserID  uuid.UUID
+	Except  *uuid.UUID
+	Message PushMessage
+}
+
+// FakePushSender keeps notifications in memory instead of sending them, for
+// tests. Install it with SetPushSender, the server never picks it itself.
+type FakePushSender struct {
+	mu     sync.Mutex
+	pushes []FakePush
+}
+
+func (f *FakePushSender) Push(ctx context.Context, userId uuid.UUID, except *uuid.UUID, msg PushMessage) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.pushes = append(f.pushes, FakePush{UserID: userId, Except: except, Message: msg})
+	return nil
+}
+
+// Pushes returns what was pushed so far.
+func (f *FakePushSender) Pushes() []FakePush {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return append([]FakePush(nil), f.pushes...)
+}
+
+func (f *FakePushSender) Reset() {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.pushes = nil
+}
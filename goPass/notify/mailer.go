@@ -0,0 +1,50 @@
+package notify
+
+import (
+	"fmt"
+	"log"
+	"net/smtp"
+	"strings"
+)
+
+// Mailer delivers plain text email.
+type Mailer interface {
+	Send(to, subject, body string) error
+}
+
+// LogMailer logs mails instead of sending them, used when no SMTP server
+// is configured. Bodies can hold unlock links and other secrets, so only
+// the recipient and subject are logged.
+type LogMailer struct{}
+
+func (LogMailer) Send(to, subject, body string) error {
+	log.Printf("mail to %s: %s (%d byte body not logged)", to, subject, len(body))
+	return nil
+}
+
+type SMTPMailer struct {
+	Host     string
+	Port     string
+	Username string
+	Password string
+	From     string
+}
+
+func (m SMTPMailer) Send(to, subject, body string) error {
+	if strings.ContainsAny(to, "\r\n") || strings.ContainsAny(subject, "\r\n") {
+		return fmt.Errorf("invalid mail header")
+	}
+
+	msg := "From: " + m.From + "\r\n" +
+		"To: " + to + "\r\n" +
+		"Subject: " + subject + "\r\n" +
+		"MIME-Version: 1.0\r\n" +
+		"Content-Type: text/plain; charset=utf-8\r\n" +
+		"\r\n" + body
+
+	var auth smtp.Auth
+	if m.Username != "" {
+		auth = smtp.PlainAuth("", m.Username, m.Password, m.Host)
+	}
+	return smtp.SendMail(m.Host+":"+m.Port, auth, m.From, []string{to}, []byte(msg))
+}
@@ -0,0 +1,50 @@
+package notify
+
+import (
+	"log"
+	"os"
+
+	"github.com/google/uuid"
+	"goPass/config"
+	"goPass/models"
+)
+
+var mailer Mailer = LogMailer{}
+
+// Setup picks the mailer and push provider from the environment. Without
+// SMTP_HOST mails are only logged, and pushes are only logged unless
+// PUSH_PROVIDER is expo.
+func Setup() {
+	if os.Getenv("PUSH_PROVIDER") == "expo" {
+		pusher = NewExpoSender(os.Getenv("EXPO_ACCESS_TOKEN"))
+	}
+
+	if host := os.Getenv("SMTP_HOST"); host != "" {
+		port := os.Getenv("SMTP_PORT")
+		if port == "" {
+			port = "587"
+		}
+		mailer = SMTPMailer{
+			Host:     host,
+			Port:     port,
+			Username: os.Getenv("SMTP_USER"),
+			Password: os.Getenv("SMTP_PASS"),
+			From:     os.Getenv("SMTP_FROM"),
+		}
+	}
+}
+
+// User emails a user in the background. Failures are logged, never
+// returned, a notification should not fail the request that caused it.
+func User(userId uuid.UUID, subject, body string) {
+	go func() {
+		user := models.AppUser{}
+		if err := config.DB.Where("id=?", userId).Select("id", "email").First(&user).Error; err != nil {
+			log.Println("notify: user not found:", userId)
+			return
+		}
+		if err := mailer.Send(user.Email, subject, body); err != nil {
+			log.Println("notify: failed to send mail:", err)
+		}
+	}()
+}
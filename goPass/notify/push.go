@@ -0,0 +1,67 @@
+package notify
+
+import (
+	"context"
+	"log"
+	"strings"
+
+	"github.com/google/uuid"
+)
+
+// PushMessage is a notification shown on a user's devices. Data is handed
+// to the app and never shown.
+type PushMessage struct {
+	Title string
+	Body  string
+	Data  map[string]string
+}
+
+// PushSender delivers a push notification to the devices of a user, except
+// the one that caused it when except is set.
+type PushSender interface {
+	Push(ctx context.Context, userId uuid.UUID, except *uuid.UUID, msg PushMessage) error
+}
+
+// LogPushSender prints notifications instead of pushing them, used when no
+// push provider is configured.
+type LogPushSender struct{}
+
+func (LogPushSender) Push(ctx context.Context, userId uuid.UUID, except *uuid.UUID, msg PushMessage) error {
+	log.Printf("push to %s: %s\n%s", userId, msg.Title, msg.Body)
+	return nil
+}
+
+var pusher PushSender = LogPushSender{}
+
+// SetPushSender replaces the push provider, e.g. with a fake in tests.
+func SetPushSender(p PushSender) {
+	pusher = p
+}
+
+// Push notifies a user's devices in the background. Like User it only logs
+// failures.
+func Push(userId uuid.UUID, except *uuid.UUID, msg PushMessage) {
+	go func() {
+		if err := pusher.Push(context.Background(), userId, except, msg); err != nil {
+			log.Println("notify: failed to push:", err)
+		}
+	}()
+}
+
+// maxPushedIDs keeps vault change pushes small, with more changes than this
+// the app just syncs everything.
+const maxPushedIDs = 20
+
+// VaultChanged tells a user's other devices to sync. The push carries no
+// visible text and nothing about the entries but their IDs.
+func VaultChanged(userId uuid.UUID, except *uuid.UUID, action string, ids []uuid.UUID) {
+	data := map[string]string{"type": "vault", "action": action}
+	if len(ids) > 0 && len(ids) <= maxPushedIDs {
+		parts := make([]string, len(ids))
+		for i, id := range ids {
+			parts[i] = id.String()
+		}
+		data["ids"] = strings.Join(parts, ",")
+	}
+	Push(userId, except, PushMessage{Data: data})
+}
@@ -0,0 +1,74 @@
+package notify
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// waitForPushes polls the fake until n pushes arrived, Push sends in the
+// background.
+func waitForPushes(t *testing.T, fake *FakePushSender, n int) []FakePush {
+	t.Helper()
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		pushes := fake.Pushes()
+		if len(pushes) >= n {
+			return pushes
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("got %d pushes, want %d", len(pushes), n)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func TestVaultChangedPushesIDsOnly(t *testing.T) {
+	fake := &FakePushSender{}
+	SetPushSender(fake)
+	defer SetPushSender(LogPushSender{})
+
+	userId, deviceId := uuid.New(), uuid.New()
+	ids := []uuid.UUID{uuid.New(), uuid.New()}
+	VaultChanged(userId, &deviceId, "updated", ids)
+
+	push := waitForPushes(t, fake, 1)[0]
+	if push.UserID != userId || push.Except == nil || *push.Except != deviceId {
+		t.Fatalf("pushed to the wrong devices: %+v", push)
+	}
+	if push.Message.Title != "" || push.Message.Body != "" {
+		t.Fatalf("vault pushes must not show anything: %+v", push.Message)
+	}
+	want := map[string]string{"type": "vault", "action": "updated", "ids": ids[0].String() + "," + ids[1].String()}
+	for key, value := range want {
+		if push.Message.Data[key] != value {
+			t.Fatalf("data[%s] = %q, want %q", key, push.Message.Data[key], value)
+		}
+	}
+}
+
+func TestVaultChangedDropsLongIDLists(t *testing.T) {
+	fake := &FakePushSender{}
+	SetPushSender(fake)
+	defer SetPushSender(LogPushSender{})
+
+	ids := make([]uuid.UUID, maxPushedIDs+1)
+	for i := range ids {
+		ids[i] = uuid.New()
+	}
+	VaultChanged(uuid.New(), nil, "imported", ids)
+
+	push := waitForPushes(t, fake, 1)[0]
+	if _, ok := push.Message.Data["ids"]; ok {
+		t.Fatalf("%d ids were pushed: %s", len(ids), push.Message.Data["ids"])
+	}
+
+	fake.Reset()
+	VaultChanged(uuid.New(), nil, "imported", ids[:maxPushedIDs])
+	push = waitForPushes(t, fake, 1)[0]
+	if got := strings.Count(push.Message.Data["ids"], ",") + 1; got != maxPushedIDs {
+		t.Fatalf("pushed %d ids, want %d", got, maxPushedIDs)
+	}
+}
@@ -0,0 +1,151 @@
+package notify
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"time"
+
+	"github.com/google/uuid"
+	"goPass/config"
+	"goPass/models"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// Preferences returns the user's notification preferences, everything on
+// when they never changed them.
+func Preferences(userId uuid.UUID) (models.NotificationPreference, error) {
+	prefs := models.NotificationPreference{}
+	err := config.DB.Where("user_id=?", userId).First(&prefs).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return models.NotificationPreference{UserID: userId, LoginEmail: true, LoginPush: true, DeviceEmail: true, DevicePush: true}, nil
+	}
+	return prefs, err
+}
+
+// Login remembers where a successful login came from and, when the device
+// or network is new for the user, tells them by email and push. The first
+// login of an account is never reported. Runs in the background like User.
+func Login(userId uuid.UUID, deviceId *uuid.UUID, ip, userAgent string) {
+	go func() {
+		if err := checkLogin(userId, deviceId, ip, userAgent); err != nil {
+			log.Println("notify: failed to check login:", err)
+		}
+	}()
+}
+
+func checkLogin(userId uuid.UUID, deviceId *uuid.UUID, ip, userAgent string) error {
+	now := time.Now()
+	deviceKey := ""
+	if deviceId != nil {
+		deviceKey = deviceId.String()
+	}
+	network := networkOf(ip)
+
+	res := config.DB.Model(&models.KnownLogin{}).
+		Where("user_id=? AND device_key=? AND network=?", userId, deviceKey, network).
+		Update("last_seen_at", now)
+	if res.Error != nil || res.RowsAffected > 0 {
+		return res.Error
+	}
+
+	var known, knownDevice int64
+	if err := config.DB.Model(&models.KnownLogin{}).Where("user_id=?", userId).Count(&known).Error; err != nil {
+		return err
+	}
+	if deviceKey != "" {
+		if err := config.DB.Model(&models.KnownLogin{}).Where("user_id=? AND device_key=?", userId, deviceKey).Count(&knownDevice).Error; err != nil {
+			return err
+		}
+	}
+
+	login := models.KnownLogin{
+		ID:          uuid.New(),
+		UserID:      userId,
+		DeviceKey:   deviceKey,
+		Network:     network,
+		FirstSeenAt: now,
+		LastSeenAt:  now,
+	}
+	res = config.DB.Omit(clause.Associations).Clauses(clause.OnConflict{DoNothing: true}).Create(&login)
+	if res.Error != nil || res.RowsAffected == 0 || known == 0 {
+		// another request got there first, or this is the account's first login
+		return res.Error
+	}
+
+	prefs, err := Preferences(userId)
+	if err != nil {
+		return err
+	}
+	what := "a new device"
+	if knownDevice > 0 {
+		what = "a new location"
+	}
+	device := "unknown"
+	if deviceId != nil {
+		d := models.Device{}
+		if config.DB.Where("id=? AND user_id=?", *deviceId, userId).Select("device_name").First(&d).Error == nil && d.DeviceName != "" {
+			device = d.DeviceName
+		}
+	}
+
+	if prefs.LoginEmail {
+		User(userId, "New sign-in to your goPass account", fmt.Sprintf(
+			"Your goPass account was signed in to from %s.\n\nTime: %s\nIP address: %s\nDevice: %s\nApp: %s\n\n"+
+				"If this wasn't you, change your master password and revoke any device you don't recognise.",
+			what, now.UTC().Format(time.RFC1123), ip, device, userAgent))
+	}
+	if prefs.LoginPush {
+		Push(userId, deviceId, PushMessage{
+			Title: "New sign-in",
+			Body:  fmt.Sprintf("Your account was signed in to from %s (%s).", what, ip),
+			Data:  map[string]string{"type": "login", "ip": ip},
+		})
+	}
+	return nil
+}
+
+// DeviceRegistered tells a user that a device was added to their account.
+// Registering the first device is part of signing up and isn't reported.
+func DeviceRegistered(userId uuid.UUID, device models.Device, ip string) {
+	go func() {
+		var devices int64
+		if err := config.DB.Model(&models.Device{}).Where("user_id=?", userId).Count(&devices).Error; err != nil || devices <= 1 {
+			return
+		}
+		prefs, err := Preferences(userId)
+		if err != nil {
+			log.Println("notify: failed to load preferences:", err)
+			return
+		}
+
+		if prefs.DeviceEmail {
+			User(userId, "A device was added to your goPass account", fmt.Sprintf(
+				"The device %q was added to your goPass account.\n\nTime: %s\nIP address: %s\n\n"+
+					"If this wasn't you, revoke the device and change your master password.",
+				device.DeviceName, time.Now().UTC().Format(time.RFC1123), ip))
+		}
+		if prefs.DevicePush {
+			Push(userId, &device.ID, PushMessage{
+				Title: "New device",
+				Body:  fmt.Sprintf("%q was added to your account.", device.DeviceName),
+				Data:  map[string]string{"type": "device", "deviceId": device.ID.String()},
+			})
+		}
+	}()
+}
+
+// networkOf reduces an address to the network it is in, so a phone moving
+// around one provider's addresses doesn't count as a new location.
+func networkOf(ip string) string {
+	addr := net.ParseIP(ip)
+	if addr == nil {
+		return ip
+	}
+	if v4 := addr.To4(); v4 != nil {
+		return (&net.IPNet{IP: v4.Mask(net.CIDRMask(24, 32)), Mask: net.CIDRMask(24, 32)}).String()
+	}
+	return (&net.IPNet{IP: addr.Mask(net.CIDRMask(48, 128)), Mask: net.CIDRMask(48, 128)}).String()
+}
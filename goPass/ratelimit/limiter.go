@@ -0,0 +1,151 @@
+// Package ratelimit throttles authentication with sliding windows over a
+// shared Store, backs off exponentially after failed logins and tells the
+// caller when an account has failed often enough to be locked.
+package ratelimit
+
+import (
+	"context"
+	"log"
+	"strings"
+	"time"
+)
+
+// Rule allows Limit attempts per key within any Window long stretch.
+type Rule struct {
+	Name   string
+	Limit  int
+	Window time.Duration
+}
+
+var (
+	IPLogins      = Rule{Name: "login:ip", Limit: 30, Window: 5 * time.Minute}
+	AccountLogins = Rule{Name: "login:account", Limit: 10, Window: 15 * time.Minute}
+	IPRefresh     = Rule{Name: "refresh:ip", Limit: 60, Window: time.Minute}
+	SendAccess    = Rule{Name: "send:ip", Limit: 30, Window: 5 * time.Minute}
+	IconFetch     = Rule{Name: "icons:ip", Limit: 300, Window: time.Minute}
+)
+
+const failureKey = "login:failure"
+
+// Decision is the answer to one attempt. RetryAfter is only set when the
+// attempt is refused.
+type Decision struct {
+	Allowed    bool
+	RetryAfter time.Duration
+}
+
+// Limiter applies the rules and failure policy to a Store. Failures of an
+// account are counted within FailureWindow: from BackoffAfter on every
+// further attempt waits twice as long as the last, up to BackoffMax, and
+// LockoutAfter failures lock the account.
+type Limiter struct {
+	Store         Store
+	FailureWindow time.Duration
+	BackoffAfter  int
+	BackoffBase   time.Duration
+	BackoffMax    time.Duration
+	LockoutAfter  int
+	LockoutFor    time.Duration
+	now           func() time.Time
+}
+
+func NewLimiter(store Store) *Limiter {
+	return &Limiter{
+		Store:         store,
+		FailureWindow: time.Hour,
+		BackoffAfter:  3,
+		BackoffBase:   time.Second,
+		BackoffMax:    15 * time.Minute,
+		LockoutAfter:  10,
+		LockoutFor:    time.Hour,
+		now:           time.Now,
+	}
+}
+
+// Allow counts an attempt against rule for key, unless the rule is already
+// used up. Refused attempts aren't counted, so the key is free again as soon
+// as the oldest attempt in the window expires.
+func (l *Limiter) Allow(ctx context.Context, rule Rule, key string) (Decision, error) {
+	now := l.now()
+	k := rule.Name + ":" + key
+	usage, taken, err := l.Store.Take(ctx, k, now.Add(-rule.Window), now, rule.Limit)
+	if err != nil {
+		return Decision{}, err
+	}
+	if !taken {
+		return refuse(usage.First.Add(rule.Window).Sub(now)), nil
+	}
+	return Decision{Allowed: true}, nil
+}
+
+// Backoff tells whether account has waited long enough since its last
+// failed login.
+func (l *Limiter) Backoff(ctx context.Context, account string) (Decision, error) {
+	now := l.now()
+	usage, err := l.Store.Usage(ctx, failureKey+":"+account, now.Add(-l.FailureWindow))
+	if err != nil {
+		return Decision{}, err
+	}
+	if usage.Count < l.BackoffAfter {
+		return Decision{Allowed: true}, nil
+	}
+	delay := l.BackoffMax
+	if shift := usage.Count - l.BackoffAfter; shift < 32 && l.BackoffBase<<shift < l.BackoffMax {
+		delay = l.BackoffBase << shift
+	}
+	if wait := usage.Last.Add(delay).Sub(now); wait > 0 {
+		return refuse(wait), nil
+	}
+	return Decision{Allowed: true}, nil
+}
+
+// Fail records a failed login of account and returns how many it has had
+// within FailureWindow, the caller locks the account from LockoutAfter on.
+func (l *Limiter) Fail(ctx context.Context, account string) (int, error) {
+	now := l.now()
+	k := failureKey + ":" + account
+	if err := l.Store.Add(ctx, k, now); err != nil {
+		return 0, err
+	}
+	usage, err := l.Store.Usage(ctx, k, now.Add(-l.FailureWindow))
+	return usage.Count, err
+}
+
+// Reset forgets the failures of account, after a successful login or an
+// unlock.
+func (l *Limiter) Reset(ctx context.Context, account string) error {
+	return l.Store.Clear(ctx, failureKey+":"+account)
+}
+
+// Prune drops everything older than the longest window in use.
+func (l *Limiter) Prune(ctx context.Context) error {
+	longest := l.FailureWindow
+	for _, rule := range []Rule{IPLogins, AccountLogins, IPRefresh, SendAccess, IconFetch} {
+		if rule.Window > longest {
+			longest = rule.Window
+		}
+	}
+	return l.Store.Prune(ctx, l.now().Add(-longest))
+}
+
+// PruneJob returns the function the scheduler runs to prune the store.
+func (l *Limiter) PruneJob() func() {
+	return func() {
+		if err := l.Prune(context.Background()); err != nil {
+			log.Println("rate limit prune failed:", err)
+		}
+	}
+}
+
+// Account is the key an email is limited under, so case variants of one
+// address share their limits.
+func Account(email string) string {
+	return strings.ToLower(strings.TrimSpace(email))
+}
+
+func refuse(wait time.Duration) Decision {
+	if wait < time.Second {
+		wait = time.Second
+	}
+	return Decision{RetryAfter: wait}
+}
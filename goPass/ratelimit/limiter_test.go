@@ -0,0 +1,214 @@
+package ratelimit
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+)
+
+// clock is a fake time source for the limiter's now hook.
+type clock struct {
+	t time.Time
+}
+
+func (c *clock) now() time.Time          { return c.t }
+func (c *clock) advance(d time.Duration) { c.t = c.t.Add(d) }
+
+func newTestLimiter() (*Limiter, *clock) {
+	c := &clock{t: time.Date(2026, 10, 1, 12, 0, 0, 0, time.UTC)}
+	l := NewLimiter(NewMemoryStore())
+	l.now = c.now
+	return l, c
+}
+
+func TestAllowSlidingWindow(t *testing.T) {
+	l, c := newTestLimiter()
+	ctx := context.Background()
+	rule := Rule{Name: "test", Limit: 3, Window: time.Minute}
+
+	// three attempts at 12:00:00, 12:00:19 and 12:00:38 use up the window
+	for i := 0; i < 3; i++ {
+		d, err := l.Allow(ctx, rule, "1.2.3.4")
+		if err != nil || !d.Allowed {
+			t.Fatalf("attempt %d refused: %+v, %v", i+1, d, err)
+		}
+		c.advance(19 * time.Second)
+	}
+
+	d, err := l.Allow(ctx, rule, "1.2.3.4")
+	if err != nil || d.Allowed {
+		t.Fatalf("fourth attempt allowed: %+v, %v", d, err)
+	}
+	// the clock is at 12:00:57, the first attempt expires at 12:01:00
+	if want := 3 * time.Second; d.RetryAfter != want {
+		t.Fatalf("RetryAfter = %v, want %v", d.RetryAfter, want)
+	}
+
+	// other keys are counted apart
+	if d, _ := l.Allow(ctx, rule, "5.6.7.8"); !d.Allowed {
+		t.Fatal("another key was refused")
+	}
+
+	// once the oldest attempt slides out one more is allowed, but only one
+	c.advance(3 * time.Second)
+	if d, _ := l.Allow(ctx, rule, "1.2.3.4"); !d.Allowed {
+		t.Fatal("attempt refused after the oldest one expired")
+	}
+	d, _ = l.Allow(ctx, rule, "1.2.3.4")
+	if d.Allowed {
+		t.Fatal("window not full again")
+	}
+	// the oldest left is the one at 12:00:19
+	if want := 19 * time.Second; d.RetryAfter != want {
+		t.Fatalf("RetryAfter = %v, want %v", d.RetryAfter, want)
+	}
+}
+
+func TestAllowDoesNotCountRefusals(t *testing.T) {
+	l, c := newTestLimiter()
+	ctx := context.Background()
+	rule := Rule{Name: "test", Limit: 1, Window: time.Minute}
+
+	l.Allow(ctx, rule, "k")
+	for i := 0; i < 10; i++ {
+		c.advance(5 * time.Second)
+		if d, _ := l.Allow(ctx, rule, "k"); d.Allowed {
+			t.Fatal("refused attempts didn't stay refused")
+		}
+	}
+	c.advance(11 * time.Second)
+	if d, _ := l.Allow(ctx, rule, "k"); !d.Allowed {
+		t.Fatal("refused attempts were counted against the window")
+	}
+}
+
+func TestAllowConcurrent(t *testing.T) {
+	l, _ := newTestLimiter()
+	rule := Rule{Name: "test", Limit: 10, Window: time.Minute}
+
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	allowed := 0
+	for i := 0; i < 100; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if d, err := l.Allow(context.Background(), rule, "k"); err == nil && d.Allowed {
+				mu.Lock()
+				allowed++
+				mu.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+	if allowed != rule.Limit {
+		t.Fatalf("%d concurrent attempts allowed, want %d", allowed, rule.Limit)
+	}
+}
+
+func TestBackoff(t *testing.T) {
+	l, c := newTestLimiter()
+	ctx := context.Background()
+	account := Account(" Jane@Example.com ")
+
+	tests := []struct {
+		failures int
+		wait     time.Duration
+	}{
+		{1, 0},
+		{2, 0},
+		{3, time.Second},
+		{4, 2 * time.Second},
+		{5, 4 * time.Second},
+		{6, 8 * time.Second},
+		{12, 512 * time.Second},
+		{13, 15 * time.Minute},
+		{40, 15 * time.Minute},
+	}
+	failures := 0
+	for _, tt := range tests {
+		for failures < tt.failures {
+			if _, err := l.Fail(ctx, account); err != nil {
+				t.Fatal(err)
+			}
+			failures++
+		}
+		d, err := l.Backoff(ctx, account)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if tt.wait == 0 {
+			if !d.Allowed {
+				t.Fatalf("after %d failures: refused, want allowed", tt.failures)
+			}
+			continue
+		}
+		if d.Allowed || d.RetryAfter != tt.wait {
+			t.Fatalf("after %d failures: %+v, want a %v wait", tt.failures, d, tt.wait)
+		}
+	}
+
+	// the wait counts from the last failure
+	c.advance(15*time.Minute - time.Second)
+	if d, _ := l.Backoff(ctx, "jane@example.com"); d.Allowed {
+		t.Fatal("allowed before the wait was over")
+	}
+	c.advance(time.Second)
+	if d, _ := l.Backoff(ctx, "jane@example.com"); !d.Allowed {
+		t.Fatal("still refused after the wait")
+	}
+}
+
+func TestFailuresLockAndExpire(t *testing.T) {
+	l, c := newTestLimiter()
+	ctx := context.Background()
+
+	for i := 1; i <= l.LockoutAfter; i++ {
+		n, err := l.Fail(ctx, "jane@example.com")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if n != i {
+			t.Fatalf("Fail returned %d, want %d", n, i)
+		}
+		c.advance(time.Minute)
+	}
+
+	// failures older than FailureWindow stop counting: the first one was
+	// at 12:00, the clock is at 12:10, so at 13:00:30 only nine are left
+	c.advance(50*time.Minute + 30*time.Second)
+	if n, _ := l.Fail(ctx, "jane@example.com"); n != l.LockoutAfter {
+		t.Fatalf("Fail returned %d, want %d with the oldest failure expired", n, l.LockoutAfter)
+	}
+
+	if err := l.Reset(ctx, "jane@example.com"); err != nil {
+		t.Fatal(err)
+	}
+	if n, _ := l.Fail(ctx, "jane@example.com"); n != 1 {
+		t.Fatalf("Fail returned %d after a reset, want 1", n)
+	}
+	if d, _ := l.Backoff(ctx, "jane@example.com"); !d.Allowed {
+		t.Fatal("backoff survived the reset")
+	}
+}
+
+func TestPrune(t *testing.T) {
+	l, c := newTestLimiter()
+	ctx := context.Background()
+	store := l.Store.(*MemoryStore)
+
+	l.Fail(ctx, "old@example.com")
+	c.advance(30 * time.Minute)
+	l.Fail(ctx, "new@example.com")
+	c.advance(31 * time.Minute)
+	if err := l.Prune(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := store.events[failureKey+":old@example.com"]; ok {
+		t.Fatal("failure older than every window survived the prune")
+	}
+	if _, ok := store.events[failureKey+":new@example.com"]; !ok {
+		t.Fatal("failure within FailureWindow was pruned")
+	}
+}
@@ -0,0 +1,163 @@
+package ratelimit
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"goPass/models"
+	"gorm.io/gorm"
+)
+
+// Usage is what a Store knows about one key within a window.
+type Usage struct {
+	Count int
+	First time.Time
+	Last  time.Time
+}
+
+// Store keeps timestamped events per key. Instances sharing a Store share
+// their limits.
+type Store interface {
+	Add(ctx context.Context, key string, at time.Time) error
+	// Usage counts the events of key after since.
+	Usage(ctx context.Context, key string, since time.Time) (Usage, error)
+	// Take adds an event at at unless key already has limit events after
+	// since, as one step so concurrent callers can't all squeeze in. It
+	// returns the usage before the event and whether it was added.
+	Take(ctx context.Context, key string, since, at time.Time, limit int) (Usage, bool, error)
+	Clear(ctx context.Context, key string) error
+	// Prune forgets every event before before.
+	Prune(ctx context.Context, before time.Time) error
+}
+
+// MemoryStore keeps events in the process, for a single instance.
+type MemoryStore struct {
+	mu     sync.Mutex
+	events map[string][]time.Time
+}
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{events: map[string][]time.Time{}}
+}
+
+func (s *MemoryStore) Add(ctx context.Context, key string, at time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.events[key] = append(s.events[key], at)
+	return nil
+}
+
+func (s *MemoryStore) Usage(ctx context.Context, key string, since time.Time) (Usage, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.usage(key, since), nil
+}
+
+func (s *MemoryStore) Take(ctx context.Context, key string, since, at time.Time, limit int) (Usage, bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	usage := s.usage(key, since)
+	if usage.Count >= limit {
+		return usage, false, nil
+	}
+	s.events[key] = append(s.events[key], at)
+	return usage, true, nil
+}
+
+func (s *MemoryStore) usage(key string, since time.Time) Usage {
+	usage := Usage{}
+	for _, at := range s.events[key] {
+		if !at.After(since) {
+			continue
+		}
+		if usage.Count == 0 || at.Before(usage.First) {
+			usage.First = at
+		}
+		if at.After(usage.Last) {
+			usage.Last = at
+		}
+		usage.Count++
+	}
+	return usage
+}
+
+func (s *MemoryStore) Clear(ctx context.Context, key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.events, key)
+	return nil
+}
+
+func (s *MemoryStore) Prune(ctx context.Context, before time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for key, events := range s.events {
+		kept := events[:0]
+		for _, at := range events {
+			if at.After(before) {
+				kept = append(kept, at)
+			}
+		}
+		if len(kept) == 0 {
+			delete(s.events, key)
+		} else {
+			s.events[key] = kept
+		}
+	}
+	return nil
+}
+
+// PostgresStore keeps events in the rate_limit_events table so every
+// instance sees the same counts.
+type PostgresStore struct {
+	DB *gorm.DB
+}
+
+func (s PostgresStore) Add(ctx context.Context, key string, at time.Time) error {
+	return s.DB.WithContext(ctx).Create(&models.RateLimitEvent{Key: key, At: at}).Error
+}
+
+func (s PostgresStore) Usage(ctx context.Context, key string, since time.Time) (Usage, error) {
+	row := struct {
+		Count int
+		First *time.Time
+		Last  *time.Time
+	}{}
+	err := s.DB.WithContext(ctx).Model(&models.RateLimitEvent{}).
+		Select("count(*) AS count, min(at) AS first, max(at) AS last").
+		Where("key=? AND at>?", key, since).
+		Scan(&row).Error
+	if err != nil || row.Count == 0 {
+		return Usage{}, err
+	}
+	return Usage{Count: row.Count, First: *row.First, Last: *row.Last}, nil
+}
+
+// Take holds a transaction scoped advisory lock on the key while it counts
+// and inserts, which serializes attempts on one key across instances.
+func (s PostgresStore) Take(ctx context.Context, key string, since, at time.Time, limit int) (Usage, bool, error) {
+	var usage Usage
+	taken := false
+	err := s.DB.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Exec("SELECT pg_advisory_xact_lock(hashtext(?))", "ratelimit:"+key).Error; err != nil {
+			return err
+		}
+		locked := PostgresStore{DB: tx}
+		var err error
+		if usage, err = locked.Usage(ctx, key, since); err != nil || usage.Count >= limit {
+			return err
+		}
+		taken = true
+		return locked.Add(ctx, key, at)
+	})
+	return usage, taken && err == nil, err
+}
+
+func (s PostgresStore) Clear(ctx context.Context, key string) error {
+	return s.DB.WithContext(ctx).Where("key=?", key).Delete(&models.RateLimitEvent{}).Error
+}
+
+func (s PostgresStore) Prune(ctx context.Context, before time.Time) error {
+	return s.DB.WithContext(ctx).Where("at<?", before).Delete(&models.RateLimitEvent{}).Error
+}
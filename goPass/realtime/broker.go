@@ -0,0 +1,129 @@
+package realtime
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// ActionResync tells a device that changes may have been missed and it
+// should sync everything.
+const ActionResync = "resync"
+
+const (
+	// a subscriber that falls this far behind is dropped, its device
+	// resyncs when it reconnects
+	subscriptionBuffer      = 64
+	maxSubscriptionsPerUser = 16
+)
+
+var ErrTooManySubscriptions = errors.New("too many open change streams for this user")
+
+// Change is one change to a user's vault as streamed to their devices. It
+// says what changed, never the content.
+type Change struct {
+	UserID   uuid.UUID  `json:"userId"`
+	Action   string     `json:"action"`
+	IDs      []string   `json:"ids,omitempty"`
+	DeviceID *uuid.UUID `json:"deviceId,omitempty"` // the device that made the change
+	At       time.Time  `json:"at"`
+}
+
+// Broker fans changes out to the open streams of a user.
+type Broker interface {
+	Publish(ctx context.Context, change Change) error
+	Subscribe(userId uuid.UUID) (*Subscription, error)
+}
+
+// Subscription receives a user's changes on C until it is closed. C is
+// also closed when the subscriber falls behind.
+type Subscription struct {
+	C <-chan Change
+
+	ch     chan Change
+	userId uuid.UUID
+	hub    *Memory
+	once   sync.Once
+}
+
+func (s *Subscription) Close() {
+	s.hub.remove(s)
+}
+
+// Memory is a Broker within one process. It is enough for a single
+// instance and is the local half of the Postgres broker.
+type Memory struct {
+	mu   sync.Mutex
+	subs map[uuid.UUID]map[*Subscription]struct{}
+}
+
+func NewMemory() *Memory {
+	return &Memory{subs: map[uuid.UUID]map[*Subscription]struct{}{}}
+}
+
+func (m *Memory) Publish(ctx context.Context, change Change) error {
+	m.deliver(change)
+	return nil
+}
+
+func (m *Memory) Subscribe(userId uuid.UUID) (*Subscription, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if len(m.subs[userId]) >= maxSubscriptionsPerUser {
+		return nil, ErrTooManySubscriptions
+	}
+	ch := make(chan Change, subscriptionBuffer)
+	sub := &Subscription{C: ch, ch: ch, userId: userId, hub: m}
+	if m.subs[userId] == nil {
+		m.subs[userId] = map[*Subscription]struct{}{}
+	}
+	m.subs[userId][sub] = struct{}{}
+	return sub, nil
+}
+
+func (m *Memory) deliver(change Change) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for sub := range m.subs[change.UserID] {
+		select {
+		case sub.ch <- change:
+		default:
+			m.removeLocked(sub)
+		}
+	}
+}
+
+// resyncAll asks every open stream to resync, after changes may have been
+// lost on the way to this instance.
+func (m *Memory) resyncAll() {
+	m.mu.Lock()
+	users := make([]uuid.UUID, 0, len(m.subs))
+	for userId := range m.subs {
+		users = append(users, userId)
+	}
+	m.mu.Unlock()
+
+	now := time.Now().UTC()
+	for _, userId := range users {
+		m.deliver(Change{UserID: userId, Action: ActionResync, At: now})
+	}
+}
+
+func (m *Memory) remove(sub *Subscription) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.removeLocked(sub)
+}
+
+func (m *Memory) removeLocked(sub *Subscription) {
+	sub.once.Do(func() {
+		delete(m.subs[sub.userId], sub)
+		if len(m.subs[sub.userId]) == 0 {
+			delete(m.subs, sub.userId)
+		}
+		close(sub.ch)
+	})
+}
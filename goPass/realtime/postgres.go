@@ -0,0 +1,89 @@
+package realtime
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/lib/pq"
+	"gorm.io/gorm"
+)
+
+const (
+	notifyChannel = "gopass_changes"
+	// NOTIFY payloads must stay under 8000 bytes
+	maxPayload   = 7500
+	pingInterval = 90 * time.Second
+)
+
+// Postgres shares changes between instances with LISTEN/NOTIFY. Every
+// instance listens and hands what it hears to its own streams, including
+// the changes it published itself.
+type Postgres struct {
+	local    *Memory
+	db       *gorm.DB
+	listener *pq.Listener
+}
+
+func NewPostgres(db *gorm.DB, dsn string) (*Postgres, error) {
+	p := &Postgres{local: NewMemory(), db: db}
+	p.listener = pq.NewListener(dsn, time.Second, time.Minute, func(event pq.ListenerEventType, err error) {
+		if err != nil {
+			log.Println("realtime: listener:", err)
+		}
+		if event == pq.ListenerEventReconnected {
+			// whatever was published while disconnected is gone
+			p.local.resyncAll()
+		}
+	})
+	if err := p.listener.Listen(notifyChannel); err != nil {
+		p.listener.Close()
+		return nil, err
+	}
+	go p.run()
+	return p, nil
+}
+
+func (p *Postgres) run() {
+	ping := time.NewTicker(pingInterval)
+	defer ping.Stop()
+	for {
+		select {
+		case n, ok := <-p.listener.Notify:
+			if !ok {
+				return
+			}
+			if n == nil {
+				continue
+			}
+			change := Change{}
+			if err := json.Unmarshal([]byte(n.Extra), &change); err != nil {
+				log.Println("realtime: bad notification:", err)
+				continue
+			}
+			p.local.deliver(change)
+		case <-ping.C:
+			go p.listener.Ping()
+		}
+	}
+}
+
+func (p *Postgres) Publish(ctx context.Context, change Change) error {
+	payload, err := json.Marshal(change)
+	if err != nil {
+		return err
+	}
+	if len(payload) > maxPayload {
+		change.IDs = nil
+		if payload, err = json.Marshal(change); err != nil {
+			return err
+		}
+	}
+	return p.db.WithContext(ctx).Exec("SELECT pg_notify(?, ?)", notifyChannel, string(payload)).Error
+}
+
+func (p *Postgres) Subscribe(userId uuid.UUID) (*Subscription, error) {
+	return p.local.Subscribe(userId)
+}
@@ -0,0 +1,20 @@
+package router
+
+import (
+	"github.com/gofiber/fiber/v2"
+	"goPass/controller"
+	"goPass/middlewares"
+)
+
+func AccountRoute(app *fiber.App) {
+	AccountRouter := app.Group("/account")
+
+	AccountRouter.Get("/", func(c *fiber.Ctx) error {
+		return c.SendString("account router is up and running")
+	})
+
+	AccountRouter.Get("/events", middleware.AuthAppUser, controller.ListAccountEvents)
+
+	AccountRouter.Get("/notifications", middleware.AuthAppUser, controller.GetNotificationPreferences)
+	AccountRouter.Put("/notifications", middleware.AuthAppUser, controller.UpdateNotificationPreferences)
+}
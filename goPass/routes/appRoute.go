@@ -14,4 +14,5 @@ func AppRouter(app *fiber.App) {
 	})
 	appRoute.Post("/registerVault", middleware.AuthAppUser, controller.RegisterVaultEntry)
 	appRoute.Get("/isVaultRegistered", middleware.AuthAppUser, controller.CheckIfVaultRegistered)
+	appRoute.Post("/registerKeys", middleware.AuthAppUser, controller.RegisterKeyPair)
 }
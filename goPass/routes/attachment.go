@@ -0,0 +1,22 @@
+package router
+
+import (
+	"github.com/gofiber/fiber/v2"
+	"goPass/controller"
+	"goPass/middlewares"
+)
+
+func AttachmentRoute(app *fiber.App) {
+	AttachmentRouter := app.Group("/attachment")
+
+	AttachmentRouter.Get("/", func(c *fiber.Ctx) error {
+		return c.SendString("attachment route is up and running")
+	})
+
+	AttachmentRouter.Get("/list", middleware.AuthAppUser, controller.ListAttachments)
+	AttachmentRouter.Post("/create", middleware.AuthAppUser, controller.CreateAttachment)
+	AttachmentRouter.Put("/:attachmentId/chunk/:index", middleware.AuthAppUser, controller.UploadAttachmentChunk)
+	AttachmentRouter.Post("/:attachmentId/complete", middleware.AuthAppUser, controller.CompleteAttachment)
+	AttachmentRouter.Get("/:attachmentId/download", middleware.AuthAppUser, controller.DownloadAttachment)
+	AttachmentRouter.Delete("/delete/:attachmentId", middleware.AuthAppUser, controller.DeleteAttachment)
+}
@@ -4,6 +4,7 @@ import (
 	"github.com/gofiber/fiber/v2"
 	"goPass/controller"
 	"goPass/middlewares"
+	"goPass/ratelimit"
 )
 
 func AuthRoute(app *fiber.App) {
@@ -14,7 +15,9 @@ func AuthRoute(app *fiber.App) {
 	})
 
 	AuthRouter.Post("/register", controller.RegisterAppUser)
-	AuthRouter.Post("/login", controller.LoginAppUser)
+	AuthRouter.Post("/login", middleware.LimitIP(ratelimit.IPLogins), controller.LoginAppUser)
 	AuthRouter.Get("/profile", middleware.AuthAppUser, controller.AppGetProfile)
-	AuthRouter.Get("/refresh", controller.RefreshAppToken)
+	AuthRouter.Get("/refresh", middleware.LimitIP(ratelimit.IPRefresh), controller.RefreshAppToken)
+	AuthRouter.Get("/unlock", controller.UnlockAccountPage)
+	AuthRouter.Post("/unlock", middleware.LimitIP(ratelimit.IPLogins), controller.UnlockAccount)
 }
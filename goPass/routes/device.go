@@ -2,6 +2,7 @@ package router
 
 import (
 	"goPass/controller"
+	"goPass/middlewares"
 
 	"github.com/gofiber/fiber/v2"
 )
@@ -13,7 +14,8 @@ func DeviceRoute(app *fiber.App) {
 		return c.SendString("device route is up and running")
 	})
 
-	DeviceRouter.Post("/register", controller.RegisterDevice)
-	DeviceRouter.Get("/list", controller.ListDevices)
-	DeviceRouter.Delete("/revoke/:id", controller.RevokeDevice)
+	DeviceRouter.Post("/register", middleware.AuthAppUser, controller.RegisterDevice)
+	DeviceRouter.Get("/list", middleware.AuthAppUser, controller.ListDevices)
+	DeviceRouter.Delete("/revoke/:id", middleware.AuthAppUser, controller.RevokeDevice)
+	DeviceRouter.Put("/push-token", middleware.AuthAppUser, controller.SetPushToken)
 }
@@ -0,0 +1,26 @@
+package router
+
+import (
+	"github.com/gofiber/fiber/v2"
+	"goPass/controller"
+	"goPass/middlewares"
+)
+
+func EmergencyRoute(app *fiber.App) {
+	EmergencyRouter := app.Group("/emergency")
+
+	EmergencyRouter.Get("/", func(c *fiber.Ctx) error {
+		return c.SendString("emergency route is up and running")
+	})
+
+	EmergencyRouter.Post("/invite", middleware.AuthAppUser, controller.InviteEmergencyContact)
+	EmergencyRouter.Get("/contacts", middleware.AuthAppUser, controller.ListEmergencyContacts)
+	EmergencyRouter.Get("/grantors", middleware.AuthAppUser, controller.ListEmergencyGrantors)
+	EmergencyRouter.Post("/:accessId/accept", middleware.AuthAppUser, controller.AcceptEmergencyInvite)
+	EmergencyRouter.Post("/:accessId/confirm", middleware.AuthAppUser, controller.ConfirmEmergencyContact)
+	EmergencyRouter.Post("/:accessId/request", middleware.AuthAppUser, controller.RequestEmergencyAccess)
+	EmergencyRouter.Post("/:accessId/approve", middleware.AuthAppUser, controller.ApproveEmergencyAccess)
+	EmergencyRouter.Post("/:accessId/reject", middleware.AuthAppUser, controller.RejectEmergencyAccess)
+	EmergencyRouter.Get("/:accessId/vault", middleware.AuthAppUser, controller.GetEmergencyVault)
+	EmergencyRouter.Delete("/revoke/:accessId", middleware.AuthAppUser, controller.RevokeEmergencyAccess)
+}
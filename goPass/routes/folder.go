@@ -0,0 +1,21 @@
+package router
+
+import (
+	"github.com/gofiber/fiber/v2"
+	"goPass/controller"
+	"goPass/middlewares"
+)
+
+func FolderRoute(app *fiber.App) {
+	FolderRouter := app.Group("/folder")
+
+	FolderRouter.Get("/", func(c *fiber.Ctx) error {
+		return c.SendString("folder route is up and running")
+	})
+
+	FolderRouter.Get("/list", middleware.AuthAppUser, controller.ListFolders)
+	FolderRouter.Post("/create", middleware.AuthAppUser, controller.CreateFolder)
+	FolderRouter.Put("/rename", middleware.AuthAppUser, controller.RenameFolder)
+	FolderRouter.Put("/move", middleware.AuthAppUser, controller.MoveFolder)
+	FolderRouter.Delete("/delete/:folderId", middleware.AuthAppUser, controller.DeleteFolder)
+}
@@ -0,0 +1,19 @@
+package router
+
+import (
+	"github.com/gofiber/fiber/v2"
+	"goPass/controller"
+	"goPass/middlewares"
+	"goPass/ratelimit"
+)
+
+// IconRoute is public on purpose, see controller.GetIcon.
+func IconRoute(app *fiber.App) {
+	IconRouter := app.Group("/icons")
+
+	IconRouter.Get("/", func(c *fiber.Ctx) error {
+		return c.SendString("icon router is up and running")
+	})
+
+	IconRouter.Get("/:domain", middleware.LimitIP(ratelimit.IconFetch), controller.GetIcon)
+}
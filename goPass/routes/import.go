@@ -0,0 +1,19 @@
+package router
+
+import (
+	"github.com/gofiber/fiber/v2"
+	"goPass/controller"
+	"goPass/middlewares"
+)
+
+func ImportRoute(app *fiber.App) {
+	ImportRouter := app.Group("/import")
+
+	ImportRouter.Get("/", func(c *fiber.Ctx) error {
+		return c.SendString("import route is up and running")
+	})
+
+	ImportRouter.Post("/parse", middleware.AuthAppUser, controller.ParseImport)
+	ImportRouter.Post("/commit", middleware.AuthAppUser, controller.CommitImport)
+	ImportRouter.Post("/gopass", middleware.AuthAppUser, controller.ImportGoPassExport)
+}
@@ -0,0 +1,30 @@
+package router
+
+import (
+	"github.com/gofiber/fiber/v2"
+	"goPass/controller"
+	"goPass/middlewares"
+)
+
+func OrgRoute(app *fiber.App) {
+	OrgRouter := app.Group("/org")
+
+	OrgRouter.Get("/", func(c *fiber.Ctx) error {
+		return c.SendString("org route is up and running")
+	})
+
+	OrgRouter.Get("/list", middleware.AuthAppUser, controller.ListOrganizations)
+	OrgRouter.Post("/create", middleware.AuthAppUser, controller.CreateOrganization)
+	OrgRouter.Delete("/delete/:orgId", middleware.AuthAppUser, controller.DeleteOrganization)
+
+	OrgRouter.Get("/:orgId/members", middleware.AuthAppUser, controller.ListMembers)
+	OrgRouter.Post("/:orgId/invite", middleware.AuthAppUser, controller.InviteMember)
+	OrgRouter.Post("/:orgId/accept", middleware.AuthAppUser, controller.AcceptOrgInvite)
+	OrgRouter.Put("/:orgId/role", middleware.AuthAppUser, controller.ChangeMemberRole)
+	OrgRouter.Delete("/:orgId/member/:userId", middleware.AuthAppUser, controller.RemoveMember)
+
+	OrgRouter.Get("/:orgId/collections", middleware.AuthAppUser, controller.ListCollections)
+	OrgRouter.Post("/:orgId/collection", middleware.AuthAppUser, controller.CreateCollection)
+	OrgRouter.Put("/:orgId/collection/:collectionId/access", middleware.AuthAppUser, controller.SetCollectionAccess)
+	OrgRouter.Delete("/:orgId/collection/:collectionId", middleware.AuthAppUser, controller.DeleteCollection)
+}
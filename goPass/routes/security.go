@@ -0,0 +1,20 @@
+package router
+
+import (
+	"github.com/gofiber/fiber/v2"
+	"goPass/controller"
+	"goPass/middlewares"
+)
+
+func SecurityRoute(app *fiber.App) {
+	SecurityRouter := app.Group("/security")
+
+	SecurityRouter.Get("/", func(c *fiber.Ctx) error {
+		return c.SendString("security route is up and running")
+	})
+
+	SecurityRouter.Get("/breach-range/:prefix", middleware.AuthAppUser, controller.BreachRange)
+
+	SecurityRouter.Put("/health", middleware.AuthAppUser, controller.UpdateVaultHealth)
+	SecurityRouter.Get("/health", middleware.AuthAppUser, controller.GetVaultHealth)
+}
@@ -0,0 +1,23 @@
+package router
+
+import (
+	"github.com/gofiber/fiber/v2"
+	"goPass/controller"
+	"goPass/middlewares"
+	"goPass/ratelimit"
+)
+
+func SendRoute(app *fiber.App) {
+	SendRouter := app.Group("/send")
+
+	SendRouter.Get("/", func(c *fiber.Ctx) error {
+		return c.SendString("send route is up and running")
+	})
+
+	SendRouter.Post("/create", middleware.AuthAppUser, controller.CreateSend)
+	SendRouter.Get("/list", middleware.AuthAppUser, controller.ListSends)
+	SendRouter.Delete("/delete/:sendId", middleware.AuthAppUser, controller.DeleteSend)
+
+	// public, opened by whoever holds the link
+	SendRouter.Post("/access/:sendId", middleware.LimitIP(ratelimit.SendAccess), controller.AccessSend)
+}
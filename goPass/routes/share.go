@@ -0,0 +1,23 @@
+package router
+
+import (
+	"github.com/gofiber/fiber/v2"
+	"goPass/controller"
+	"goPass/middlewares"
+)
+
+func ShareRoute(app *fiber.App) {
+	ShareRouter := app.Group("/share")
+
+	ShareRouter.Get("/", func(c *fiber.Ctx) error {
+		return c.SendString("share route is up and running")
+	})
+
+	ShareRouter.Get("/publickey", middleware.AuthAppUser, controller.GetPublicKey)
+	ShareRouter.Post("/create", middleware.AuthAppUser, controller.CreateShare)
+	ShareRouter.Get("/incoming", middleware.AuthAppUser, controller.ListIncomingShares)
+	ShareRouter.Get("/outgoing", middleware.AuthAppUser, controller.ListOutgoingShares)
+	ShareRouter.Post("/:shareId/accept", middleware.AuthAppUser, controller.AcceptShare)
+	ShareRouter.Post("/:shareId/decline", middleware.AuthAppUser, controller.DeclineShare)
+	ShareRouter.Delete("/revoke/:shareId", middleware.AuthAppUser, controller.RevokeShare)
+}
@@ -0,0 +1,17 @@
+package router
+
+import (
+	"github.com/gofiber/fiber/v2"
+	"goPass/controller"
+	"goPass/middlewares"
+)
+
+func SyncRoute(app *fiber.App) {
+	SyncRouter := app.Group("/sync")
+
+	SyncRouter.Get("/", func(c *fiber.Ctx) error {
+		return c.SendString("sync router is up and running")
+	})
+
+	SyncRouter.Get("/stream", middleware.AuthAppUser, controller.StreamChanges)
+}
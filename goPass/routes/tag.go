@@ -0,0 +1,20 @@
+package router
+
+import (
+	"github.com/gofiber/fiber/v2"
+	"goPass/controller"
+	"goPass/middlewares"
+)
+
+func TagRoute(app *fiber.App) {
+	TagRouter := app.Group("/tag")
+
+	TagRouter.Get("/", func(c *fiber.Ctx) error {
+		return c.SendString("tag route is up and running")
+	})
+
+	TagRouter.Get("/list", middleware.AuthAppUser, controller.ListTags)
+	TagRouter.Post("/create", middleware.AuthAppUser, controller.CreateTag)
+	TagRouter.Put("/rename", middleware.AuthAppUser, controller.RenameTag)
+	TagRouter.Delete("/delete/:tagId", middleware.AuthAppUser, controller.DeleteTag)
+}
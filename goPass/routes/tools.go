@@ -0,0 +1,26 @@
+package router
+
+import (
+	"github.com/gofiber/fiber/v2"
+	"goPass/controller"
+	"goPass/middlewares"
+)
+
+func ToolsRoute(app *fiber.App) {
+	ToolsRouter := app.Group("/tools")
+
+	ToolsRouter.Get("/", func(c *fiber.Ctx) error {
+		return c.SendString("tools route is up and running")
+	})
+
+	ToolsRouter.Post("/generate", middleware.AuthAppUser, controller.Generate)
+
+	ToolsRouter.Post("/policies", middleware.AuthAppUser, controller.CreateGeneratorPolicy)
+	ToolsRouter.Get("/policies", middleware.AuthAppUser, controller.ListGeneratorPolicies)
+	ToolsRouter.Put("/policies/:policyId", middleware.AuthAppUser, controller.UpdateGeneratorPolicy)
+	ToolsRouter.Delete("/policies/:policyId", middleware.AuthAppUser, controller.DeleteGeneratorPolicy)
+
+	ToolsRouter.Put("/sites", middleware.AuthAppUser, controller.SetSitePolicy)
+	ToolsRouter.Get("/sites", middleware.AuthAppUser, controller.ListSitePolicies)
+	ToolsRouter.Delete("/sites/:siteId", middleware.AuthAppUser, controller.DeleteSitePolicy)
+}
@@ -3,6 +3,7 @@ package router
 import (
 	"github.com/gofiber/fiber/v2"
 	"goPass/controller"
+	"goPass/middlewares"
 )
 
 func VaultRoute(app *fiber.App) {
@@ -11,11 +12,27 @@ func VaultRoute(app *fiber.App) {
 	VaultRouter.Get("/", func(c *fiber.Ctx) error {
 		return c.SendString("vault router is up and running")
 	})
-	VaultRouter.Get("/items", controller.GetYourVault)
+	VaultRouter.Get("/items", middleware.AuthAppUser, controller.GetYourVault)
 
-	VaultRouter.Post("/add", controller.CreateVault)
+	VaultRouter.Post("/add", middleware.AuthAppUser, controller.CreateVault)
 
-	VaultRouter.Delete("/delete/:vaultId", controller.DeleteVaultItem)
+	VaultRouter.Delete("/delete/:vaultId", middleware.AuthAppUser, controller.DeleteVaultItem)
 
-	VaultRouter.Put("/update", controller.UpdateItem)
+	VaultRouter.Put("/update", middleware.AuthAppUser, controller.UpdateItem)
+
+	VaultRouter.Put("/move", middleware.AuthAppUser, controller.MoveVaultItem)
+
+	VaultRouter.Put("/tags", middleware.AuthAppUser, controller.SetVaultItemTags)
+
+	VaultRouter.Put("/favorite", middleware.AuthAppUser, controller.SetVaultFavorite)
+
+	VaultRouter.Post("/used/:vaultId", middleware.AuthAppUser, controller.MarkVaultUsed)
+
+	VaultRouter.Put("/totp", middleware.AuthAppUser, controller.SetVaultTOTP)
+
+	VaultRouter.Put("/uris", middleware.AuthAppUser, controller.SetVaultURIs)
+
+	VaultRouter.Get("/lookup", middleware.AuthAppUser, controller.LookupVaultURI)
+
+	VaultRouter.Get("/export", middleware.AuthAppUser, controller.ExportVault)
 }
@@ -0,0 +1,81 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"io"
+	"strings"
+)
+
+var ErrNotFound = errors.New("blob not found")
+
+// BlobStore keeps opaque, already encrypted blobs addressed by a slash
+// separated key. Implementations never look inside the data.
+type BlobStore interface {
+	Put(ctx context.Context, key string, r io.Reader) error
+	Get(ctx context.Context, key string) (io.ReadCloser, error)
+	Delete(ctx context.Context, key string) error
+}
+
+// validKey rejects keys that could escape the store root or produce
+// ambiguous object names.
+func validKey(key string) bool {
+	if key == "" || strings.HasPrefix(key, "/") || strings.Contains(key, "\\") {
+		return false
+	}
+	for _, part := range strings.Split(key, "/") {
+		if part == "" || part == "." || part == ".." {
+			return false
+		}
+	}
+	return true
+}
+
+// ConcatReader streams several blobs back to back, opening each one only
+// when the previous one has been read to the end.
+type ConcatReader struct {
+	ctx     context.Context
+	store   BlobStore
+	keys    []string
+	current io.ReadCloser
+}
+
+func NewConcatReader(ctx context.Context, store BlobStore, keys []string) *ConcatReader {
+	return &ConcatReader{ctx: ctx, store: store, keys: keys}
+}
+
+func (r *ConcatReader) Read(p []byte) (int, error) {
+	for {
+		if r.current == nil {
+			if len(r.keys) == 0 {
+				return 0, io.EOF
+			}
+			rc, err := r.store.Get(r.ctx, r.keys[0])
+			if err != nil {
+				return 0, err
+			}
+			r.current = rc
+			r.keys = r.keys[1:]
+		}
+
+		n, err := r.current.Read(p)
+		if err == io.EOF {
+			r.current.Close()
+			r.current = nil
+			if n > 0 {
+				return n, nil
+			}
+			continue
+		}
+		return n, err
+	}
+}
+
+func (r *ConcatReader) Close() error {
+	if r.current != nil {
+		err := r.current.Close()
+		r.current = nil
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,408 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// S3Store talks to any S3 compatible object store (AWS, MinIO, R2, ...)
+// using path style URLs and SigV4 signed requests. Pointing Endpoint at a
+// local MinIO container is enough to exercise it without an AWS account.
+type S3Store struct {
+	Endpoint  string // e.g. https://s3.eu-west-1.amazonaws.com or http://localhost:9000
+	Bucket    string
+	Region    string
+	AccessKey string
+	SecretKey string
+	Prefix    string
+	Client    *http.Client
+	// PartSize is how much of a blob is held in memory at a time. Larger
+	// blobs are sent as a multipart upload in parts of this size, which S3
+	// wants to be at least 5 MiB.
+	PartSize int
+	// IdleTimeout cancels a request once no data moved for that long. A
+	// deadline for the whole request would cut off large transfers.
+	IdleTimeout time.Duration
+}
+
+const (
+	defaultS3PartSize    = 8 << 20
+	defaultS3IdleTimeout = 60 * time.Second
+)
+
+func NewS3Store(endpoint, bucket, region, accessKey, secretKey string) *S3Store {
+	if region == "" {
+		region = "us-east-1"
+	}
+	return &S3Store{
+		Endpoint:    strings.TrimRight(endpoint, "/"),
+		Bucket:      bucket,
+		Region:      region,
+		AccessKey:   accessKey,
+		SecretKey:   secretKey,
+		Client:      &http.Client{},
+		PartSize:    defaultS3PartSize,
+		IdleTimeout: defaultS3IdleTimeout,
+	}
+}
+
+// Put streams r to the store. A blob that fits in one part is a single
+// PUT, anything larger goes up part by part so it is never held in memory
+// as a whole.
+func (s *S3Store) Put(ctx context.Context, key string, r io.Reader) error {
+	partSize := s.PartSize
+	if partSize <= 0 {
+		partSize = defaultS3PartSize
+	}
+	part := make([]byte, partSize)
+	n, err := io.ReadFull(r, part)
+	if err == io.EOF || err == io.ErrUnexpectedEOF {
+		return s.putObject(ctx, key, part[:n])
+	}
+	if err != nil {
+		return err
+	}
+
+	uploadId, err := s.createMultipartUpload(ctx, key)
+	if err != nil {
+		return err
+	}
+	parts := []s3Part{}
+	for n > 0 {
+		etag, err := s.uploadPart(ctx, key, uploadId, len(parts)+1, part[:n])
+		if err != nil {
+			s.abortMultipartUpload(ctx, key, uploadId)
+			return err
+		}
+		parts = append(parts, s3Part{Number: len(parts) + 1, ETag: etag})
+
+		n, err = io.ReadFull(r, part)
+		if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+			s.abortMultipartUpload(ctx, key, uploadId)
+			return err
+		}
+	}
+	if err := s.completeMultipartUpload(ctx, key, uploadId, parts); err != nil {
+		s.abortMultipartUpload(ctx, key, uploadId)
+		return err
+	}
+	return nil
+}
+
+func (s *S3Store) putObject(ctx context.Context, key string, body []byte) error {
+	res, err := s.do(ctx, http.MethodPut, key, nil, body)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		return s3Error(res)
+	}
+	return nil
+}
+
+type s3Part struct {
+	Number int    `xml:"PartNumber"`
+	ETag   string `xml:"ETag"`
+}
+
+func (s *S3Store) createMultipartUpload(ctx context.Context, key string) (string, error) {
+	res, err := s.do(ctx, http.MethodPost, key, url.Values{"uploads": {""}}, nil)
+	if err != nil {
+		return "", err
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		return "", s3Error(res)
+	}
+	out := struct {
+		UploadID string `xml:"UploadId"`
+	}{}
+	if err := xml.NewDecoder(io.LimitReader(res.Body, 64<<10)).Decode(&out); err != nil {
+		return "", fmt.Errorf("s3 create multipart upload: %w", err)
+	}
+	if out.UploadID == "" {
+		return "", errors.New("s3 create multipart upload: no upload id")
+	}
+	return out.UploadID, nil
+}
+
+func (s *S3Store) uploadPart(ctx context.Context, key, uploadId string, number int, body []byte) (string, error) {
+	query := url.Values{"partNumber": {strconv.Itoa(number)}, "uploadId": {uploadId}}
+	res, err := s.do(ctx, http.MethodPut, key, query, body)
+	if err != nil {
+		return "", err
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		return "", s3Error(res)
+	}
+	etag := res.Header.Get("ETag")
+	if etag == "" {
+		return "", fmt.Errorf("s3 upload part %d: no etag", number)
+	}
+	return etag, nil
+}
+
+func (s *S3Store) completeMultipartUpload(ctx context.Context, key, uploadId string, parts []s3Part) error {
+	body, err := xml.Marshal(struct {
+		XMLName xml.Name `xml:"CompleteMultipartUpload"`
+		Parts   []s3Part `xml:"Part"`
+	}{Parts: parts})
+	if err != nil {
+		return err
+	}
+	res, err := s.do(ctx, http.MethodPost, key, url.Values{"uploadId": {uploadId}}, body)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		return s3Error(res)
+	}
+	// S3 can fail the upload after it already answered 200, the error is
+	// then in the body
+	reply, err := io.ReadAll(io.LimitReader(res.Body, 64<<10))
+	if err != nil {
+		return err
+	}
+	if bytes.Contains(reply, []byte("<Error>")) {
+		return fmt.Errorf("s3 complete multipart upload: %s", strings.TrimSpace(string(reply)))
+	}
+	return nil
+}
+
+// abortMultipartUpload drops the parts of a failed upload so they don't
+// linger in the bucket. It runs even when ctx is what failed the upload.
+func (s *S3Store) abortMultipartUpload(ctx context.Context, key, uploadId string) {
+	res, err := s.do(context.WithoutCancel(ctx), http.MethodDelete, key, url.Values{"uploadId": {uploadId}}, nil)
+	if err != nil {
+		return
+	}
+	res.Body.Close()
+}
+
+func (s *S3Store) Get(ctx context.Context, key string) (io.ReadCloser, error) {
+	res, err := s.do(ctx, http.MethodGet, key, nil, nil)
+	if err != nil {
+		return nil, err
+	}
+	if res.StatusCode == http.StatusNotFound {
+		res.Body.Close()
+		return nil, ErrNotFound
+	}
+	if res.StatusCode != http.StatusOK {
+		defer res.Body.Close()
+		return nil, s3Error(res)
+	}
+	return res.Body, nil
+}
+
+func (s *S3Store) Delete(ctx context.Context, key string) error {
+	res, err := s.do(ctx, http.MethodDelete, key, nil, nil)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusNoContent && res.StatusCode != http.StatusOK && res.StatusCode != http.StatusNotFound {
+		return s3Error(res)
+	}
+	return nil
+}
+
+// do sends one signed request. The request is cancelled once neither the
+// body nor the response moved for IdleTimeout, closing the response body
+// releases it.
+func (s *S3Store) do(ctx context.Context, method, key string, query url.Values, body []byte) (*http.Response, error) {
+	if !validKey(key) {
+		return nil, fmt.Errorf("invalid blob key %q", key)
+	}
+	if s.Prefix != "" {
+		key = strings.Trim(s.Prefix, "/") + "/" + key
+	}
+
+	endpoint, err := url.Parse(s.Endpoint)
+	if err != nil {
+		return nil, err
+	}
+	endpoint.Path = "/" + s.Bucket + "/" + key
+	endpoint.RawPath = "/" + escapeS3Path(s.Bucket) + "/" + escapeS3Path(key)
+	endpoint.RawQuery = canonicalQuery(query)
+
+	timeout := s.IdleTimeout
+	if timeout <= 0 {
+		timeout = defaultS3IdleTimeout
+	}
+	ctx, cancel := context.WithCancel(ctx)
+	timer := time.AfterFunc(timeout, cancel)
+	release := func() {
+		timer.Stop()
+		cancel()
+	}
+
+	var reqBody io.Reader = http.NoBody
+	if len(body) > 0 {
+		reqBody = &idleReader{r: bytes.NewReader(body), timer: timer, timeout: timeout}
+	}
+	req, err := http.NewRequestWithContext(ctx, method, endpoint.String(), reqBody)
+	if err != nil {
+		release()
+		return nil, err
+	}
+	req.ContentLength = int64(len(body))
+	s.sign(req, body, time.Now().UTC())
+
+	client := s.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	res, err := client.Do(req)
+	if err != nil {
+		release()
+		return nil, err
+	}
+	res.Body = &idleReader{r: res.Body, timer: timer, timeout: timeout, close: res.Body.Close, release: release}
+	return res, nil
+}
+
+// idleReader pushes the idle timer back whenever data comes through.
+type idleReader struct {
+	r       io.Reader
+	timer   *time.Timer
+	timeout time.Duration
+	close   func() error
+	release func()
+}
+
+func (r *idleReader) Read(p []byte) (int, error) {
+	n, err := r.r.Read(p)
+	if n > 0 {
+		r.timer.Reset(r.timeout)
+	}
+	return n, err
+}
+
+// Close releases the request when r is the response body. The transport
+// also closes request bodies, those have nothing to release.
+func (r *idleReader) Close() error {
+	if r.close == nil {
+		return nil
+	}
+	err := r.close()
+	r.release()
+	return err
+}
+
+// canonicalQuery encodes query the way SigV4 wants it in the canonical
+// request, sorted by key and with every value escaped, so the URL sent and
+// the one signed are the same string.
+func canonicalQuery(query url.Values) string {
+	keys := make([]string, 0, len(query))
+	for key := range query {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	pairs := []string{}
+	for _, key := range keys {
+		for _, value := range query[key] {
+			pairs = append(pairs, escapeS3Segment(key)+"="+escapeS3Segment(value))
+		}
+	}
+	return strings.Join(pairs, "&")
+}
+
+// sign adds an AWS Signature Version 4 Authorization header to req.
+func (s *S3Store) sign(req *http.Request, body []byte, now time.Time) {
+	amzDate := now.Format("20060102T150405Z")
+	day := now.Format("20060102")
+	payloadHash := sha256Hex(body)
+
+	req.Header.Set("X-Amz-Date", amzDate)
+	req.Header.Set("X-Amz-Content-Sha256", payloadHash)
+
+	signedHeaders := "host;x-amz-content-sha256;x-amz-date"
+	canonicalHeaders := "host:" + req.URL.Host + "\n" +
+		"x-amz-content-sha256:" + payloadHash + "\n" +
+		"x-amz-date:" + amzDate + "\n"
+
+	canonicalRequest := strings.Join([]string{
+		req.Method,
+		req.URL.EscapedPath(),
+		req.URL.RawQuery,
+		canonicalHeaders,
+		signedHeaders,
+		payloadHash,
+	}, "\n")
+
+	scope := day + "/" + s.Region + "/s3/aws4_request"
+	stringToSign := strings.Join([]string{
+		"AWS4-HMAC-SHA256",
+		amzDate,
+		scope,
+		sha256Hex([]byte(canonicalRequest)),
+	}, "\n")
+
+	key := hmacSHA256([]byte("AWS4"+s.SecretKey), day)
+	key = hmacSHA256(key, s.Region)
+	key = hmacSHA256(key, "s3")
+	key = hmacSHA256(key, "aws4_request")
+	signature := hex.EncodeToString(hmacSHA256(key, stringToSign))
+
+	req.Header.Set("Authorization", fmt.Sprintf(
+		"AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		s.AccessKey, scope, signedHeaders, signature,
+	))
+}
+
+func escapeS3Path(path string) string {
+	parts := strings.Split(path, "/")
+	for i, part := range parts {
+		parts[i] = escapeS3Segment(part)
+	}
+	return strings.Join(parts, "/")
+}
+
+// escapeS3Segment percent encodes everything outside the RFC 3986
+// unreserved set, which is what SigV4 expects in the canonical URI.
+func escapeS3Segment(segment string) string {
+	var b strings.Builder
+	for i := 0; i < len(segment); i++ {
+		ch := segment[i]
+		if ('A' <= ch && ch <= 'Z') || ('a' <= ch && ch <= 'z') || ('0' <= ch && ch <= '9') ||
+			ch == '-' || ch == '_' || ch == '.' || ch == '~' {
+			b.WriteByte(ch)
+		} else {
+			fmt.Fprintf(&b, "%%%02X", ch)
+		}
+	}
+	return b.String()
+}
+
+func sha256Hex(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	h := hmac.New(sha256.New, key)
+	h.Write([]byte(data))
+	return h.Sum(nil)
+}
+
+func s3Error(res *http.Response) error {
+	msg, _ := io.ReadAll(io.LimitReader(res.Body, 1024))
+	return fmt.Errorf("s3 %s: %s", res.Status, strings.TrimSpace(string(msg)))
+}
@@ -0,0 +1,24 @@
+package utils
+
+import (
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+)
+
+// PublicKeyFingerprint checks that key is a base64 encoded DER (PKIX) public
+// key and returns the hex SHA-256 of the DER bytes, which users can compare
+// out of band before trusting a key.
+func PublicKeyFingerprint(key string) (string, error) {
+	der, err := base64.StdEncoding.DecodeString(key)
+	if err != nil {
+		return "", errors.New("public key must be base64 encoded")
+	}
+	if _, err := x509.ParsePKIXPublicKey(der); err != nil {
+		return "", errors.New("public key must be a DER encoded PKIX key")
+	}
+	sum := sha256.Sum256(der)
+	return hex.EncodeToString(sum[:]), nil
+}
@@ -0,0 +1,146 @@
+package vaultexport
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/pbkdf2"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+)
+
+var (
+	ErrWrongPassword = errors.New("vaultexport: wrong master password or corrupted key")
+	ErrBadItemKey    = errors.New("vaultexport: item key can't be unwrapped")
+)
+
+// Decode reads a whole export and checks that it is one this package
+// understands.
+func Decode(r io.Reader) (*Document, error) {
+	doc := Document{}
+	dec := json.NewDecoder(r)
+	if err := dec.Decode(&doc); err != nil {
+		return nil, fmt.Errorf("vaultexport: %w", err)
+	}
+	if err := doc.Validate(); err != nil {
+		return nil, err
+	}
+	return &doc, nil
+}
+
+func (d *Document) Validate() error {
+	if d.Format != Format {
+		return fmt.Errorf("vaultexport: not a goPass export (format %q)", d.Format)
+	}
+	if d.Version < 1 || d.Version > Version {
+		return fmt.Errorf("vaultexport: unsupported version %d", d.Version)
+	}
+	if d.KDF.Algorithm != KDFPBKDF2SHA256 {
+		return fmt.Errorf("vaultexport: unsupported kdf %q", d.KDF.Algorithm)
+	}
+	if d.KDF.Iterations < 1 || d.KDF.KeyLength != 32 {
+		return errors.New("vaultexport: invalid kdf parameters")
+	}
+	if d.Keys.Cipher != CipherAES256CBC {
+		return fmt.Errorf("vaultexport: unsupported cipher %q", d.Keys.Cipher)
+	}
+	return nil
+}
+
+// Vault holds the key that entries of an unlocked export are encrypted with.
+type Vault struct {
+	key []byte
+}
+
+// Unlock derives the master key, unwraps the vault key and derives the
+// entry key from both, the same way the clients do.
+func (d *Document) Unlock(masterPassword string) (*Vault, error) {
+	salt, err := hex.DecodeString(d.KDF.Salt)
+	if err != nil {
+		return nil, errors.New("vaultexport: kdf salt is not hex")
+	}
+	masterKey, err := pbkdf2.Key(sha256.New, masterPassword, salt, d.KDF.Iterations, d.KDF.KeyLength)
+	if err != nil {
+		return nil, err
+	}
+
+	iv, err := hex.DecodeString(d.Keys.Master.IV)
+	if err != nil {
+		return nil, ErrWrongPassword
+	}
+	wrapped, err := hex.DecodeString(d.Keys.Master.Ciphertext)
+	if err != nil {
+		return nil, ErrWrongPassword
+	}
+	vaultKey, err := decryptCBC(masterKey, iv, wrapped)
+	if err != nil {
+		return nil, ErrWrongPassword
+	}
+	// The vault key is kept as the hex string of 32 random bytes, anything
+	// else means the padding happened to check out on a wrong key.
+	if _, err := hex.DecodeString(string(vaultKey)); err != nil || len(vaultKey) != 64 {
+		return nil, ErrWrongPassword
+	}
+
+	entryKey, err := pbkdf2.Key(sha256.New, string(vaultKey)+masterPassword, salt, d.KDF.Iterations, d.KDF.KeyLength)
+	if err != nil {
+		return nil, err
+	}
+	return &Vault{key: entryKey}, nil
+}
+
+// Decrypt opens any value encrypted with the vault's entry key, such as
+// folder and tag names or custom field values.
+func (v *Vault) Decrypt(ciphertext, iv []byte) ([]byte, error) {
+	return decryptCBC(v.key, iv, ciphertext)
+}
+
+// ForEntry returns the vault that opens the values of one entry. Most
+// entries use the entry key, those with an item key use that instead once
+// it is unwrapped.
+func (v *Vault) ForEntry(entry Entry) (*Vault, error) {
+	if len(entry.EncryptedItemKey) == 0 {
+		return v, nil
+	}
+	if len(entry.EncryptedItemKey) <= aes.BlockSize {
+		return nil, ErrBadItemKey
+	}
+	iv, wrapped := entry.EncryptedItemKey[:aes.BlockSize], entry.EncryptedItemKey[aes.BlockSize:]
+	itemKey, err := decryptCBC(v.key, iv, wrapped)
+	if err != nil || len(itemKey) != 32 {
+		return nil, ErrBadItemKey
+	}
+	return &Vault{key: itemKey}, nil
+}
+
+// DecryptEntry returns the plaintext password (or type payload) of an entry.
+func (v *Vault) DecryptEntry(entry Entry) ([]byte, error) {
+	ev, err := v.ForEntry(entry)
+	if err != nil {
+		return nil, err
+	}
+	return ev.Decrypt(entry.EncryptedPassword, entry.IV)
+}
+
+func decryptCBC(key, iv, ciphertext []byte) ([]byte, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	if len(iv) != aes.BlockSize || len(ciphertext) == 0 || len(ciphertext)%aes.BlockSize != 0 {
+		return nil, errors.New("vaultexport: malformed ciphertext")
+	}
+
+	plain := make([]byte, len(ciphertext))
+	cipher.NewCBCDecrypter(block, iv).CryptBlocks(plain, ciphertext)
+
+	pad := int(plain[len(plain)-1])
+	if pad == 0 || pad > aes.BlockSize || !bytes.Equal(plain[len(plain)-pad:], bytes.Repeat([]byte{byte(pad)}, pad)) {
+		return nil, errors.New("vaultexport: bad padding")
+	}
+	return plain[:len(plain)-pad], nil
+}
@@ -0,0 +1,119 @@
+package vaultexport
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/pbkdf2"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"testing"
+)
+
+func encryptCBC(t *testing.T, key, iv, plain []byte) []byte {
+	t.Helper()
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pad := aes.BlockSize - len(plain)%aes.BlockSize
+	padded := append(append([]byte{}, plain...), bytes.Repeat([]byte{byte(pad)}, pad)...)
+	out := make([]byte, len(padded))
+	cipher.NewCBCEncrypter(block, iv).CryptBlocks(out, padded)
+	return out
+}
+
+func randomBytes(t *testing.T, n int) []byte {
+	t.Helper()
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		t.Fatal(err)
+	}
+	return b
+}
+
+// testExport builds a document the way the clients would, following the
+// steps in FORMAT.md, and returns it with the entry key.
+func testExport(t *testing.T, masterPassword string) (*Document, []byte) {
+	t.Helper()
+	salt := randomBytes(t, 16)
+	vaultKey := hex.EncodeToString(randomBytes(t, 32))
+	masterKey, err := pbkdf2.Key(sha256.New, masterPassword, salt, DefaultKDFIterations, DefaultKDFKeyLength)
+	if err != nil {
+		t.Fatal(err)
+	}
+	entryKey, err := pbkdf2.Key(sha256.New, vaultKey+masterPassword, salt, DefaultKDFIterations, DefaultKDFKeyLength)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	iv := randomBytes(t, aes.BlockSize)
+	doc := &Document{
+		Format:  Format,
+		Version: Version,
+		KDF:     KDF{Algorithm: KDFPBKDF2SHA256, Iterations: DefaultKDFIterations, KeyLength: DefaultKDFKeyLength, Salt: hex.EncodeToString(salt)},
+		Keys: Keys{Cipher: CipherAES256CBC, Master: WrappedKey{
+			IV:         hex.EncodeToString(iv),
+			Ciphertext: hex.EncodeToString(encryptCBC(t, masterKey, iv, []byte(vaultKey))),
+		}},
+	}
+	return doc, entryKey
+}
+
+func TestDecryptEntry(t *testing.T) {
+	doc, entryKey := testExport(t, "correct horse")
+	vault, err := doc.Unlock("correct horse")
+	if err != nil {
+		t.Fatal("unlock:", err)
+	}
+
+	iv := randomBytes(t, aes.BlockSize)
+	plain := Entry{EncryptedPassword: encryptCBC(t, entryKey, iv, []byte("hunter2")), IV: iv}
+
+	itemKey := randomBytes(t, 32)
+	keyIV := randomBytes(t, aes.BlockSize)
+	keyed := Entry{
+		EncryptedPassword: encryptCBC(t, itemKey, iv, []byte("swordfish")),
+		IV:                iv,
+		EncryptedItemKey:  append(keyIV, encryptCBC(t, entryKey, keyIV, itemKey)...),
+	}
+
+	tests := []struct {
+		name  string
+		entry Entry
+		want  string
+		err   error
+	}{
+		{"entry key", plain, "hunter2", nil},
+		{"item key", keyed, "swordfish", nil},
+		{"item key too short", Entry{EncryptedPassword: keyed.EncryptedPassword, IV: iv, EncryptedItemKey: keyIV}, "", ErrBadItemKey},
+		{"item key wrapped by another key", Entry{
+			EncryptedPassword: keyed.EncryptedPassword,
+			IV:                iv,
+			EncryptedItemKey:  append(keyIV, encryptCBC(t, randomBytes(t, 32), keyIV, itemKey)...),
+		}, "", ErrBadItemKey},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := vault.DecryptEntry(tt.entry)
+			if tt.err != nil {
+				if !errors.Is(err, tt.err) {
+					t.Fatalf("err = %v, want %v", err, tt.err)
+				}
+				return
+			}
+			if err != nil || string(got) != tt.want {
+				t.Fatalf("got %q, %v, want %q", got, err, tt.want)
+			}
+		})
+	}
+}
+
+func TestUnlockWrongPassword(t *testing.T) {
+	doc, _ := testExport(t, "correct horse")
+	if _, err := doc.Unlock("battery staple"); !errors.Is(err, ErrWrongPassword) {
+		t.Fatalf("err = %v, want ErrWrongPassword", err)
+	}
+}
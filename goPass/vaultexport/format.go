@@ -0,0 +1,109 @@
+// Package vaultexport reads and writes goPass vault exports. An export is a
+// single JSON document holding a user's still encrypted entries together
+// with the wrapped vault key and the KDF parameters needed to unwrap it, so
+// it can be opened offline with nothing but the master password. The layout
+// is described in FORMAT.md next to this file.
+package vaultexport
+
+import (
+	"encoding/json"
+	"time"
+)
+
+const (
+	Format  = "gopass-export"
+	Version = 1
+)
+
+const (
+	KDFPBKDF2SHA256 = "pbkdf2-sha256"
+	CipherAES256CBC = "aes-256-cbc"
+)
+
+// Parameters the clients currently use to derive keys from the master
+// password. They are written into every export so a future change to the
+// clients doesn't strand old files.
+const (
+	DefaultKDFIterations = 1000
+	DefaultKDFKeyLength  = 32
+)
+
+type Document struct {
+	Format     string    `json:"format"`
+	Version    int       `json:"version"`
+	ExportedAt time.Time `json:"exportedAt"`
+	Account    Account   `json:"account"`
+	KDF        KDF       `json:"kdf"`
+	Keys       Keys      `json:"keys"`
+	Folders    []Folder  `json:"folders"`
+	Tags       []Tag     `json:"tags"`
+	Entries    []Entry   `json:"entries"`
+}
+
+type Account struct {
+	ID    string `json:"id"`
+	Email string `json:"email"`
+}
+
+// KDF describes how the master key is derived from the master password.
+// Salt is hex encoded, exactly as the clients store it.
+type KDF struct {
+	Algorithm  string `json:"algorithm"`
+	Iterations int    `json:"iterations"`
+	KeyLength  int    `json:"keyLength"`
+	Salt       string `json:"salt"`
+}
+
+// Keys holds the vault key wrapped by the master key, as {iv, ciphertext}
+// hex strings.
+type Keys struct {
+	Cipher string     `json:"cipher"`
+	Master WrappedKey `json:"master"`
+}
+
+type WrappedKey struct {
+	IV         string `json:"iv"`
+	Ciphertext string `json:"ciphertext"`
+}
+
+type Folder struct {
+	ID            string  `json:"id"`
+	ParentID      *string `json:"parentId,omitempty"`
+	EncryptedName []byte  `json:"encryptedName"`
+	IV            []byte  `json:"iv"`
+}
+
+type Tag struct {
+	ID            string `json:"id"`
+	EncryptedName []byte `json:"encryptedName"`
+	IV            []byte `json:"iv"`
+}
+
+// Entry is one vault item. Binary fields are base64, Envelope,
+// CustomFields and URIs are copied verbatim from the server.
+type Entry struct {
+	ID                string          `json:"id"`
+	ItemType          string          `json:"itemType"`
+	PlatformName      string          `json:"platformName"`
+	EntryKey          string          `json:"entryKey"`
+	EncryptedPassword []byte          `json:"encryptedPassword"`
+	IV                []byte          `json:"iv"`
+	EncryptedItemKey  []byte          `json:"encryptedItemKey,omitempty"`
+	Envelope          json.RawMessage `json:"envelope,omitempty"`
+	CustomFields      json.RawMessage `json:"customFields,omitempty"`
+	URIs              json.RawMessage `json:"uris,omitempty"`
+	TOTP              *TOTP           `json:"totp,omitempty"`
+	FolderID          *string         `json:"folderId,omitempty"`
+	TagIDs            []string        `json:"tagIds,omitempty"`
+	Favorite          bool            `json:"favorite"`
+	CreatedAt         time.Time       `json:"createdAt"`
+	UpdatedAt         time.Time       `json:"updatedAt"`
+}
+
+type TOTP struct {
+	EncryptedSeed []byte `json:"encryptedSeed"`
+	SeedIV        []byte `json:"seedIv"`
+	Algorithm     string `json:"algorithm"`
+	Digits        int    `json:"digits"`
+	Period        int    `json:"period"`
+}
@@ -0,0 +1,70 @@
+package vaultexport
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io"
+)
+
+// Writer streams a Document so a large vault never has to sit in memory.
+// Everything but the entries is written up front, entries follow one by one
+// and Close ends the document. An export that was cut off half way is not
+// valid JSON and Decode rejects it.
+type Writer struct {
+	w      io.Writer
+	count  int
+	closed bool
+}
+
+// NewWriter writes the header of doc. doc.Entries is ignored, pass the
+// entries to WriteEntry instead.
+func NewWriter(w io.Writer, doc Document) (*Writer, error) {
+	doc.Format = Format
+	doc.Version = Version
+	doc.Entries = nil
+	if doc.Folders == nil {
+		doc.Folders = []Folder{}
+	}
+	if doc.Tags == nil {
+		doc.Tags = []Tag{}
+	}
+
+	header, err := json.Marshal(doc)
+	if err != nil {
+		return nil, err
+	}
+	// Swap the trailing `"entries":null}` for an open array.
+	header = bytes.TrimSuffix(header, []byte(`"entries":null}`))
+	if _, err := w.Write(append(header, `"entries":[`...)); err != nil {
+		return nil, err
+	}
+	return &Writer{w: w}, nil
+}
+
+func (w *Writer) WriteEntry(entry Entry) error {
+	if w.closed {
+		return errors.New("vaultexport: write after close")
+	}
+	raw, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+	if w.count > 0 {
+		raw = append([]byte{','}, raw...)
+	}
+	if _, err := w.w.Write(raw); err != nil {
+		return err
+	}
+	w.count++
+	return nil
+}
+
+func (w *Writer) Close() error {
+	if w.closed {
+		return nil
+	}
+	w.closed = true
+	_, err := io.WriteString(w.w, "]}\n")
+	return err
+}